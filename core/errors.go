@@ -14,12 +14,16 @@
 
 package core
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 var (
-	ErrMissingRegoModules   = fmt.Errorf("no rego module found in directory")
-	ErrRegoModuleReadFailed = fmt.Errorf("failed rego file read")
-	ErrInvalidConfig        = fmt.Errorf("invalid rond configuration")
+	ErrMissingRegoModules    = fmt.Errorf("no rego module found in directory")
+	ErrRegoModuleReadFailed  = fmt.Errorf("failed rego file read")
+	ErrRegoModuleParseFailed = fmt.Errorf("failed rego module parse")
+	ErrInvalidConfig         = fmt.Errorf("invalid rond configuration")
 
 	ErrEvaluatorCreationFailed = fmt.Errorf("error during evaluator creation")
 	ErrEvaluatorNotFound       = fmt.Errorf("evaluator not found")
@@ -34,4 +38,19 @@ var (
 	ErrFailedInputRequestParse           = fmt.Errorf("failed request body parse")
 	ErrFailedInputRequestDeserialization = fmt.Errorf("failed request body deserialization")
 	ErrRondConfigNotExists               = fmt.Errorf("rond config does not exist")
+	ErrPolicyNotDefined                  = fmt.Errorf("policy not defined in rego module")
 )
+
+// RateLimitError is returned if the policy does not allow the request and a rate
+// limit checked with the rate_limit builtin has been exceeded. It wraps ErrPolicyNotAllowed.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: rate limit exceeded", ErrPolicyNotAllowed)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrPolicyNotAllowed
+}
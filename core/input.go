@@ -15,6 +15,7 @@
 package core
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -40,6 +41,53 @@ type InputRequest struct {
 	PathParams map[string]string `json:"pathParams,omitempty"`
 	Method     string            `json:"method"`
 	Path       string            `json:"path"`
+	TLS        *InputRequestTLS  `json:"tls,omitempty"`
+}
+
+// InputRequestTLS describes the TLS connection the request has been received on.
+type InputRequestTLS struct {
+	PeerCertificate *InputPeerCertificate `json:"peerCertificate,omitempty"`
+}
+
+// InputPeerCertificate is the verified certificate presented by the client.
+type InputPeerCertificate struct {
+	Subject        string   `json:"subject"`
+	CommonName     string   `json:"commonName,omitempty"`
+	Issuer         string   `json:"issuer"`
+	SerialNumber   string   `json:"serialNumber"`
+	DNSNames       []string `json:"dnsNames,omitempty"`
+	EmailAddresses []string `json:"emailAddresses,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+	IPAddresses    []string `json:"ipAddresses,omitempty"`
+}
+
+// NewInputRequestTLS returns the TLS information of the connection, or nil if the
+// connection is not over TLS.
+func NewInputRequestTLS(state *tls.ConnectionState) *InputRequestTLS {
+	if state == nil {
+		return nil
+	}
+
+	requestTLS := &InputRequestTLS{}
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		certificate := state.VerifiedChains[0][0]
+		peerCertificate := &InputPeerCertificate{
+			Subject:        certificate.Subject.String(),
+			CommonName:     certificate.Subject.CommonName,
+			Issuer:         certificate.Issuer.String(),
+			SerialNumber:   certificate.SerialNumber.String(),
+			DNSNames:       certificate.DNSNames,
+			EmailAddresses: certificate.EmailAddresses,
+		}
+		for _, uri := range certificate.URIs {
+			peerCertificate.URIs = append(peerCertificate.URIs, uri.String())
+		}
+		for _, ip := range certificate.IPAddresses {
+			peerCertificate.IPAddresses = append(peerCertificate.IPAddresses, ip.String())
+		}
+		requestTLS.PeerCertificate = peerCertificate
+	}
+	return requestTLS
 }
 
 type InputResponse struct {
@@ -16,6 +16,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/rond-authz/rond/custom_builtins"
 	"github.com/rond-authz/rond/internal/opatranslator"
+	"github.com/rond-authz/rond/internal/tracing"
 	"github.com/rond-authz/rond/internal/utils"
 	"github.com/rond-authz/rond/logging"
 	"github.com/rond-authz/rond/metrics"
@@ -32,6 +34,8 @@ import (
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/rego"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type RondConfig struct {
@@ -58,6 +62,9 @@ type ResponseFlow struct {
 type PermissionOptions struct {
 	EnableResourcePermissionsMapOptimization bool `json:"enableResourcePermissionsMapOptimization"`
 	IgnoreTrailingSlash                      bool `json:"ignoreTrailingSlash,omitempty"`
+	// EnablePrintStatements writes the output of the print statements of the
+	// policies of the route, also when it is not enabled for all the evaluations.
+	EnablePrintStatements bool `json:"enablePrintStatements,omitempty"`
 }
 
 type Evaluator interface {
@@ -71,16 +78,23 @@ type OPAEvaluator struct {
 	PolicyEvaluator Evaluator
 	PolicyName      string
 
-	context       context.Context
-	mongoClient   custom_builtins.IMongoClient
-	generateQuery bool
-	logger        logging.Logger
+	context        context.Context
+	mongoClient    custom_builtins.IMongoClient
+	rateLimitStore custom_builtins.RateLimitStore
+	generateQuery  bool
+	logger         logging.Logger
 }
 
 type OPAEvaluatorOptions struct {
+	// EnablePrintStatements writes the output of the policies print statements
+	// for all the evaluations, instead of only for the contexts created with
+	// WithPrintStatements.
 	EnablePrintStatements bool
 	MongoClient           custom_builtins.IMongoClient
-	Logger                logging.Logger
+	// RateLimitStore keeps the hits of the rate limits checked with the rate_limit
+	// builtin, whose calls are undefined if it is not set.
+	RateLimitStore custom_builtins.RateLimitStore
+	Logger         logging.Logger
 }
 
 func newQueryOPAEvaluator(ctx context.Context, policy string, opaModuleConfig *OPAModuleConfig, input []byte, options *OPAEvaluatorOptions) (*OPAEvaluator, error) {
@@ -100,21 +114,25 @@ func newQueryOPAEvaluator(ctx context.Context, policy string, opaModuleConfig *O
 		rego.ParsedInput(inputTerm.Value),
 		rego.Unknowns(Unknowns),
 		rego.Capabilities(ast.CapabilitiesForThisVersion()),
-		rego.EnablePrintStatements(options.EnablePrintStatements),
-		rego.PrintHook(NewPrintHook(os.Stdout, policy)),
+		// Print statements are compiled only if their output is enabled, since the
+		// print calls are not supported by the query generation.
+		rego.EnablePrintStatements(options.EnablePrintStatements || printStatementsEnabled(ctx)),
+		rego.PrintHook(NewPrintHook(policy, options.EnablePrintStatements)),
 		custom_builtins.GetHeaderFunction,
 		custom_builtins.MongoFindOne,
 		custom_builtins.MongoFindMany,
+		custom_builtins.RateLimit,
 	)
 
 	return &OPAEvaluator{
 		PolicyEvaluator: query,
 		PolicyName:      policy,
 
-		context:       ctx,
-		mongoClient:   options.MongoClient,
-		generateQuery: true,
-		logger:        options.Logger,
+		context:        ctx,
+		mongoClient:    options.MongoClient,
+		rateLimitStore: options.RateLimitStore,
+		generateQuery:  true,
+		logger:         options.Logger,
 	}, nil
 }
 
@@ -135,12 +153,35 @@ func (config *OPAModuleConfig) CreateQueryEvaluator(ctx context.Context, logger
 	return evaluator, nil
 }
 
-func (evaluator *OPAEvaluator) partiallyEvaluate(logger logging.Logger, options *PolicyEvaluationOptions) (primitive.M, error) {
+// startEvaluationSpan starts the span of the policy evaluation, ended with endEvaluationSpan.
+func (evaluator *OPAEvaluator) startEvaluationSpan(options *PolicyEvaluationOptions, partialEval bool) (context.Context, trace.Span) {
+	return tracing.Start(evaluator.getContext(options), "OPAEvaluator.PolicyEvaluation", trace.WithAttributes(
+		attribute.String("rond.policy_name", evaluator.PolicyName),
+		attribute.Bool("rond.partial_evaluation", partialEval),
+	))
+}
+
+// endEvaluationSpan ends the policy evaluation span, recording the denied requests
+// as not allowed instead of as errors.
+func endEvaluationSpan(span trace.Span, err error) {
+	allowed := err == nil
+	if errors.Is(err, ErrPolicyNotAllowed) {
+		err = nil
+	}
+	span.SetAttributes(attribute.Bool("rond.allowed", allowed))
+	tracing.End(span, err)
+}
+
+func (evaluator *OPAEvaluator) partiallyEvaluate(logger logging.Logger, options *PolicyEvaluationOptions) (query primitive.M, err error) {
 	if options == nil {
 		options = &PolicyEvaluationOptions{}
 	}
+	ctx, span := evaluator.startEvaluationSpan(options, true)
+	defer func() { endEvaluationSpan(span, err) }()
+	ctx, rateLimits := custom_builtins.WithRateLimits(ctx)
+
 	opaEvaluationTimeStart := time.Now()
-	partialResults, err := evaluator.PolicyEvaluator.Partial(evaluator.getContext())
+	partialResults, err := evaluator.PolicyEvaluator.Partial(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrPartialPolicyEvalFailed, err.Error())
 	}
@@ -164,6 +205,9 @@ func (evaluator *OPAEvaluator) partiallyEvaluate(logger logging.Logger, options
 	client := opatranslator.OPAClient{}
 	q, err := client.ProcessQuery(partialResults)
 	if err != nil {
+		if errors.Is(err, opatranslator.ErrEmptyQuery) && rateLimits.Exceeded() {
+			return nil, &RateLimitError{RetryAfter: rateLimits.RetryAfter()}
+		}
 		return nil, err
 	}
 
@@ -175,14 +219,17 @@ func (evaluator *OPAEvaluator) partiallyEvaluate(logger logging.Logger, options
 	return q, nil
 }
 
-func (evaluator *OPAEvaluator) Evaluate(logger logging.Logger, options *PolicyEvaluationOptions) (interface{}, error) {
+func (evaluator *OPAEvaluator) Evaluate(logger logging.Logger, options *PolicyEvaluationOptions) (result interface{}, err error) {
 	if options == nil {
 		options = &PolicyEvaluationOptions{}
 	}
+	ctx, span := evaluator.startEvaluationSpan(options, false)
+	defer func() { endEvaluationSpan(span, err) }()
+	ctx, rateLimits := custom_builtins.WithRateLimits(ctx)
 
 	opaEvaluationTimeStart := time.Now()
 
-	results, err := evaluator.PolicyEvaluator.Eval(evaluator.getContext())
+	results, err := evaluator.PolicyEvaluator.Eval(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrPolicyEvalFailed, err.Error())
 	}
@@ -212,19 +259,34 @@ func (evaluator *OPAEvaluator) Evaluate(logger logging.Logger, options *PolicyEv
 	if allowed {
 		return responseBodyOverwriter, nil
 	}
+	if rateLimits.Exceeded() {
+		return nil, &RateLimitError{RetryAfter: rateLimits.RetryAfter()}
+	}
 	return nil, ErrPolicyNotAllowed
 }
 
-func (evaluator *OPAEvaluator) getContext() context.Context {
+func (evaluator *OPAEvaluator) getContext(options *PolicyEvaluationOptions) context.Context {
 	ctx := evaluator.context
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	if options.Metrics != nil {
+		ctx = metrics.WithContext(ctx, options.Metrics)
+	}
 	if evaluator.mongoClient != nil {
 		ctx = custom_builtins.WithMongoClient(ctx, evaluator.mongoClient)
 	}
+	if evaluator.rateLimitStore != nil {
+		ctx = custom_builtins.WithRateLimitStore(ctx, evaluator.rateLimitStore)
+	}
 	if evaluator.logger != nil {
-		ctx = logging.WithContext(ctx, evaluator.logger)
+		logger := evaluator.logger
+		if len(options.AdditionalLogFields) > 0 {
+			fields := map[string]any{}
+			addDataToLogFields(fields, options.AdditionalLogFields)
+			logger = logger.WithFields(fields)
+		}
+		ctx = logging.WithContext(ctx, logger)
 	}
 	return ctx
 }
@@ -266,6 +328,121 @@ type OPAModuleConfig struct {
 	Content string
 }
 
+const policiesPackagePath = "data.policies"
+
+// PolicyNames returns the names of the rules defined in the policies package of
+// the module, which are the policies that can be referenced by the rond configuration.
+func (config *OPAModuleConfig) PolicyNames() ([]string, error) {
+	module, err := config.parsePoliciesModule()
+	if err != nil {
+		return nil, err
+	}
+	return modulePolicyNames(module), nil
+}
+
+// CheckPolicies compares the given policies with the ones defined in the module,
+// returning the policies which are not defined and the defined policies which are
+// neither in the list nor referenced by other rules of the module.
+func (config *OPAModuleConfig) CheckPolicies(policies []string) ([]string, []string, error) {
+	module, err := config.parsePoliciesModule()
+	if err != nil {
+		return nil, nil, err
+	}
+	policyNames := modulePolicyNames(module)
+
+	referencedPolicies := referencedPolicyNames(module, policyNames)
+	missingPolicies := []string{}
+	for _, policy := range policies {
+		referencedPolicies = append(referencedPolicies, policyName(policy))
+		if !IsPolicyDefined(policyNames, policy) && !utils.Contains(missingPolicies, policy) {
+			missingPolicies = append(missingPolicies, policy)
+		}
+	}
+
+	unusedPolicies := []string{}
+	for _, policyName := range policyNames {
+		if !utils.Contains(referencedPolicies, policyName) {
+			unusedPolicies = append(unusedPolicies, policyName)
+		}
+	}
+	return missingPolicies, unusedPolicies, nil
+}
+
+// IsPolicyDefined returns true if the policy referenced by the rond configuration
+// is one of the policy names returned by PolicyNames.
+func IsPolicyDefined(policyNames []string, policy string) bool {
+	return utils.Contains(policyNames, policyName(policy))
+}
+
+// policyName returns the name of the rule evaluated for the policy of the rond configuration.
+func policyName(policy string) string {
+	return strings.Replace(policy, ".", "_", -1)
+}
+
+// parsePoliciesModule parses the module, returning nil if it is not the policies package.
+func (config *OPAModuleConfig) parsePoliciesModule() (*ast.Module, error) {
+	module, err := ast.ParseModule(config.Name, config.Content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRegoModuleParseFailed, err.Error())
+	}
+	if module.Package.Path.String() != policiesPackagePath {
+		return nil, nil
+	}
+	return module, nil
+}
+
+func modulePolicyNames(module *ast.Module) []string {
+	policyNames := []string{}
+	if module == nil {
+		return policyNames
+	}
+	for _, rule := range module.Rules {
+		if name := rulePolicyName(rule); !utils.Contains(policyNames, name) {
+			policyNames = append(policyNames, name)
+		}
+	}
+	return policyNames
+}
+
+func rulePolicyName(rule *ast.Rule) string {
+	name := rule.Head.Name.String()
+	if name == "" && len(rule.Head.Reference) > 0 {
+		name = rule.Head.Reference[0].Value.String()
+	}
+	return name
+}
+
+// referencedPolicyNames returns the policies referenced by the rules of the module,
+// either by name or with the full data.policies path.
+func referencedPolicyNames(module *ast.Module, policyNames []string) []string {
+	referencedPolicies := []string{}
+	if module == nil {
+		return referencedPolicies
+	}
+	policiesPackageRef := module.Package.Path
+	for _, rule := range module.Rules {
+		ruleName := rulePolicyName(rule)
+		addReference := func(name string) {
+			if name != ruleName && utils.Contains(policyNames, name) && !utils.Contains(referencedPolicies, name) {
+				referencedPolicies = append(referencedPolicies, name)
+			}
+		}
+		ast.WalkVars(rule, func(v ast.Var) bool {
+			addReference(string(v))
+			return false
+		})
+		ast.WalkRefs(rule, func(ref ast.Ref) bool {
+			if ref.HasPrefix(policiesPackageRef) && len(ref) > len(policiesPackageRef) {
+				if policy, ok := ref[len(policiesPackageRef)].Value.(ast.String); ok {
+					addReference(string(policy))
+				}
+			}
+			return false
+		})
+	}
+	return referencedPolicies
+}
+
 type PermissionOnResourceKey string
 
 type PermissionsOnResourceMap map[PermissionOnResourceKey]bool
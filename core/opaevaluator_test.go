@@ -22,10 +22,15 @@ import (
 
 	"github.com/rond-authz/rond/custom_builtins"
 	"github.com/rond-authz/rond/custom_builtins/mocks"
+	"github.com/rond-authz/rond/internal/testutils"
 	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/metrics"
+	metricstest "github.com/rond-authz/rond/metrics/test"
 	"github.com/rond-authz/rond/types"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
 func TestNewOPAEvaluator(t *testing.T) {
@@ -48,7 +53,7 @@ func TestOPAEvaluator(t *testing.T) {
 	t.Run("get context", func(t *testing.T) {
 		t.Run("no context", func(t *testing.T) {
 			opaEval := OPAEvaluator{}
-			ctx := opaEval.getContext()
+			ctx := opaEval.getContext(&PolicyEvaluationOptions{})
 
 			require.NotNil(t, ctx)
 			client, err := custom_builtins.GetMongoClientFromContext(ctx)
@@ -65,7 +70,7 @@ func TestOPAEvaluator(t *testing.T) {
 			opaEval := OPAEvaluator{
 				context: originalContext,
 			}
-			ctx := opaEval.getContext()
+			ctx := opaEval.getContext(&PolicyEvaluationOptions{})
 
 			require.NotNil(t, ctx)
 			client, err := custom_builtins.GetMongoClientFromContext(ctx)
@@ -79,7 +84,7 @@ func TestOPAEvaluator(t *testing.T) {
 				context:     context.Background(),
 				mongoClient: mongoClient,
 			}
-			ctx := opaEval.getContext()
+			ctx := opaEval.getContext(&PolicyEvaluationOptions{})
 
 			require.NotNil(t, ctx)
 			client, err := custom_builtins.GetMongoClientFromContext(ctx)
@@ -93,12 +98,113 @@ func TestOPAEvaluator(t *testing.T) {
 				context: context.Background(),
 				logger:  log,
 			}
-			ctx := opaEval.getContext()
+			ctx := opaEval.getContext(&PolicyEvaluationOptions{})
 
 			require.NotNil(t, ctx)
 			actualLog := logging.FromContext(ctx)
 			require.Equal(t, log, actualLog)
 		})
+
+		t.Run("passed metrics", func(t *testing.T) {
+			testMetrics, _ := metricstest.New()
+			opaEval := OPAEvaluator{
+				context: context.Background(),
+			}
+			ctx := opaEval.getContext(&PolicyEvaluationOptions{Metrics: testMetrics})
+
+			require.Equal(t, testMetrics, metrics.FromContext(ctx))
+		})
+	})
+}
+
+func TestOPAEvaluatorTracing(t *testing.T) {
+	exporter := testutils.SetupTracing(t)
+
+	opaModuleConfig := &OPAModuleConfig{Name: "mypolicy.rego", Content: `package policies
+allow {
+	project := find_one("projects", {"projectId": "1234"})
+	project.tenantId == "some-tenant"
+}`}
+	mongoClient := mocks.MongoClientMock{
+		FindOneResult:      map[string]interface{}{"tenantId": "some-tenant"},
+		FindOneExpectation: func(collectionName string, query interface{}) {},
+	}
+	inputBytes, _ := json.Marshal(Input{})
+
+	evaluator, err := opaModuleConfig.CreateQueryEvaluator(context.Background(), logging.NewNoOpLogger(), "allow", inputBytes, &OPAEvaluatorOptions{
+		MongoClient: mongoClient,
+	})
+	require.NoError(t, err)
+
+	_, _, err = evaluator.PolicyEvaluation(logging.NewNoOpLogger(), nil)
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Equal(t, []string{"find_one", "OPAEvaluator.PolicyEvaluation"}, testutils.SpanNames(spans))
+	require.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	require.Contains(t, spans[0].Attributes, semconv.DBMongoDBCollection("projects"))
+	require.Contains(t, spans[1].Attributes, attribute.String("rond.policy_name", "allow"))
+	require.Contains(t, spans[1].Attributes, attribute.Bool("rond.partial_evaluation", true))
+	require.Contains(t, spans[1].Attributes, attribute.Bool("rond.allowed", true))
+}
+
+func TestOPAModuleConfigPolicyNames(t *testing.T) {
+	t.Run("returns the rules of the policies package", func(t *testing.T) {
+		config := &OPAModuleConfig{
+			Name: "example.rego",
+			Content: `package policies
+allow { true }
+allow { input.request.method == "GET" }
+filter_projects { data.resources[_].name == "jane" }
+response_policy [response] { response := input.response.body }`,
+		}
+
+		policyNames, err := config.PolicyNames()
+		require.NoError(t, err)
+		require.Equal(t, []string{"allow", "filter_projects", "response_policy"}, policyNames)
+	})
+
+	t.Run("returns no policies for other packages", func(t *testing.T) {
+		config := &OPAModuleConfig{Name: "example.rego", Content: "package other\nallow { true }"}
+
+		policyNames, err := config.PolicyNames()
+		require.NoError(t, err)
+		require.Empty(t, policyNames)
+	})
+
+	t.Run("fails for invalid module", func(t *testing.T) {
+		config := &OPAModuleConfig{Name: "example.rego", Content: "package policies\nallow {"}
+
+		_, err := config.PolicyNames()
+		require.ErrorIs(t, err, ErrRegoModuleParseFailed)
+	})
+}
+
+func TestOPAModuleConfigCheckPolicies(t *testing.T) {
+	config := &OPAModuleConfig{
+		Name: "example.rego",
+		Content: `package policies
+allow { true }
+very_composed_policy { true }
+unused_policy { true }
+called_policy { helper(input.user) }
+helper(user) { user.admin }
+data_policy { data.policies.allowed_groups[_] == input.user.group }
+allowed_groups := ["admin"]
+local_policy { is_owner }
+is_owner { input.user.id == input.resource.owner }`,
+	}
+
+	t.Run("returns missing and unused policies", func(t *testing.T) {
+		missingPolicies, unusedPolicies, err := config.CheckPolicies([]string{"allow", "very.composed.policy", "not_existing", "not_existing", "called_policy", "data_policy", "local_policy"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"not_existing"}, missingPolicies)
+		require.Equal(t, []string{"unused_policy"}, unusedPolicies, "the rules referenced by other rules are not unused")
+	})
+
+	t.Run("fails for invalid module", func(t *testing.T) {
+		_, _, err := (&OPAModuleConfig{Name: "example.rego", Content: "package policies\nallow {"}).CheckPolicies([]string{"allow"})
+		require.ErrorIs(t, err, ErrRegoModuleParseFailed)
 	})
 }
 
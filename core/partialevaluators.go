@@ -17,7 +17,6 @@ package core
 import (
 	"context"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
@@ -104,16 +103,17 @@ func (partialEvaluators PartialResultsEvaluators) GetEvaluatorFromPolicy(ctx con
 
 		evaluator := eval.PartialEvaluator.Rego(
 			rego.ParsedInput(inputTerm.Value),
-			rego.EnablePrintStatements(options.EnablePrintStatements),
-			rego.PrintHook(NewPrintHook(os.Stdout, policy)),
+			rego.PrintHook(NewPrintHook(policy, options.EnablePrintStatements)),
 		)
 
 		return &OPAEvaluator{
 			PolicyName:      policy,
 			PolicyEvaluator: evaluator,
 
-			context:     ctx,
-			mongoClient: options.MongoClient,
+			context:        ctx,
+			mongoClient:    options.MongoClient,
+			rateLimitStore: options.RateLimitStore,
+			logger:         options.Logger,
 		}, nil
 	}
 	return nil, fmt.Errorf("%w: %s", ErrEvaluatorNotFound, policy)
@@ -134,10 +134,17 @@ func newPartialResultEvaluator(ctx context.Context, policy string, opaModuleConf
 		rego.Query(queryString),
 		rego.Module(opaModuleConfig.Name, opaModuleConfig.Content),
 		rego.Unknowns(Unknowns),
-		rego.EnablePrintStatements(evaluatorOptions.EnablePrintStatements),
-		rego.PrintHook(NewPrintHook(os.Stdout, policy)),
+		// Print statements are always compiled, so that their output can be enabled
+		// for single evaluations.
+		rego.EnablePrintStatements(true),
+		rego.PrintHook(NewPrintHook(policy, evaluatorOptions.EnablePrintStatements)),
 		rego.Capabilities(ast.CapabilitiesForThisVersion()),
+		// The rate_limit calls are kept in the partial result also when their arguments
+		// are known, so that every evaluation records its own hit. Inlining can be disabled
+		// only for refs, so the builtin name is passed as the prefix of one.
+		rego.DisableInlining([]string{custom_builtins.RateLimitDecl.Name + "[_]"}),
 		custom_builtins.GetHeaderFunction,
+		custom_builtins.RateLimit,
 	}
 	if evaluatorOptions.MongoClient != nil {
 		ctx = custom_builtins.WithMongoClient(ctx, evaluatorOptions.MongoClient)
@@ -15,44 +15,60 @@
 package core
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"time"
+	"context"
+
+	"github.com/rond-authz/rond/logging"
 
 	"github.com/open-policy-agent/opa/topdown/print"
 )
 
-func NewPrintHook(w io.Writer, policy string) print.Hook {
+type printStatementsKey struct{}
+
+// WithPrintStatements enables the output of the print statements of the policies
+// evaluated with the returned context, also when it is not enabled for all the
+// evaluations with OPAEvaluatorOptions.
+func WithPrintStatements(ctx context.Context) context.Context {
+	return context.WithValue(ctx, printStatementsKey{}, true)
+}
+
+func printStatementsEnabled(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	enabled, _ := ctx.Value(printStatementsKey{}).(bool)
+	return enabled
+}
+
+// NewPrintHook returns the hook writing the output of the print statements of the
+// policy with the logger of the evaluation context. The output is written if enabled
+// for all the evaluations or for the evaluation context with WithPrintStatements.
+func NewPrintHook(policy string, enabled bool) print.Hook {
 	return printHook{
-		w:          w,
 		policyName: policy,
+		enabled:    enabled,
 	}
 }
 
 type printHook struct {
-	w          io.Writer
 	policyName string
+	enabled    bool
 }
 
-type LogPrinter struct {
-	Level      int    `json:"level"`
-	Message    string `json:"msg"`
-	Time       int64  `json:"time"`
-	PolicyName string `json:"policyName"`
-}
+func (h printHook) Print(printContext print.Context, message string) error {
+	if !h.enabled && !printStatementsEnabled(printContext.Context) {
+		return nil
+	}
 
-func (h printHook) Print(_ print.Context, message string) error {
-	structMessage := LogPrinter{
-		Level:      10,
-		Message:    message,
-		Time:       time.Now().UnixNano() / 1000,
-		PolicyName: h.policyName,
+	ctx := printContext.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	fields := map[string]any{
+		"policyName": h.policyName,
 	}
-	msg, err := json.Marshal(structMessage)
-	if err != nil {
-		return err
+	if printContext.Location != nil {
+		fields["location"] = printContext.Location.String()
 	}
-	_, err = fmt.Fprintln(h.w, string(msg))
-	return err
+	logging.FromContext(ctx).WithFields(fields).Info(message)
+	return nil
 }
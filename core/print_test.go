@@ -15,21 +15,69 @@
 package core
 
 import (
-	"bytes"
-	"regexp"
+	"context"
 	"testing"
 
+	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/logging/test"
+
+	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/topdown/print"
 	"github.com/stretchr/testify/require"
 )
 
 func TestPrint(t *testing.T) {
-	var buf bytes.Buffer
-	h := NewPrintHook(&buf, "policy-name")
+	t.Run("writes nothing if not enabled", func(t *testing.T) {
+		log := test.GetLogger()
+		h := NewPrintHook("policy-name", false)
+
+		err := h.Print(print.Context{Context: logging.WithContext(context.Background(), log)}, "the print message")
+		require.NoError(t, err)
+
+		records, err := test.GetRecords(log)
+		require.NoError(t, err)
+		require.Empty(t, records)
+	})
+
+	t.Run("writes with the logger of the evaluation context", func(t *testing.T) {
+		log := test.GetLogger()
+		h := NewPrintHook("policy-name", true)
+
+		err := h.Print(print.Context{
+			Context:  logging.WithContext(context.Background(), log.WithField("requestId", "some-id")),
+			Location: &ast.Location{File: "policy.rego", Row: 3, Col: 2},
+		}, "the print message")
+		require.NoError(t, err)
+
+		records, err := test.GetRecords(log)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, "info", records[0].Level)
+		require.Equal(t, "the print message", records[0].Message)
+		require.Equal(t, map[string]any{
+			"requestId":  "some-id",
+			"policyName": "policy-name",
+			"location":   "policy.rego:3",
+		}, records[0].Fields)
+	})
+
+	t.Run("writes if enabled for the evaluation context", func(t *testing.T) {
+		log := test.GetLogger()
+		h := NewPrintHook("policy-name", false)
+
+		ctx := WithPrintStatements(logging.WithContext(context.Background(), log))
+		err := h.Print(print.Context{Context: ctx}, "the print message")
+		require.NoError(t, err)
+
+		records, err := test.GetRecords(log)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, "the print message", records[0].Message)
+	})
 
-	err := h.Print(print.Context{}, "the print message")
-	require.NoError(t, err)
+	t.Run("does not fail without context", func(t *testing.T) {
+		h := NewPrintHook("policy-name", true)
 
-	var re = regexp.MustCompile(`"time":\d+`)
-	require.JSONEq(t, `{"level":10,"msg":"the print message","time":123,"policyName":"policy-name"}`, string(re.ReplaceAll(buf.Bytes(), []byte("\"time\":123"))))
+		require.NoError(t, h.Print(print.Context{}, "the print message"))
+	})
 }
@@ -15,11 +15,18 @@
 package custom_builtins
 
 import (
+	"context"
 	"fmt"
+	"time"
+
+	"github.com/rond-authz/rond/internal/tracing"
+	"github.com/rond-authz/rond/metrics"
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/open-policy-agent/opa/types"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var MongoFindOneDecl = &ast.Builtin{
@@ -57,7 +64,11 @@ var MongoFindOne = rego.Function2(
 			return nil, err
 		}
 
-		result, err := mongoClient.FindOne(ctx.Context, collectionName, query)
+		queryCtx, span := startQuerySpan(ctx, "find_one", collectionName)
+		queryStart := time.Now()
+		result, err := mongoClient.FindOne(queryCtx, collectionName, query)
+		observeQueryDuration(ctx, "find_one", collectionName, queryStart)
+		tracing.End(span, err)
 		if err != nil {
 			return nil, err
 		}
@@ -106,7 +117,11 @@ var MongoFindMany = rego.Function2(
 			return nil, err
 		}
 
-		result, err := mongoClient.FindMany(ctx.Context, collectionName, query)
+		queryCtx, span := startQuerySpan(ctx, "find_many", collectionName)
+		queryStart := time.Now()
+		result, err := mongoClient.FindMany(queryCtx, collectionName, query)
+		observeQueryDuration(ctx, "find_many", collectionName, queryStart)
+		tracing.End(span, err)
 		if err != nil {
 			return nil, err
 		}
@@ -119,3 +134,18 @@ var MongoFindMany = rego.Function2(
 		return ast.NewTerm(t), nil
 	},
 )
+
+func startQuerySpan(ctx rego.BuiltinContext, operation, collectionName string) (context.Context, trace.Span) {
+	return tracing.Start(ctx.Context, operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.DBSystemMongoDB,
+		semconv.DBOperation(operation),
+		semconv.DBMongoDBCollection(collectionName),
+	))
+}
+
+func observeQueryDuration(ctx rego.BuiltinContext, operation, collectionName string, queryStart time.Time) {
+	metrics.FromContext(ctx.Context).MongoQueryDurationMilliseconds.With(metrics.Labels{
+		"operation":  operation,
+		"collection": collectionName,
+	}).Observe(float64(time.Since(queryStart).Milliseconds()))
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package custom_builtins
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rond-authz/rond/logging"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/types"
+)
+
+// RateLimitStore keeps the hits of the rate limits checked with the rate_limit builtin.
+type RateLimitStore interface {
+	// Take records a hit for the key if less than limit hits have been recorded in
+	// the sliding window ending now. Otherwise, the hit is not recorded and it returns
+	// the time to wait before a new hit is allowed.
+	Take(ctx context.Context, key string, limit int, window time.Duration) (allowed bool, retryAfter time.Duration, err error)
+}
+
+type rateLimitStoreCustomBuiltinContextKey struct{}
+
+func WithRateLimitStore(ctx context.Context, store RateLimitStore) context.Context {
+	return context.WithValue(ctx, rateLimitStoreCustomBuiltinContextKey{}, store)
+}
+
+func GetRateLimitStoreFromContext(ctx context.Context) (RateLimitStore, error) {
+	storeInterface := ctx.Value(rateLimitStoreCustomBuiltinContextKey{})
+	if storeInterface == nil {
+		return nil, nil
+	}
+
+	store, ok := storeInterface.(RateLimitStore)
+	if !ok {
+		return nil, fmt.Errorf("no rate limit store found in context")
+	}
+	return store, nil
+}
+
+// RateLimits collects the rate limits exceeded during a policy evaluation, so that
+// a denied request can be told apart from a rate limited one.
+type RateLimits struct {
+	mu         sync.Mutex
+	exceeded   bool
+	retryAfter time.Duration
+}
+
+type rateLimitsCustomBuiltinContextKey struct{}
+
+// WithRateLimits returns the context collecting the rate limits exceeded by the
+// rate_limit calls evaluated with it.
+func WithRateLimits(ctx context.Context) (context.Context, *RateLimits) {
+	rateLimits := &RateLimits{}
+	return context.WithValue(ctx, rateLimitsCustomBuiltinContextKey{}, rateLimits), rateLimits
+}
+
+// Exceeded returns true if at least a rate limit has been exceeded.
+func (r *RateLimits) Exceeded() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.exceeded
+}
+
+// RetryAfter returns the longest time to wait before the exceeded rate limits
+// allow new hits.
+func (r *RateLimits) RetryAfter() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.retryAfter
+}
+
+func (r *RateLimits) add(retryAfter time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exceeded = true
+	if retryAfter > r.retryAfter {
+		r.retryAfter = retryAfter
+	}
+}
+
+// RateLimitDecl returns true, recording a hit for the key, if less than limit hits
+// have been recorded for the same key in the sliding window (a duration string
+// such as "1h"), otherwise false. Each evaluated call counts as a hit: the key can
+// be built from the input (e.g. the user or the tenant of the request) or be a
+// constant for a quota shared by all the requests.
+var RateLimitDecl = &ast.Builtin{
+	Name: "rate_limit",
+	Decl: types.NewFunction(
+		types.Args(
+			types.S, // key
+			types.N, // limit
+			types.S, // window
+		),
+		types.B, // true if the hit is allowed
+	),
+	Nondeterministic: true,
+}
+
+var RateLimit = rego.Function3(
+	&rego.Function{
+		Name:             RateLimitDecl.Name,
+		Decl:             RateLimitDecl.Decl,
+		Nondeterministic: RateLimitDecl.Nondeterministic,
+	},
+	func(ctx rego.BuiltinContext, keyTerm, limitTerm, windowTerm *ast.Term) (*ast.Term, error) {
+		store, err := GetRateLimitStoreFromContext(ctx.Context)
+		if err != nil {
+			return nil, err
+		}
+		if store == nil {
+			return nil, fmt.Errorf("rate limit store not set")
+		}
+
+		var key string
+		if err := ast.As(keyTerm.Value, &key); err != nil {
+			return nil, err
+		}
+
+		var limit int
+		if err := ast.As(limitTerm.Value, &limit); err != nil {
+			return nil, err
+		}
+
+		var windowString string
+		if err := ast.As(windowTerm.Value, &windowString); err != nil {
+			return nil, err
+		}
+		window, err := time.ParseDuration(windowString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit window: %w", err)
+		}
+		if limit <= 0 || window <= 0 {
+			return nil, fmt.Errorf("rate limit and window must be positive")
+		}
+
+		allowed, retryAfter, err := store.Take(ctx.Context, key, limit, window)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			logging.FromContext(ctx.Context).WithFields(map[string]any{
+				"rateLimitKey": key,
+				"retryAfter":   retryAfter.String(),
+			}).Debug("rate limit exceeded")
+			if rateLimits, ok := ctx.Context.Value(rateLimitsCustomBuiltinContextKey{}).(*RateLimits); ok {
+				rateLimits.add(retryAfter)
+			}
+		}
+		return ast.BooleanTerm(allowed), nil
+	},
+)
@@ -0,0 +1,161 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package custom_builtins
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rond-authz/rond/types"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// inMemoryRateLimitSweepInterval is the minimum interval between the removals of
+// the keys without hits in their window.
+const inMemoryRateLimitSweepInterval = time.Minute
+
+type rateLimitHits struct {
+	window time.Duration
+	hits   []time.Time
+}
+
+// InMemoryRateLimitStore keeps the rate limits hits in memory, so the limits are
+// not shared between different rond instances.
+type InMemoryRateLimitStore struct {
+	mu        sync.Mutex
+	keys      map[string]*rateLimitHits
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewInMemoryRateLimitStore() *InMemoryRateLimitStore {
+	return &InMemoryRateLimitStore{
+		keys: map[string]*rateLimitHits{},
+		now:  time.Now,
+	}
+}
+
+func (s *InMemoryRateLimitStore) Take(_ context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	entry, ok := s.keys[key]
+	if !ok {
+		entry = &rateLimitHits{}
+		s.keys[key] = entry
+	}
+	entry.window = window
+
+	windowStart := now.Add(-window)
+	firstInWindow := 0
+	for firstInWindow < len(entry.hits) && !entry.hits[firstInWindow].After(windowStart) {
+		firstInWindow++
+	}
+	entry.hits = entry.hits[firstInWindow:]
+
+	if len(entry.hits) >= limit {
+		return false, entry.hits[len(entry.hits)-limit].Add(window).Sub(now), nil
+	}
+	entry.hits = append(entry.hits, now)
+	return true, 0, nil
+}
+
+func (s *InMemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < inMemoryRateLimitSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.keys {
+		if len(entry.hits) == 0 || !entry.hits[len(entry.hits)-1].Add(entry.window).After(now) {
+			delete(s.keys, key)
+		}
+	}
+}
+
+type rateLimitHitDocument struct {
+	Key      string    `bson:"key"`
+	HitAt    time.Time `bson:"hitAt"`
+	ExpireAt time.Time `bson:"expireAt"`
+}
+
+// MongoRateLimitStore keeps the rate limits hits in a MongoDB collection, so the
+// limits are shared between different rond instances. Concurrent hits for the
+// same key may exceed the limit by the number of concurrent evaluations.
+type MongoRateLimitStore struct {
+	collection *mongo.Collection
+	now        func() time.Time
+}
+
+// NewMongoRateLimitStore returns the store using the collection, creating the index
+// used to count the hits and the TTL index removing the hits out of their window.
+func NewMongoRateLimitStore(ctx context.Context, mongoClient types.MongoClient, collectionName string) (*MongoRateLimitStore, error) {
+	collection := mongoClient.Collection(collectionName)
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}, {Key: "hitAt", Value: 1}}},
+		{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoRateLimitStore{
+		collection: collection,
+		now:        time.Now,
+	}, nil
+}
+
+func (s *MongoRateLimitStore) Take(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	now := s.now().UTC().Truncate(time.Millisecond)
+	hitsInWindow := bson.M{
+		"key":   key,
+		"hitAt": bson.M{"$gt": now.Add(-window)},
+	}
+
+	count, err := s.collection.CountDocuments(ctx, hitsInWindow)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if count >= int64(limit) {
+		var oldestHit rateLimitHitDocument
+		err := s.collection.FindOne(ctx, hitsInWindow, options.FindOne().
+			SetSort(bson.D{{Key: "hitAt", Value: 1}}).
+			SetSkip(count-int64(limit)),
+		).Decode(&oldestHit)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, 0, nil
+		}
+		if err != nil {
+			return false, 0, err
+		}
+		return false, oldestHit.HitAt.Add(window).Sub(now), nil
+	}
+
+	if _, err := s.collection.InsertOne(ctx, rateLimitHitDocument{
+		Key:      key,
+		HitAt:    now,
+		ExpireAt: now.Add(window),
+	}); err != nil {
+		return false, 0, err
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package custom_builtins
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rond-authz/rond/internal/mongoclient"
+	"github.com/rond-authz/rond/logging"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRateLimitStoreFromContext(t *testing.T) {
+	t.Run("store not found in context", func(t *testing.T) {
+		store, err := GetRateLimitStoreFromContext(context.Background())
+		require.NoError(t, err)
+		require.Nil(t, store)
+	})
+
+	t.Run("store found in context", func(t *testing.T) {
+		inMemoryStore := NewInMemoryRateLimitStore()
+		store, err := GetRateLimitStoreFromContext(WithRateLimitStore(context.Background(), inMemoryStore))
+		require.NoError(t, err)
+		require.Equal(t, inMemoryStore, store)
+	})
+
+	t.Run("throws if store not correctly in context", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), rateLimitStoreCustomBuiltinContextKey{}, "")
+		store, err := GetRateLimitStoreFromContext(ctx)
+		require.EqualError(t, err, "no rate limit store found in context")
+		require.Nil(t, store)
+	})
+}
+
+func TestInMemoryRateLimitStore(t *testing.T) {
+	now := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	store := NewInMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	take := func(t *testing.T, key string) (bool, time.Duration) {
+		t.Helper()
+		allowed, retryAfter, err := store.Take(ctx, key, 2, time.Minute)
+		require.NoError(t, err)
+		return allowed, retryAfter
+	}
+
+	allowed, _ := take(t, "user-1")
+	require.True(t, allowed)
+
+	now = now.Add(20 * time.Second)
+	allowed, _ = take(t, "user-1")
+	require.True(t, allowed)
+
+	allowed, retryAfter := take(t, "user-1")
+	require.False(t, allowed)
+	require.Equal(t, 40*time.Second, retryAfter)
+
+	allowed, _ = take(t, "user-2")
+	require.True(t, allowed, "keys are limited separately")
+
+	now = now.Add(41 * time.Second)
+	allowed, _ = take(t, "user-1")
+	require.True(t, allowed, "the first hit is out of the window")
+
+	allowed, retryAfter = take(t, "user-1")
+	require.False(t, allowed)
+	require.Equal(t, 19*time.Second, retryAfter)
+
+	now = now.Add(2 * time.Minute)
+	_, _ = take(t, "user-3")
+	require.Equal(t, []string{"user-3"}, keys(store))
+}
+
+func TestRateLimit(t *testing.T) {
+	evaluate := func(t *testing.T, ctx context.Context, query string) (bool, error) {
+		t.Helper()
+		results, err := rego.New(
+			rego.Query(query),
+			rego.StrictBuiltinErrors(true),
+			RateLimit,
+		).Eval(ctx)
+		if err != nil {
+			return false, err
+		}
+		require.Len(t, results, 1)
+		return results[0].Expressions[0].Value.(bool), nil
+	}
+
+	t.Run("records the hits in the store", func(t *testing.T) {
+		ctx := WithRateLimitStore(context.Background(), NewInMemoryRateLimitStore())
+
+		ctx, rateLimits := WithRateLimits(ctx)
+		allowed, err := evaluate(t, ctx, `rate_limit("user-1", 1, "1m")`)
+		require.NoError(t, err)
+		require.True(t, allowed)
+		require.False(t, rateLimits.Exceeded())
+
+		ctx, rateLimits = WithRateLimits(ctx)
+		allowed, err = evaluate(t, ctx, `rate_limit("user-1", 1, "1m")`)
+		require.NoError(t, err)
+		require.False(t, allowed)
+		require.True(t, rateLimits.Exceeded())
+		require.Greater(t, rateLimits.RetryAfter(), 59*time.Second)
+	})
+
+	t.Run("throws without store", func(t *testing.T) {
+		_, err := evaluate(t, context.Background(), `rate_limit("user-1", 1, "1m")`)
+		require.ErrorContains(t, err, "rate limit store not set")
+	})
+
+	t.Run("throws with invalid window", func(t *testing.T) {
+		ctx := WithRateLimitStore(context.Background(), NewInMemoryRateLimitStore())
+		_, err := evaluate(t, ctx, `rate_limit("user-1", 1, "one minute")`)
+		require.ErrorContains(t, err, "invalid rate limit window")
+	})
+}
+
+func TestMongoRateLimitStore(t *testing.T) {
+	log := logging.NewNoOpLogger()
+	mongoDBURL, _ := getMongoDBURL(t)
+	client, err := mongoclient.NewMongoClient(log, mongoDBURL, mongoclient.ConnectionOpts{})
+	require.NoError(t, err)
+	defer client.Disconnect()
+
+	store, err := NewMongoRateLimitStore(context.Background(), client, "rate-limits")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		client.Collection("rate-limits").Drop(context.Background())
+	})
+
+	now := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	allowed, _, err := store.Take(context.Background(), "user-1", 1, time.Minute)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	now = now.Add(20 * time.Second)
+	allowed, retryAfter, err := store.Take(context.Background(), "user-1", 1, time.Minute)
+	require.NoError(t, err)
+	require.False(t, allowed)
+	require.Equal(t, 40*time.Second, retryAfter)
+
+	allowed, _, err = store.Take(context.Background(), "user-2", 1, time.Minute)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	now = now.Add(41 * time.Second)
+	allowed, _, err = store.Take(context.Background(), "user-1", 1, time.Minute)
+	require.NoError(t, err)
+	require.True(t, allowed)
+}
+
+func keys(store *InMemoryRateLimitStore) []string {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	keys := []string{}
+	for key := range store.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
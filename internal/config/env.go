@@ -25,19 +25,45 @@ import (
 )
 
 const (
-	apiPermissionsFilePathEnvKey = "API_PERMISSIONS_FILE_PATH"
-	targetServiceOASPathEnvKey   = "TARGET_SERVICE_OAS_PATH"
-	standaloneEnvKey             = "STANDALONE"
-	targetServiceHostEnvKey      = "TARGET_SERVICE_HOST"
-	bindingsCrudServiceURL       = "BINDINGS_CRUD_SERVICE_URL"
+	apiPermissionsFilePathEnvKey     = "API_PERMISSIONS_FILE_PATH"
+	targetServiceOASPathEnvKey       = "TARGET_SERVICE_OAS_PATH"
+	standaloneEnvKey                 = "STANDALONE"
+	targetServiceHostEnvKey          = "TARGET_SERVICE_HOST"
+	bindingsCrudServiceURL           = "BINDINGS_CRUD_SERVICE_URL"
+	extAuthzGRPCPortEnvKey           = "EXT_AUTHZ_GRPC_PORT"
+	forwardAuthEnvKey                = "FORWARD_AUTH"
+	additionalOASSourcesEnvKey       = "ADDITIONAL_OAS_SOURCES"
+	upstreamTargetsEnvKey            = "UPSTREAM_TARGETS"
+	targetServiceSchemeEnvKey        = "TARGET_SERVICE_SCHEME"
+	metricsBackendEnvKey             = "METRICS_BACKEND"
+	logBackendEnvKey                 = "LOG_BACKEND"
+	mongoDBURLEnvKey                 = "MONGODB_URL"
+	rateLimitCollectionNameEnvKey    = "RATE_LIMIT_COLLECTION_NAME"
+	targetServiceTLSServerNameEnvKey = "TARGET_SERVICE_TLS_SERVER_NAME"
+	printStatementsHeaderEnvKey      = "PRINT_STATEMENTS_HEADER"
+	printStatementsGroupEnvKey       = "PRINT_STATEMENTS_GROUP"
 
 	traceLogLevel = "trace"
 )
 
+// Backends allowed for the LOG_BACKEND environment variable.
+const (
+	LogBackendLogrus = "logrus"
+	LogBackendSlog   = "slog"
+)
+
+// Backends allowed for the METRICS_BACKEND environment variable.
+const (
+	MetricsBackendPrometheus = "prometheus"
+	MetricsBackendOTel       = "otel"
+	MetricsBackendBoth       = "both"
+)
+
 // EnvironmentVariables struct with the mapping of desired
 // environment variables.
 type EnvironmentVariables struct {
 	LogLevel                       string
+	LogBackend                     string
 	HTTPPort                       string
 	ServiceVersion                 string
 	TargetServiceHost              string
@@ -49,6 +75,7 @@ type EnvironmentVariables struct {
 	UserIdHeader                   string
 	ClientTypeHeader               string
 	BindingsCrudServiceURL         string
+	RolesCrudServiceURL            string
 	MongoDBUrl                     string
 	MongoDBConnectionMaxIdleTimeMs int
 	RolesCollectionName            string
@@ -58,6 +85,35 @@ type EnvironmentVariables struct {
 	Standalone                     bool
 	AdditionalHeadersToProxy       string
 	ExposeMetrics                  bool
+	SimulationAdminGroup           string
+	ExtAuthzGRPCPort               string
+	ForwardAuth                    bool
+	StrictOASValidation            bool
+	AdditionalOASSources           string
+	UpstreamTargets                string
+	TargetServiceScheme            string
+	TargetServiceCAFile            string
+	TargetServiceClientCertFile    string
+	TargetServiceClientKeyFile     string
+	TargetServiceTLSServerName     string
+	TLSCertFile                    string
+	TLSKeyFile                     string
+	TLSClientCAFile                string
+	TracingOTLPEndpoint            string
+	TracingOTLPInsecure            bool
+	MetricsBackend                 string
+	MetricsOTLPEndpoint            string
+	MetricsOTLPInsecure            bool
+	PrintStatementsHeader          string
+	PrintStatementsGroup           string
+	RateLimitCollectionName        string
+
+	TargetServiceDialTimeoutMs           int
+	TargetServiceResponseHeaderTimeoutMs int
+	TargetServiceIdleConnTimeoutMs       int
+	TargetServiceMaxRetries              int
+	CircuitBreakerFailureThreshold       int
+	CircuitBreakerOpenTimeoutMs          int
 }
 
 var EnvVariablesConfig = []configlib.EnvConfig{
@@ -66,6 +122,11 @@ var EnvVariablesConfig = []configlib.EnvConfig{
 		Variable:     "LogLevel",
 		DefaultValue: "info",
 	},
+	{
+		Key:          logBackendEnvKey,
+		Variable:     "LogBackend",
+		DefaultValue: LogBackendLogrus,
+	},
 	{
 		Key:          "HTTP_PORT",
 		Variable:     "HTTPPort",
@@ -119,7 +180,7 @@ var EnvVariablesConfig = []configlib.EnvConfig{
 		DefaultValue: "10",
 	},
 	{
-		Key:      "MONGODB_URL",
+		Key:      mongoDBURLEnvKey,
 		Variable: "MongoDBUrl",
 	},
 	{
@@ -148,6 +209,10 @@ var EnvVariablesConfig = []configlib.EnvConfig{
 		Key:      bindingsCrudServiceURL,
 		Variable: "BindingsCrudServiceURL",
 	},
+	{
+		Key:      "ROLES_CRUD_SERVICE_URL",
+		Variable: "RolesCrudServiceURL",
+	},
 	{
 		Key:          "ADDITIONAL_HEADERS_TO_PROXY",
 		Variable:     "AdditionalHeadersToProxy",
@@ -158,6 +223,121 @@ var EnvVariablesConfig = []configlib.EnvConfig{
 		Variable:     "ExposeMetrics",
 		DefaultValue: "true",
 	},
+	{
+		Key:      "SIMULATION_ADMIN_GROUP",
+		Variable: "SimulationAdminGroup",
+	},
+	{
+		Key:      extAuthzGRPCPortEnvKey,
+		Variable: "ExtAuthzGRPCPort",
+	},
+	{
+		Key:      forwardAuthEnvKey,
+		Variable: "ForwardAuth",
+	},
+	{
+		Key:      "STRICT_OAS_VALIDATION",
+		Variable: "StrictOASValidation",
+	},
+	{
+		Key:      additionalOASSourcesEnvKey,
+		Variable: "AdditionalOASSources",
+	},
+	{
+		Key:      upstreamTargetsEnvKey,
+		Variable: "UpstreamTargets",
+	},
+	{
+		Key:          targetServiceSchemeEnvKey,
+		Variable:     "TargetServiceScheme",
+		DefaultValue: "http",
+	},
+	{
+		Key:      "TARGET_SERVICE_CA_FILE",
+		Variable: "TargetServiceCAFile",
+	},
+	{
+		Key:      "TARGET_SERVICE_CLIENT_CERT_FILE",
+		Variable: "TargetServiceClientCertFile",
+	},
+	{
+		Key:      "TARGET_SERVICE_CLIENT_KEY_FILE",
+		Variable: "TargetServiceClientKeyFile",
+	},
+	{
+		Key:      targetServiceTLSServerNameEnvKey,
+		Variable: "TargetServiceTLSServerName",
+	},
+	{
+		Key:      "TLS_CERT_FILE",
+		Variable: "TLSCertFile",
+	},
+	{
+		Key:      "TLS_KEY_FILE",
+		Variable: "TLSKeyFile",
+	},
+	{
+		Key:      "TLS_CLIENT_CA_FILE",
+		Variable: "TLSClientCAFile",
+	},
+	{
+		Key:      "TARGET_SERVICE_DIAL_TIMEOUT_MS",
+		Variable: "TargetServiceDialTimeoutMs",
+	},
+	{
+		Key:      "TARGET_SERVICE_RESPONSE_HEADER_TIMEOUT_MS",
+		Variable: "TargetServiceResponseHeaderTimeoutMs",
+	},
+	{
+		Key:      "TARGET_SERVICE_IDLE_CONN_TIMEOUT_MS",
+		Variable: "TargetServiceIdleConnTimeoutMs",
+	},
+	{
+		Key:      "TARGET_SERVICE_MAX_RETRIES",
+		Variable: "TargetServiceMaxRetries",
+	},
+	{
+		Key:      "CIRCUIT_BREAKER_FAILURE_THRESHOLD",
+		Variable: "CircuitBreakerFailureThreshold",
+	},
+	{
+		Key:          "CIRCUIT_BREAKER_OPEN_TIMEOUT_MS",
+		Variable:     "CircuitBreakerOpenTimeoutMs",
+		DefaultValue: "30000",
+	},
+	{
+		Key:      "TRACING_OTLP_ENDPOINT",
+		Variable: "TracingOTLPEndpoint",
+	},
+	{
+		Key:      "TRACING_OTLP_INSECURE",
+		Variable: "TracingOTLPInsecure",
+	},
+	{
+		Key:          metricsBackendEnvKey,
+		Variable:     "MetricsBackend",
+		DefaultValue: MetricsBackendPrometheus,
+	},
+	{
+		Key:      "METRICS_OTLP_ENDPOINT",
+		Variable: "MetricsOTLPEndpoint",
+	},
+	{
+		Key:      "METRICS_OTLP_INSECURE",
+		Variable: "MetricsOTLPInsecure",
+	},
+	{
+		Key:      printStatementsHeaderEnvKey,
+		Variable: "PrintStatementsHeader",
+	},
+	{
+		Key:      printStatementsGroupEnvKey,
+		Variable: "PrintStatementsGroup",
+	},
+	{
+		Key:      rateLimitCollectionNameEnvKey,
+		Variable: "RateLimitCollectionName",
+	},
 }
 
 type EnvKey struct{}
@@ -189,16 +369,58 @@ func GetEnvOrDie() EnvironmentVariables {
 		panic(err.Error())
 	}
 
-	if env.TargetServiceHost == "" && !env.Standalone {
-		panic(fmt.Errorf("missing environment variables, one of %s or %s set to true is required", targetServiceHostEnvKey, standaloneEnvKey))
+	if env.TargetServiceHost == "" && env.UpstreamTargets == "" && !env.Standalone && env.ExtAuthzGRPCPort == "" && !env.ForwardAuth {
+		panic(fmt.Errorf("missing environment variables, one of %s, %s, %s set to true, %s or %s set to true is required", targetServiceHostEnvKey, upstreamTargetsEnvKey, standaloneEnvKey, extAuthzGRPCPortEnvKey, forwardAuthEnvKey))
+	}
+
+	if _, err := env.GetUpstreamTargets(); err != nil {
+		panic(err)
+	}
+
+	// The server name would be verified against every upstream target host.
+	if env.TargetServiceTLSServerName != "" && env.UpstreamTargets != "" {
+		panic(fmt.Errorf("invalid environment variables, %s cannot be used with %s", targetServiceTLSServerNameEnvKey, upstreamTargetsEnvKey))
+	}
+
+	if env.TargetServiceScheme != "http" && env.TargetServiceScheme != "https" {
+		panic(fmt.Errorf("invalid environment variables, %s must be either http or https", targetServiceSchemeEnvKey))
+	}
+
+	if env.LogBackend != LogBackendLogrus && env.LogBackend != LogBackendSlog {
+		panic(fmt.Errorf("invalid environment variables, %s must be either %s or %s", logBackendEnvKey, LogBackendLogrus, LogBackendSlog))
+	}
+
+	if env.MetricsBackend != MetricsBackendPrometheus && env.MetricsBackend != MetricsBackendOTel && env.MetricsBackend != MetricsBackendBoth {
+		panic(fmt.Errorf("invalid environment variables, %s must be one of %s, %s or %s", metricsBackendEnvKey, MetricsBackendPrometheus, MetricsBackendOTel, MetricsBackendBoth))
+	}
+
+	if (env.TargetServiceClientCertFile == "") != (env.TargetServiceClientKeyFile == "") {
+		panic(fmt.Errorf("invalid environment variables, TARGET_SERVICE_CLIENT_CERT_FILE and TARGET_SERVICE_CLIENT_KEY_FILE must be set together"))
+	}
+
+	if (env.TLSCertFile == "") != (env.TLSKeyFile == "") {
+		panic(fmt.Errorf("invalid environment variables, TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+
+	if env.TLSClientCAFile != "" && env.TLSCertFile == "" {
+		panic(fmt.Errorf("invalid environment variables, TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE"))
+	}
+
+	// the print statements output can be large and expose the policies data
+	if env.PrintStatementsHeader != "" && env.PrintStatementsGroup == "" {
+		panic(fmt.Errorf("missing environment variables, %s must be set to use %s", printStatementsGroupEnvKey, printStatementsHeaderEnvKey))
+	}
+
+	if env.RateLimitCollectionName != "" && env.MongoDBUrl == "" {
+		panic(fmt.Errorf("missing environment variables, %s must be set to use %s", mongoDBURLEnvKey, rateLimitCollectionNameEnvKey))
 	}
 
 	if env.Standalone && env.BindingsCrudServiceURL == "" {
 		panic(fmt.Errorf("missing environment variables, %s must be set if mode is standalone", bindingsCrudServiceURL))
 	}
 
-	if env.APIPermissionsFilePath == "" && env.TargetServiceOASPath == "" {
-		panic(fmt.Errorf("missing environment variables, one of %s or %s is required", apiPermissionsFilePathEnvKey, targetServiceOASPathEnvKey))
+	if env.APIPermissionsFilePath == "" && env.TargetServiceOASPath == "" && env.AdditionalOASSources == "" && !env.hasUpstreamOAS() {
+		panic(fmt.Errorf("missing environment variables, one of %s, %s, %s or an %s OAS path is required", apiPermissionsFilePathEnvKey, targetServiceOASPathEnvKey, additionalOASSourcesEnvKey, upstreamTargetsEnvKey))
 	}
 
 	return env
@@ -226,6 +448,21 @@ func (env EnvironmentVariables) GetAdditionalHeadersToProxy() []string {
 	return customHeaders
 }
 
+// PrintStatementsRequested tells if the request enables the output of the policies
+// print statements, setting to true the header configured with PRINT_STATEMENTS_HEADER.
+// The header is accepted only from the users of the PRINT_STATEMENTS_GROUP group.
+func (env EnvironmentVariables) PrintStatementsRequested(req *http.Request) bool {
+	if env.PrintStatementsHeader == "" || env.PrintStatementsGroup == "" || req.Header.Get(env.PrintStatementsHeader) != "true" {
+		return false
+	}
+	for _, group := range strings.Split(req.Header.Get(env.UserGroupsHeader), ",") {
+		if strings.TrimSpace(group) == env.PrintStatementsGroup {
+			return true
+		}
+	}
+	return false
+}
+
 func (env EnvironmentVariables) IsTraceLogLevel() bool {
 	return env.LogLevel == traceLogLevel
 }
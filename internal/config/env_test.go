@@ -69,6 +69,7 @@ func TestGetEnvOrDie(t *testing.T) {
 	}
 	defaultAndRequiredEnvironmentVariables := EnvironmentVariables{
 		LogLevel:             "info",
+		LogBackend:           "logrus",
 		HTTPPort:             "8080",
 		UserPropertiesHeader: "miauserproperties",
 		UserGroupsHeader:     "miausergroups",
@@ -83,6 +84,9 @@ func TestGetEnvOrDie(t *testing.T) {
 		AdditionalHeadersToProxy:       "miauserid",
 		ExposeMetrics:                  true,
 		MongoDBConnectionMaxIdleTimeMs: 1000,
+		TargetServiceScheme:            "http",
+		CircuitBreakerOpenTimeoutMs:    30000,
+		MetricsBackend:                 "prometheus",
 	}
 
 	t.Run(`returns correctly - with TargetServiceHost`, func(t *testing.T) {
@@ -142,7 +146,7 @@ func TestGetEnvOrDie(t *testing.T) {
 		envs := append(requiredEnvs, otherEnvs...)
 		setEnvs(t, envs)
 
-		require.PanicsWithError(t, fmt.Sprintf("missing environment variables, one of %s or %s set to true is required", targetServiceHostEnvKey, standaloneEnvKey), func() {
+		require.PanicsWithError(t, fmt.Sprintf("missing environment variables, one of %s, %s, %s set to true, %s or %s set to true is required", targetServiceHostEnvKey, upstreamTargetsEnvKey, standaloneEnvKey, extAuthzGRPCPortEnvKey, forwardAuthEnvKey), func() {
 			GetEnvOrDie()
 		}, "Unexpected envs variables.")
 	})
@@ -154,7 +158,7 @@ func TestGetEnvOrDie(t *testing.T) {
 		envs := append(requiredEnvs, otherEnvs...)
 		setEnvs(t, envs)
 
-		require.PanicsWithError(t, fmt.Sprintf("missing environment variables, one of %s or %s set to true is required", targetServiceHostEnvKey, standaloneEnvKey), func() {
+		require.PanicsWithError(t, fmt.Sprintf("missing environment variables, one of %s, %s, %s set to true, %s or %s set to true is required", targetServiceHostEnvKey, upstreamTargetsEnvKey, standaloneEnvKey, extAuthzGRPCPortEnvKey, forwardAuthEnvKey), func() {
 			GetEnvOrDie()
 		}, "Unexpected envs variables.")
 	})
@@ -166,11 +170,81 @@ func TestGetEnvOrDie(t *testing.T) {
 		envs := append(requiredEnvs, otherEnvs...)
 		setEnvs(t, envs)
 
-		require.PanicsWithError(t, fmt.Sprintf("missing environment variables, one of %s or %s is required", apiPermissionsFilePathEnvKey, targetServiceOASPathEnvKey), func() {
+		require.PanicsWithError(t, fmt.Sprintf("missing environment variables, one of %s, %s, %s or an %s OAS path is required", apiPermissionsFilePathEnvKey, targetServiceOASPathEnvKey, additionalOASSourcesEnvKey, upstreamTargetsEnvKey), func() {
 			GetEnvOrDie()
 		}, "Unexpected envs variables.")
 	})
 
+	t.Run(`throws - with invalid LogBackend`, func(t *testing.T) {
+		otherEnvs := []env{
+			{name: "TARGET_SERVICE_HOST", value: "http://localhost:3000"},
+			{name: apiPermissionsFilePathEnvKey, value: "/oas"},
+			{name: logBackendEnvKey, value: "zerolog"},
+		}
+		envs := append(requiredEnvs, otherEnvs...)
+		setEnvs(t, envs)
+
+		require.PanicsWithError(t, fmt.Sprintf("invalid environment variables, %s must be either logrus or slog", logBackendEnvKey), func() {
+			GetEnvOrDie()
+		})
+	})
+
+	t.Run(`throws - with invalid MetricsBackend`, func(t *testing.T) {
+		otherEnvs := []env{
+			{name: "TARGET_SERVICE_HOST", value: "http://localhost:3000"},
+			{name: apiPermissionsFilePathEnvKey, value: "/oas"},
+			{name: metricsBackendEnvKey, value: "statsd"},
+		}
+		envs := append(requiredEnvs, otherEnvs...)
+		setEnvs(t, envs)
+
+		require.PanicsWithError(t, fmt.Sprintf("invalid environment variables, %s must be one of prometheus, otel or both", metricsBackendEnvKey), func() {
+			GetEnvOrDie()
+		})
+	})
+
+	t.Run(`throws - with RateLimitCollectionName and not MongoDBUrl`, func(t *testing.T) {
+		otherEnvs := []env{
+			{name: "TARGET_SERVICE_HOST", value: "http://localhost:3000"},
+			{name: apiPermissionsFilePathEnvKey, value: "/oas"},
+			{name: rateLimitCollectionNameEnvKey, value: "rate-limits"},
+		}
+		envs := append(requiredEnvs, otherEnvs...)
+		setEnvs(t, envs)
+
+		require.PanicsWithError(t, fmt.Sprintf("missing environment variables, %s must be set to use %s", mongoDBURLEnvKey, rateLimitCollectionNameEnvKey), func() {
+			GetEnvOrDie()
+		})
+	})
+
+	t.Run(`throws - with TargetServiceTLSServerName and UpstreamTargets`, func(t *testing.T) {
+		otherEnvs := []env{
+			{name: upstreamTargetsEnvKey, value: "/api=https://api:8443"},
+			{name: apiPermissionsFilePathEnvKey, value: "/oas"},
+			{name: targetServiceTLSServerNameEnvKey, value: "api.internal"},
+		}
+		envs := append(requiredEnvs, otherEnvs...)
+		setEnvs(t, envs)
+
+		require.PanicsWithError(t, fmt.Sprintf("invalid environment variables, %s cannot be used with %s", targetServiceTLSServerNameEnvKey, upstreamTargetsEnvKey), func() {
+			GetEnvOrDie()
+		})
+	})
+
+	t.Run(`throws - with PrintStatementsHeader and not PrintStatementsGroup`, func(t *testing.T) {
+		otherEnvs := []env{
+			{name: "TARGET_SERVICE_HOST", value: "http://localhost:3000"},
+			{name: apiPermissionsFilePathEnvKey, value: "/oas"},
+			{name: printStatementsHeaderEnvKey, value: "x-rond-print"},
+		}
+		envs := append(requiredEnvs, otherEnvs...)
+		setEnvs(t, envs)
+
+		require.PanicsWithError(t, fmt.Sprintf("missing environment variables, %s must be set to use %s", printStatementsGroupEnvKey, printStatementsHeaderEnvKey), func() {
+			GetEnvOrDie()
+		})
+	})
+
 	t.Run(`returns correctly - TargetServiceOASPath set`, func(t *testing.T) {
 		otherEnvs := []env{
 			{name: "TARGET_SERVICE_HOST", value: "http://localhost:3000"},
@@ -260,3 +334,42 @@ func TestIsTraceLogLevel(t *testing.T) {
 		require.False(t, env.IsTraceLogLevel())
 	})
 }
+
+func TestPrintStatementsRequested(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("x-rond-print", "true")
+	req.Header.Set("miausergroups", "developers, rond-debug")
+
+	env := EnvironmentVariables{
+		PrintStatementsHeader: "x-rond-print",
+		PrintStatementsGroup:  "rond-debug",
+		UserGroupsHeader:      "miausergroups",
+	}
+
+	t.Run("true if the configured header is true for a user of the group", func(t *testing.T) {
+		require.True(t, env.PrintStatementsRequested(req))
+	})
+
+	t.Run("false if the user is not in the group", func(t *testing.T) {
+		req := req.Clone(req.Context())
+		req.Header.Set("miausergroups", "developers")
+		require.False(t, env.PrintStatementsRequested(req))
+	})
+
+	t.Run("false if the configured header is not true", func(t *testing.T) {
+		env := env
+		env.PrintStatementsHeader = "x-other-header"
+		require.False(t, env.PrintStatementsRequested(req))
+	})
+
+	t.Run("false if no group is configured", func(t *testing.T) {
+		env := env
+		env.PrintStatementsGroup = ""
+		require.False(t, env.PrintStatementsRequested(req))
+	})
+
+	t.Run("false if no header is configured", func(t *testing.T) {
+		env := EnvironmentVariables{}
+		require.False(t, env.PrintStatementsRequested(req))
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rond-authz/rond/internal/utils"
+)
+
+var ErrInvalidTLSConfig = errors.New("invalid TLS configuration")
+
+// GetTargetServiceTLSConfig returns the TLS configuration used to connect to the
+// target service, or nil if no TLS option is set and the system defaults apply.
+// The CA and the client certificate are shared by the upstream targets, while the
+// server name can only be set with a single target service.
+func (env EnvironmentVariables) GetTargetServiceTLSConfig() (*tls.Config, error) {
+	if env.TargetServiceCAFile == "" && env.TargetServiceClientCertFile == "" && env.TargetServiceTLSServerName == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: env.TargetServiceTLSServerName,
+	}
+
+	if env.TargetServiceCAFile != "" {
+		caBundle, err := utils.ReadFile(env.TargetServiceCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTLSConfig, err.Error())
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("%w: no certificate found in CA file %s", ErrInvalidTLSConfig, env.TargetServiceCAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if env.TargetServiceClientCertFile != "" || env.TargetServiceClientKeyFile != "" {
+		clientCertificate, err := tls.LoadX509KeyPair(env.TargetServiceClientCertFile, env.TargetServiceClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTLSConfig, err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCertificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// NewTargetServiceTransport returns the transport used for the requests to the
+// target service, both for proxied traffic and OAS fetching. The timeouts not
+// set keep the http.DefaultTransport values. It returns a nil transport if no
+// option is set, meaning that http.DefaultTransport is used.
+func (env EnvironmentVariables) NewTargetServiceTransport() (http.RoundTripper, error) {
+	tlsConfig, err := env.GetTargetServiceTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil && env.TargetServiceDialTimeoutMs == 0 && env.TargetServiceResponseHeaderTimeoutMs == 0 && env.TargetServiceIdleConnTimeoutMs == 0 {
+		return nil, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if env.TargetServiceDialTimeoutMs > 0 {
+		dialer := &net.Dialer{
+			Timeout:   time.Duration(env.TargetServiceDialTimeoutMs) * time.Millisecond,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	if env.TargetServiceResponseHeaderTimeoutMs > 0 {
+		transport.ResponseHeaderTimeout = time.Duration(env.TargetServiceResponseHeaderTimeoutMs) * time.Millisecond
+	}
+	if env.TargetServiceIdleConnTimeoutMs > 0 {
+		transport.IdleConnTimeout = time.Duration(env.TargetServiceIdleConnTimeoutMs) * time.Millisecond
+	}
+	return transport, nil
+}
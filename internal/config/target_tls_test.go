@@ -0,0 +1,112 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rond-authz/rond/internal/testutils"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTargetServiceTransport(t *testing.T) {
+	certs := testutils.GenerateTLSCertificates(t)
+
+	newMTLSServer := func(t *testing.T) *httptest.Server {
+		t.Helper()
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, testutils.TLSClientCommonName, r.TLS.PeerCertificates[0].Subject.CommonName)
+			w.WriteHeader(http.StatusOK)
+		}))
+		server.TLS = &tls.Config{
+			Certificates: []tls.Certificate{certs.ServerCertificate},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    certs.CAPool,
+		}
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	t.Run("returns no transport without options", func(t *testing.T) {
+		transport, err := EnvironmentVariables{}.NewTargetServiceTransport()
+		require.NoError(t, err)
+		require.Nil(t, transport)
+	})
+
+	t.Run("connects with client certificate verifying the server with the CA bundle", func(t *testing.T) {
+		server := newMTLSServer(t)
+
+		transport, err := EnvironmentVariables{
+			TargetServiceCAFile:         certs.CAFile,
+			TargetServiceClientCertFile: certs.ClientCertFile,
+			TargetServiceClientKeyFile:  certs.ClientKeyFile,
+			TargetServiceTLSServerName:  testutils.TLSServerName,
+		}.NewTargetServiceTransport()
+		require.NoError(t, err)
+
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("fails the handshake without client certificate", func(t *testing.T) {
+		server := newMTLSServer(t)
+
+		transport, err := EnvironmentVariables{
+			TargetServiceCAFile: certs.CAFile,
+		}.NewTargetServiceTransport()
+		require.NoError(t, err)
+
+		_, err = (&http.Client{Transport: transport}).Get(server.URL)
+		require.Error(t, err)
+	})
+
+	t.Run("fails the handshake if the server name does not match", func(t *testing.T) {
+		server := newMTLSServer(t)
+
+		transport, err := EnvironmentVariables{
+			TargetServiceCAFile:         certs.CAFile,
+			TargetServiceClientCertFile: certs.ClientCertFile,
+			TargetServiceClientKeyFile:  certs.ClientKeyFile,
+			TargetServiceTLSServerName:  "other.test",
+		}.NewTargetServiceTransport()
+		require.NoError(t, err)
+
+		_, err = (&http.Client{Transport: transport}).Get(server.URL)
+		require.Error(t, err)
+	})
+
+	t.Run("fails with invalid CA bundle", func(t *testing.T) {
+		_, err := EnvironmentVariables{TargetServiceCAFile: certs.ClientKeyFile}.NewTargetServiceTransport()
+		require.ErrorIs(t, err, ErrInvalidTLSConfig)
+
+		_, err = EnvironmentVariables{TargetServiceCAFile: "./not-existing.crt"}.NewTargetServiceTransport()
+		require.ErrorIs(t, err, ErrInvalidTLSConfig)
+	})
+
+	t.Run("fails with invalid client key pair", func(t *testing.T) {
+		_, err := EnvironmentVariables{
+			TargetServiceClientCertFile: certs.ClientCertFile,
+			TargetServiceClientKeyFile:  certs.ServerKeyFile,
+		}.NewTargetServiceTransport()
+		require.ErrorIs(t, err, ErrInvalidTLSConfig)
+	})
+}
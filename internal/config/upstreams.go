@@ -0,0 +1,142 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidUpstreamTarget = errors.New("invalid upstream target")
+
+// UpstreamTarget is a service the requests whose path starts with PathPrefix are
+// proxied to. The PathPrefix is replaced with the URL path, if any.
+type UpstreamTarget struct {
+	PathPrefix string
+	URL        *url.URL
+	// OASPath is the path, relative to URL, where the upstream exposes its OAS.
+	OASPath string
+}
+
+// ParseUpstreamTargets parses a comma separated list of upstream targets in the form
+// <pathPrefix>=<scheme>://<host>[<basePath>][;<oasPath>],
+// e.g. "/orders=http://orders/api;/documentation/json,/payments=https://payments".
+// The targets are sorted so that the longest path prefixes come first.
+func ParseUpstreamTargets(targets string) ([]UpstreamTarget, error) {
+	upstreamTargets := []UpstreamTarget{}
+	for _, target := range strings.Split(targets, ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+
+		pathPrefix, location, found := strings.Cut(target, "=")
+		if !found || !strings.HasPrefix(pathPrefix, "/") {
+			return nil, fmt.Errorf("%w: %s must start with a path prefix", ErrInvalidUpstreamTarget, target)
+		}
+		location, oasPath, _ := strings.Cut(location, ";")
+
+		targetURL, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidUpstreamTarget, err.Error())
+		}
+		if (targetURL.Scheme != "http" && targetURL.Scheme != "https") || targetURL.Host == "" {
+			return nil, fmt.Errorf("%w: %s must be an http(s) URL", ErrInvalidUpstreamTarget, location)
+		}
+		if oasPath != "" && !strings.HasPrefix(oasPath, "/") {
+			return nil, fmt.Errorf("%w: OAS path %s must start with /", ErrInvalidUpstreamTarget, oasPath)
+		}
+
+		upstreamTargets = append(upstreamTargets, UpstreamTarget{
+			PathPrefix: strings.TrimSuffix(pathPrefix, "/"),
+			URL:        targetURL,
+			OASPath:    oasPath,
+		})
+	}
+
+	sort.SliceStable(upstreamTargets, func(i, j int) bool {
+		return len(upstreamTargets[i].PathPrefix) > len(upstreamTargets[j].PathPrefix)
+	})
+	return upstreamTargets, nil
+}
+
+// Matches reports whether the path is under the upstream path prefix.
+func (u UpstreamTarget) Matches(path string) bool {
+	if !strings.HasPrefix(path, u.PathPrefix) {
+		return false
+	}
+	rest := path[len(u.PathPrefix):]
+	return rest == "" || strings.HasPrefix(rest, "/")
+}
+
+// StripPrefix returns the path to request to the upstream, relative to its URL.
+func (u UpstreamTarget) StripPrefix(path string) string {
+	stripped := strings.TrimPrefix(path, u.PathPrefix)
+	if !strings.HasPrefix(stripped, "/") {
+		stripped = "/" + stripped
+	}
+	return stripped
+}
+
+// OASURL returns the URL of the upstream OAS, or an empty string if the upstream
+// has no OASPath.
+func (u UpstreamTarget) OASURL() string {
+	if u.OASPath == "" {
+		return ""
+	}
+	return strings.TrimSuffix(u.URL.String(), "/") + u.OASPath
+}
+
+// FindUpstreamTarget returns the upstream target with the longest path prefix
+// matching the path.
+func FindUpstreamTarget(upstreamTargets []UpstreamTarget, path string) (UpstreamTarget, bool) {
+	for _, upstreamTarget := range upstreamTargets {
+		if upstreamTarget.Matches(path) {
+			return upstreamTarget, true
+		}
+	}
+	return UpstreamTarget{}, false
+}
+
+// GetUpstreamTargets returns the upstream targets configured with the UPSTREAM_TARGETS
+// environment variable.
+func (env EnvironmentVariables) GetUpstreamTargets() ([]UpstreamTarget, error) {
+	if env.UpstreamTargets == "" {
+		return []UpstreamTarget{}, nil
+	}
+	return ParseUpstreamTargets(env.UpstreamTargets)
+}
+
+// HasProxyTarget returns true if the requests can be proxied, either to the target
+// service or to an upstream target.
+func (env EnvironmentVariables) HasProxyTarget() bool {
+	return env.TargetServiceHost != "" || env.UpstreamTargets != ""
+}
+
+func (env EnvironmentVariables) hasUpstreamOAS() bool {
+	upstreamTargets, err := env.GetUpstreamTargets()
+	if err != nil {
+		return false
+	}
+	for _, upstreamTarget := range upstreamTargets {
+		if upstreamTarget.OASPath != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUpstreamTargets(t *testing.T) {
+	t.Run("parses targets sorted by path prefix length", func(t *testing.T) {
+		targets, err := ParseUpstreamTargets("/orders=http://orders/api;/documentation/json, /orders/archive/=https://archive,,")
+		require.NoError(t, err)
+		require.Equal(t, []UpstreamTarget{
+			{PathPrefix: "/orders/archive", URL: &url.URL{Scheme: "https", Host: "archive"}},
+			{PathPrefix: "/orders", URL: &url.URL{Scheme: "http", Host: "orders", Path: "/api"}, OASPath: "/documentation/json"},
+		}, targets)
+	})
+
+	t.Run("returns no targets for empty string", func(t *testing.T) {
+		targets, err := ParseUpstreamTargets("")
+		require.NoError(t, err)
+		require.Empty(t, targets)
+	})
+
+	for name, targets := range map[string]string{
+		"missing path prefix":  "http://orders",
+		"relative path prefix": "orders=http://orders",
+		"missing scheme":       "/orders=orders:8080",
+		"unsupported scheme":   "/orders=ftp://orders",
+		"relative OAS path":    "/orders=http://orders;documentation",
+	} {
+		t.Run("fails for "+name, func(t *testing.T) {
+			_, err := ParseUpstreamTargets(targets)
+			require.ErrorIs(t, err, ErrInvalidUpstreamTarget)
+		})
+	}
+}
+
+func TestFindUpstreamTarget(t *testing.T) {
+	targets, err := ParseUpstreamTargets("/orders=http://orders/api;/documentation/json,/orders/archive=http://archive")
+	require.NoError(t, err)
+
+	t.Run("finds the target with the longest matching prefix", func(t *testing.T) {
+		target, found := FindUpstreamTarget(targets, "/orders/archive/1")
+		require.True(t, found)
+		require.Equal(t, "archive", target.URL.Host)
+		require.Equal(t, "/1", target.StripPrefix("/orders/archive/1"))
+
+		target, found = FindUpstreamTarget(targets, "/orders")
+		require.True(t, found)
+		require.Equal(t, "orders", target.URL.Host)
+		require.Equal(t, "/", target.StripPrefix("/orders"))
+		require.Equal(t, "http://orders/api/documentation/json", target.OASURL())
+	})
+
+	t.Run("matches only whole path segments", func(t *testing.T) {
+		_, found := FindUpstreamTarget(targets, "/orders-legacy/1")
+		require.False(t, found)
+	})
+}
+
+func TestGetEnvOrDieWithUpstreamTargets(t *testing.T) {
+	t.Run("upstream targets replace target service host and OAS path", func(t *testing.T) {
+		setEnvs(t, []env{
+			{name: "OPA_MODULES_DIRECTORY", value: "/modules"},
+			{name: upstreamTargetsEnvKey, value: "/orders=http://orders;/documentation/json"},
+		})
+
+		env := GetEnvOrDie()
+		require.Equal(t, "/orders=http://orders;/documentation/json", env.UpstreamTargets)
+	})
+
+	t.Run("throws with invalid upstream targets", func(t *testing.T) {
+		setEnvs(t, []env{
+			{name: "OPA_MODULES_DIRECTORY", value: "/modules"},
+			{name: apiPermissionsFilePathEnvKey, value: "/oas"},
+			{name: upstreamTargetsEnvKey, value: "/orders=orders"},
+		})
+
+		require.Panics(t, func() {
+			GetEnvOrDie()
+		})
+	})
+}
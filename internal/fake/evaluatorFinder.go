@@ -22,3 +22,7 @@ type SDKEvaluatorFinder struct {
 func (s SDKEvaluatorFinder) FindEvaluator(method, path string) (sdk.Evaluator, error) {
 	return SDKEvaluator{}, nil
 }
+
+func (s SDKEvaluatorFinder) FindEvaluatorAndRoute(method, path string) (sdk.Evaluator, sdk.MatchedRoute, error) {
+	return SDKEvaluator{}, sdk.MatchedRoute{}, nil
+}
@@ -20,7 +20,7 @@ import (
 	"os"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/rond-authz/rond/logging"
 )
 
 type ClosableHTTPServer interface {
@@ -29,15 +29,15 @@ type ClosableHTTPServer interface {
 }
 
 // GracefulShutdown waits on notified signal to shutdown until all connections are closed.
-func GracefulShutdown(srv ClosableHTTPServer, interruptChan chan os.Signal, logger *logrus.Logger, delayShutdownSeconds int) {
+func GracefulShutdown(srv ClosableHTTPServer, interruptChan chan os.Signal, logger logging.Logger, delayShutdownSeconds int) {
 	// Block until we receive our signal.
 	<-interruptChan
 
 	time.Sleep(time.Duration(delayShutdownSeconds) * time.Second)
 	if err := srv.Shutdown(context.Background()); err != nil {
-		logger.WithError(err).Error("Error during shutdown, forcing close.")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("Error during shutdown, forcing close.")
 		if err := srv.Close(); err != nil {
-			logger.WithError(err).Error("Error during server close.")
+			logger.WithField("error", map[string]any{"message": err.Error()}).Error("Error during server close.")
 		}
 	}
 }
@@ -24,9 +24,10 @@ import (
 	"syscall"
 	"testing"
 
-	"github.com/stretchr/testify/require"
+	rondlogrus "github.com/rond-authz/rond/logging/logrus"
 
 	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGracefulShutdown(t *testing.T) {
@@ -48,7 +49,7 @@ func TestGracefulShutdown(t *testing.T) {
 	log, _ := test.NewNullLogger()
 
 	go func() {
-		GracefulShutdown(srv, interruptChan, log, 0)
+		GracefulShutdown(srv, interruptChan, rondlogrus.NewLogger(log), 0)
 	}()
 
 	interruptChan <- syscall.SIGTERM
@@ -71,7 +72,7 @@ func TestGracefulShutdownServerShutdownFailure(t *testing.T) {
 	mtx.Lock()
 	go func(srv *MockClosableHTTPServer) {
 		defer mtx.Unlock()
-		GracefulShutdown(srv, interruptChan, log, 0)
+		GracefulShutdown(srv, interruptChan, rondlogrus.NewLogger(log), 0)
 	}(srv)
 
 	interruptChan <- syscall.SIGTERM
@@ -100,7 +101,7 @@ func TestGracefulShutdownServerCloseFailure(t *testing.T) {
 	mtx.Lock()
 	go func(srv *MockClosableHTTPServer) {
 		defer mtx.Unlock()
-		GracefulShutdown(srv, interruptChan, log, 0)
+		GracefulShutdown(srv, interruptChan, rondlogrus.NewLogger(log), 0)
 	}(srv)
 
 	interruptChan <- syscall.SIGTERM
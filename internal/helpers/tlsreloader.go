@@ -0,0 +1,170 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rond-authz/rond/logging"
+)
+
+const defaultCertificateCheckInterval = 10 * time.Second
+
+// CertificateReloader provides the server TLS configuration with the certificate
+// and the client CAs loaded from files. The files are checked for changes at most
+// once every check interval, during the TLS handshakes, so that renewed certificates
+// are served without restarting the server.
+type CertificateReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	logger       logging.Logger
+
+	checkInterval time.Duration
+
+	mtx         sync.Mutex
+	lastCheck   time.Time
+	modTimes    []time.Time
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+}
+
+// NewCertificateReloader loads the certificate and key files. If clientCAFile is set,
+// the clients are required to present a certificate signed by one of its CAs.
+func NewCertificateReloader(logger logging.Logger, certFile, keyFile, clientCAFile string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		clientCAFile:  clientCAFile,
+		logger:        logger,
+		checkInterval: defaultCertificateCheckInterval,
+	}
+	modTimes, err := reloader.filesModTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := reloader.load(modTimes); err != nil {
+		return nil, err
+	}
+	reloader.lastCheck = time.Now()
+	return reloader, nil
+}
+
+// TLSConfig returns the server TLS configuration. The configuration selected for
+// each client is a clone of it with the current certificate and client CAs, so that
+// the protocols negotiated, HTTP/2 included, are kept.
+func (r *CertificateReloader) TLSConfig() *tls.Config {
+	baseConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	config := baseConfig.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		certificate, clientCAs := r.current()
+		clientConfig := baseConfig.Clone()
+		clientConfig.Certificates = []tls.Certificate{*certificate}
+		if clientCAs != nil {
+			clientConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			clientConfig.ClientCAs = clientCAs
+		}
+		return clientConfig, nil
+	}
+	return config
+}
+
+func (r *CertificateReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if time.Since(r.lastCheck) >= r.checkInterval {
+		r.lastCheck = time.Now()
+		r.reloadIfChanged()
+	}
+	return r.certificate, r.clientCAs
+}
+
+// reloadIfChanged keeps serving the previous certificate if the new files are not valid,
+// since they could be only partially written.
+func (r *CertificateReloader) reloadIfChanged() {
+	modTimes, err := r.filesModTimes()
+	if err == nil && equalTimes(modTimes, r.modTimes) {
+		return
+	}
+	if err == nil {
+		err = r.load(modTimes)
+	}
+	if err != nil {
+		r.logger.WithField("error", map[string]any{"message": err.Error()}).Warn("failed TLS certificate reload")
+		return
+	}
+	r.logger.WithField("certFile", r.certFile).Info("TLS certificate reloaded")
+}
+
+func (r *CertificateReloader) load(modTimes []time.Time) error {
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed TLS certificate load: %s", err.Error())
+	}
+
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		//#nosec G304 -- This is an expected behaviour
+		caBundle, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed client CA load: %s", err.Error())
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caBundle) {
+			return fmt.Errorf("failed client CA load: no certificate found in %s", r.clientCAFile)
+		}
+	}
+
+	r.certificate = &certificate
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
+
+func (r *CertificateReloader) filesModTimes() ([]time.Time, error) {
+	modTimes := []time.Time{}
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed TLS file stat: %s", err.Error())
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+func equalTimes(times, otherTimes []time.Time) bool {
+	if len(times) != len(otherTimes) {
+		return false
+	}
+	for i := range times {
+		if !times[i].Equal(otherTimes[i]) {
+			return false
+		}
+	}
+	return true
+}
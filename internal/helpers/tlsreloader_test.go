@@ -0,0 +1,161 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helpers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rond-authz/rond/internal/testutils"
+	"github.com/rond-authz/rond/logging"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateReloader(t *testing.T) {
+	log := logging.NewNoOpLogger()
+
+	startServer := func(t *testing.T, reloader *CertificateReloader) *httptest.Server {
+		t.Helper()
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		server.TLS = reloader.TLSConfig()
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	newClient := func(rootCAs *x509.CertPool, certificates ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      rootCAs,
+			Certificates: certificates,
+			MinVersion:   tls.VersionTLS12,
+		}}}
+	}
+
+	t.Run("serves TLS without client authentication", func(t *testing.T) {
+		certs := testutils.GenerateTLSCertificates(t)
+		reloader, err := NewCertificateReloader(log, certs.ServerCertFile, certs.ServerKeyFile, "")
+		require.NoError(t, err)
+		server := startServer(t, reloader)
+
+		resp, err := newClient(certs.CAPool).Get(server.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("negotiates HTTP/2", func(t *testing.T) {
+		certs := testutils.GenerateTLSCertificates(t)
+		reloader, err := NewCertificateReloader(log, certs.ServerCertFile, certs.ServerKeyFile, "")
+		require.NoError(t, err)
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		server.EnableHTTP2 = true
+		server.TLS = reloader.TLSConfig()
+		server.StartTLS()
+		defer server.Close()
+
+		client := &http.Client{Transport: &http.Transport{
+			ForceAttemptHTTP2: true,
+			TLSClientConfig: &tls.Config{
+				RootCAs:    certs.CAPool,
+				MinVersion: tls.VersionTLS12,
+			},
+		}}
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, 2, resp.ProtoMajor)
+	})
+
+	t.Run("requires client certificate with client CA", func(t *testing.T) {
+		certs := testutils.GenerateTLSCertificates(t)
+		reloader, err := NewCertificateReloader(log, certs.ServerCertFile, certs.ServerKeyFile, certs.CAFile)
+		require.NoError(t, err)
+		server := startServer(t, reloader)
+
+		resp, err := newClient(certs.CAPool, certs.ClientCertificate).Get(server.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		_, err = newClient(certs.CAPool).Get(server.URL)
+		require.Error(t, err)
+	})
+
+	t.Run("reloads changed certificate files", func(t *testing.T) {
+		certs := testutils.GenerateTLSCertificates(t)
+		reloader, err := NewCertificateReloader(log, certs.ServerCertFile, certs.ServerKeyFile, "")
+		require.NoError(t, err)
+		reloader.checkInterval = 0
+		server := startServer(t, reloader)
+
+		renewedCerts := testutils.GenerateTLSCertificates(t)
+		copyFile(t, renewedCerts.ServerCertFile, certs.ServerCertFile)
+		copyFile(t, renewedCerts.ServerKeyFile, certs.ServerKeyFile)
+
+		resp, err := newClient(renewedCerts.CAPool).Get(server.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("keeps the previous certificate if the new one is not valid", func(t *testing.T) {
+		certs := testutils.GenerateTLSCertificates(t)
+		reloader, err := NewCertificateReloader(log, certs.ServerCertFile, certs.ServerKeyFile, "")
+		require.NoError(t, err)
+		reloader.checkInterval = 0
+		server := startServer(t, reloader)
+
+		copyFile(t, certs.CAFile, certs.ServerKeyFile)
+
+		resp, err := newClient(certs.CAPool).Get(server.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("fails with invalid files", func(t *testing.T) {
+		certs := testutils.GenerateTLSCertificates(t)
+
+		_, err := NewCertificateReloader(log, certs.ServerCertFile, certs.ClientKeyFile, "")
+		require.Error(t, err)
+
+		_, err = NewCertificateReloader(log, certs.ServerCertFile, certs.ServerKeyFile, certs.ServerKeyFile)
+		require.Error(t, err)
+
+		_, err = NewCertificateReloader(log, "./not-existing.crt", certs.ServerKeyFile, "")
+		require.Error(t, err)
+	})
+}
+
+// copyFile overwrites the destination file, moving its modification time forward
+// to not depend on the file system timestamps resolution.
+func copyFile(t *testing.T, source, destination string) {
+	t.Helper()
+	content, err := os.ReadFile(source)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(destination, content, 0600))
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(destination, modTime, modTime))
+}
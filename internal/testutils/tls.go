@@ -0,0 +1,128 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	TLSServerName       = "rond.test"
+	TLSClientCommonName = "rond-client"
+	TLSClientDNSName    = "client.rond.test"
+)
+
+// TLSCertificates holds the PEM files of a test CA and of a server and a client
+// certificate signed by it.
+type TLSCertificates struct {
+	CAFile         string
+	ServerCertFile string
+	ServerKeyFile  string
+	ClientCertFile string
+	ClientKeyFile  string
+
+	CAPool            *x509.CertPool
+	ServerCertificate tls.Certificate
+	ClientCertificate tls.Certificate
+}
+
+// GenerateTLSCertificates writes a new set of test certificates in a temporary directory.
+// The server certificate is valid for localhost, 127.0.0.1 and TLSServerName.
+func GenerateTLSCertificates(t *testing.T) TLSCertificates {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "rond test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	certs := TLSCertificates{
+		CAFile: filepath.Join(dir, "ca.crt"),
+		CAPool: x509.NewCertPool(),
+	}
+	certs.CAPool.AddCert(caCert)
+	writePEM(t, certs.CAFile, "CERTIFICATE", caDER)
+
+	certs.ServerCertFile, certs.ServerKeyFile, certs.ServerCertificate = generateLeafCertificate(t, dir, "server", caCert, caKey, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: TLSServerName},
+		DNSNames:     []string{"localhost", TLSServerName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	certs.ClientCertFile, certs.ClientKeyFile, certs.ClientCertificate = generateLeafCertificate(t, dir, "client", caCert, caKey, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: TLSClientCommonName},
+		DNSNames:     []string{TLSClientDNSName},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return certs
+}
+
+func generateLeafCertificate(t *testing.T, dir, name string, caCert *x509.Certificate, caKey *ecdsa.PrivateKey, template *x509.Certificate) (string, string, tls.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", certDER)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	return certFile, keyFile, certificate
+}
+
+func writePEM(t *testing.T, path, blockType string, bytes []byte) {
+	t.Helper()
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes}), 0600)
+	require.NoError(t, err)
+}
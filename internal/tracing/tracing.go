@@ -0,0 +1,100 @@
+// Copyright 2021 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TracerName  = "github.com/rond-authz/rond"
+	serviceName = "rond"
+)
+
+// Start starts a span with the global tracer provider, so that the spans are exported
+// both by the provider configured by rond and by the one of applications using the sdk.
+func Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, spanName, opts...)
+}
+
+// End ends the span, recording the error if any.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+type Options struct {
+	// OTLPEndpoint is the host and port of the OTLP gRPC collector. If empty, the
+	// spans are not exported.
+	OTLPEndpoint string
+	// Insecure disables the TLS connection to the collector.
+	Insecure       bool
+	ServiceVersion string
+}
+
+// Setup sets the W3C trace context propagator and, if the OTLP endpoint is set, the
+// global tracer provider exporting the spans to the collector. The returned function
+// flushes the pending spans and must be called on shutdown.
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if options.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(options.OTLPEndpoint)}
+	if options.Insecure {
+		exporterOptions = append(exporterOptions, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed OTLP exporter creation: %s", err.Error())
+	}
+
+	tracerProvider := NewTracerProvider(sdktrace.WithBatcher(exporter), options.ServiceVersion)
+	otel.SetTracerProvider(tracerProvider)
+	return tracerProvider.Shutdown, nil
+}
+
+// NewTracerProvider returns a tracer provider with the rond service resource,
+// exporting the spans with the given span processor option.
+func NewTracerProvider(exporterOption sdktrace.TracerProviderOption, serviceVersion string) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(exporterOption, sdktrace.WithResource(NewResource(serviceVersion)))
+}
+
+// NewResource returns the resource describing the rond service, shared by the
+// exported traces and metrics.
+func NewResource(serviceVersion string) *resource.Resource {
+	serviceResource, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(serviceVersion),
+	))
+	if err != nil {
+		return resource.Default()
+	}
+	return serviceResource
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+func TestSetup(t *testing.T) {
+	t.Run("sets the W3C trace context propagator without exporter", func(t *testing.T) {
+		previousPropagator := otel.GetTextMapPropagator()
+		t.Cleanup(func() { otel.SetTextMapPropagator(previousPropagator) })
+
+		shutdown, err := Setup(context.Background(), Options{})
+		require.NoError(t, err)
+		require.NoError(t, shutdown(context.Background()))
+
+		ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(http.Header{
+			"Traceparent": []string{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+		}))
+		headers := http.Header{}
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(headers))
+		require.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", headers.Get("traceparent"))
+	})
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := NewTracerProvider(sdktrace.WithSyncer(exporter), "1.2.3")
+
+	_, span := tracerProvider.Tracer(TracerName).Start(context.Background(), "some span")
+	End(span, errors.New("some error"))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, codes.Error, spans[0].Status.Code)
+	require.Equal(t, "some error", spans[0].Status.Description)
+	require.Contains(t, spans[0].Resource.Attributes(), semconv.ServiceName("rond"))
+	require.Contains(t, spans[0].Resource.Attributes(), semconv.ServiceVersion("1.2.3"))
+}
@@ -16,8 +16,11 @@ package utils
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rond-authz/rond/types"
 )
@@ -38,6 +41,15 @@ func HasApplicationJSONContentType(headers http.Header) bool {
 	return strings.HasPrefix(headers.Get(ContentTypeHeaderKey), JSONContentTypeHeader)
 }
 
+// SetRetryAfterHeader sets the Retry-After header with the seconds to wait, rounded up.
+func SetRetryAfterHeader(headers http.Header, retryAfter time.Duration) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	headers.Set("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
 func FailResponse(w http.ResponseWriter, technicalError, businessError string) {
 	FailResponseWithCode(w, http.StatusInternalServerError, technicalError, businessError)
 }
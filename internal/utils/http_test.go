@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/rond-authz/rond/types"
 	"github.com/stretchr/testify/require"
@@ -87,3 +88,22 @@ func TestFailResponseWithCode(t *testing.T) {
 		Message:    "The Message",
 	}, response)
 }
+
+func TestSetRetryAfterHeader(t *testing.T) {
+	testCases := map[string]struct {
+		retryAfter time.Duration
+		expected   string
+	}{
+		"rounds up to seconds": {retryAfter: 1500 * time.Millisecond, expected: "2"},
+		"whole seconds":        {retryAfter: time.Minute, expected: "60"},
+		"at least one second":  {retryAfter: 0, expected: "1"},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			headers := http.Header{}
+			SetRetryAfterHeader(headers, testCase.retryAfter)
+			require.Equal(t, testCase.expected, headers.Get("Retry-After"))
+		})
+	}
+}
@@ -96,6 +96,20 @@ func TestLogrusAdapter(t *testing.T) {
 				"some": "value",
 			},
 		},
+		{
+			name: "with chained fields",
+			test: func(t *testing.T, log logging.Logger) {
+				log.WithField("some", "value").WithFields(map[string]any{
+					"other": "value",
+				}).Info("a message")
+			},
+			expectedMsg:   "a message",
+			expectedLevel: logrus.InfoLevel,
+			expectedData: logrus.Fields{
+				"some":  "value",
+				"other": "value",
+			},
+		},
 	}
 
 	t.Run("from logger", func(t *testing.T) {
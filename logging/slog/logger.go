@@ -0,0 +1,75 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondslog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/rond-authz/rond/logging"
+)
+
+// LevelTrace is the level used for trace logs, which slog does not define.
+const LevelTrace = slog.Level(-8)
+
+// ReplaceAttr can be set as slog.HandlerOptions.ReplaceAttr to write the trace
+// level as TRACE instead of DEBUG-4.
+func ReplaceAttr(_ []string, attr slog.Attr) slog.Attr {
+	if level, ok := attr.Value.Any().(slog.Level); ok && attr.Key == slog.LevelKey && level == LevelTrace {
+		attr.Value = slog.StringValue("TRACE")
+	}
+	return attr
+}
+
+type slogWrapper struct {
+	logger *slog.Logger
+}
+
+func (l *slogWrapper) WithField(key string, value any) logging.Logger {
+	return &slogWrapper{l.logger.With(key, value)}
+}
+
+func (l *slogWrapper) WithFields(fields map[string]any) logging.Logger {
+	args := make([]any, 0, 2*len(fields))
+	for key, value := range fields {
+		args = append(args, key, value)
+	}
+	return &slogWrapper{l.logger.With(args...)}
+}
+
+func (l slogWrapper) Info(msg any) {
+	l.logger.Info(fmt.Sprint(msg))
+}
+
+func (l slogWrapper) Trace(msg any) {
+	l.logger.Log(context.Background(), LevelTrace, fmt.Sprint(msg))
+}
+
+func (l slogWrapper) Debug(msg any) {
+	l.logger.Debug(fmt.Sprint(msg))
+}
+
+func (l slogWrapper) Error(msg any) {
+	l.logger.Error(fmt.Sprint(msg))
+}
+
+func (l slogWrapper) Warn(msg any) {
+	l.logger.Warn(fmt.Sprint(msg))
+}
+
+func NewLogger(logger *slog.Logger) logging.Logger {
+	return &slogWrapper{logger}
+}
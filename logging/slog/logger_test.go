@@ -0,0 +1,124 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/rond-authz/rond/logging"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogAdapter(t *testing.T) {
+	testCases := []struct {
+		name          string
+		test          func(t *testing.T, log logging.Logger)
+		expectedMsg   string
+		expectedLevel string
+		expectedData  map[string]any
+	}{
+		{
+			name: "error",
+			test: func(t *testing.T, log logging.Logger) {
+				log.Error("a message")
+			},
+			expectedMsg:   "a message",
+			expectedLevel: "ERROR",
+		},
+		{
+			name: "warn",
+			test: func(t *testing.T, log logging.Logger) {
+				log.Warn("a message")
+			},
+			expectedMsg:   "a message",
+			expectedLevel: "WARN",
+		},
+		{
+			name: "info",
+			test: func(t *testing.T, log logging.Logger) {
+				log.Info("a message")
+			},
+			expectedMsg:   "a message",
+			expectedLevel: "INFO",
+		},
+		{
+			name: "debug",
+			test: func(t *testing.T, log logging.Logger) {
+				log.Debug("a message")
+			},
+			expectedMsg:   "a message",
+			expectedLevel: "DEBUG",
+		},
+		{
+			name: "trace",
+			test: func(t *testing.T, log logging.Logger) {
+				log.Trace("a message")
+			},
+			expectedMsg:   "a message",
+			expectedLevel: "TRACE",
+		},
+		{
+			name: "with fields",
+			test: func(t *testing.T, log logging.Logger) {
+				log.WithFields(map[string]any{
+					"some": "value",
+				}).Info("a message")
+			},
+			expectedMsg:   "a message",
+			expectedLevel: "INFO",
+			expectedData: map[string]any{
+				"some": "value",
+			},
+		},
+		{
+			name: "with chained fields",
+			test: func(t *testing.T, log logging.Logger) {
+				log.WithField("some", "value").WithField("error", map[string]any{
+					"message": "some error",
+				}).Info("a message")
+			},
+			expectedMsg:   "a message",
+			expectedLevel: "INFO",
+			expectedData: map[string]any{
+				"some":  "value",
+				"error": map[string]any{"message": "some error"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			logger := NewLogger(slog.New(slog.NewJSONHandler(buffer, &slog.HandlerOptions{
+				Level:       LevelTrace,
+				ReplaceAttr: ReplaceAttr,
+			})))
+
+			testCase.test(t, logger)
+
+			record := map[string]any{}
+			require.NoError(t, json.Unmarshal(buffer.Bytes(), &record))
+			require.Equal(t, testCase.expectedMsg, record[slog.MessageKey])
+			require.Equal(t, testCase.expectedLevel, record[slog.LevelKey])
+			for key, value := range testCase.expectedData {
+				require.Equal(t, value, record[key])
+			}
+		})
+	}
+}
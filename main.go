@@ -16,7 +16,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -30,9 +33,12 @@ import (
 	"github.com/rond-authz/rond/internal/config"
 	"github.com/rond-authz/rond/internal/helpers"
 	"github.com/rond-authz/rond/internal/mongoclient"
+	"github.com/rond-authz/rond/internal/tracing"
 	"github.com/rond-authz/rond/logging"
 	rondlogrus "github.com/rond-authz/rond/logging/logrus"
+	rondslog "github.com/rond-authz/rond/logging/slog"
 	"github.com/rond-authz/rond/metrics"
+	rondotel "github.com/rond-authz/rond/metrics/otel"
 	rondprometheus "github.com/rond-authz/rond/metrics/prometheus"
 	"github.com/rond-authz/rond/openapi"
 	"github.com/rond-authz/rond/sdk"
@@ -40,8 +46,11 @@ import (
 	inputusermongoclient "github.com/rond-authz/rond/sdk/inputuser/mongo"
 	"github.com/rond-authz/rond/service"
 
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	glogrus "github.com/mia-platform/glogger/v4/loggers/logrus"
-	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -53,64 +62,116 @@ func entrypoint(shutdown chan os.Signal) {
 	env := config.GetEnvOrDie()
 
 	// Init logger instance.
-	log, err := glogrus.InitHelper(glogrus.InitOptions{Level: env.LogLevel})
+	log, err := newLogger(env)
 	if err != nil {
 		panic(err.Error())
 	}
 
 	if _, err := os.Stat(env.OPAModulesDirectory); err != nil {
-		log.WithFields(logrus.Fields{
-			"error":        logrus.Fields{"message": err.Error()},
+		log.WithFields(map[string]any{
+			"error":        map[string]any{"message": err.Error()},
 			"opaDirectory": env.OPAModulesDirectory,
-		}).Errorf("load OPA modules failed")
+		}).Error("load OPA modules failed")
 		return
 	}
 
 	opaModuleConfig, err := core.LoadRegoModule(env.OPAModulesDirectory)
 	if err != nil {
-		log.WithFields(logrus.Fields{
-			"error":        logrus.Fields{"message": err.Error()},
+		log.WithFields(map[string]any{
+			"error":        map[string]any{"message": err.Error()},
 			"opaDirectory": env.OPAModulesDirectory,
-		}).Errorf("failed rego file read")
+		}).Error("failed rego file read")
 		return
 	}
 	log.WithField("opaModuleFileName", opaModuleConfig.Name).Trace("rego module successfully loaded")
 
-	rondLogger := rondlogrus.NewLogger(log)
-	oas, err := openapi.LoadOASFromFileOrNetwork(rondLogger, openapi.LoadOptions{
+	additionalOASSources, err := openapi.ParseOASSources(env.AdditionalOASSources)
+	if err != nil {
+		log.WithFields(map[string]any{
+			"error": map[string]any{"message": err.Error()},
+		}).Error("invalid additional OAS sources")
+		return
+	}
+	upstreamTargets, err := env.GetUpstreamTargets()
+	if err != nil {
+		log.WithFields(map[string]any{
+			"error": map[string]any{"message": err.Error()},
+		}).Error("invalid upstream targets")
+		return
+	}
+	for _, upstreamTarget := range upstreamTargets {
+		if upstreamTarget.OASPath != "" {
+			additionalOASSources = append(additionalOASSources, openapi.OASSource{
+				URL:        upstreamTarget.OASURL(),
+				PathPrefix: upstreamTarget.PathPrefix,
+			})
+		}
+	}
+	targetTransport, err := env.NewTargetServiceTransport()
+	if err != nil {
+		log.WithFields(map[string]any{
+			"error": map[string]any{"message": err.Error()},
+		}).Error("invalid target service TLS configuration")
+		return
+	}
+	oas, err := openapi.LoadOASFromFileOrNetwork(log, openapi.LoadOptions{
 		APIPermissionsFilePath: env.APIPermissionsFilePath,
 		TargetServiceOASPath:   env.TargetServiceOASPath,
 		TargetServiceHost:      env.TargetServiceHost,
+		TargetServiceScheme:    env.TargetServiceScheme,
+		HTTPClient:             &http.Client{Transport: targetTransport},
+		AdditionalSources:      additionalOASSources,
 	})
 	if err != nil {
-		log.WithFields(logrus.Fields{
-			"error":       logrus.Fields{"message": err.Error()},
+		log.WithFields(map[string]any{
+			"error":       map[string]any{"message": err.Error()},
 			"oasFilePath": env.APIPermissionsFilePath,
 			"oasApiPath":  env.TargetServiceOASPath,
-		}).Errorf("failed to load oas")
+		}).Error("failed to load oas")
 		return
 	}
-	log.WithFields(logrus.Fields{
+	log.WithFields(map[string]any{
 		"oasFilePath": env.APIPermissionsFilePath,
 		"oasApiPath":  env.TargetServiceOASPath,
 	}).Trace("OAS successfully loaded")
 
+	if err := oas.Validate(opaModuleConfig); err != nil {
+		var validationError openapi.ValidationError
+		if !errors.As(err, &validationError) {
+			validationError.Issues = []openapi.ValidationIssue{{Message: err.Error()}}
+		}
+		for _, issue := range validationError.Issues {
+			log.WithFields(map[string]any{
+				"path":   issue.Path,
+				"method": issue.Method,
+			}).Warn(issue.Message)
+		}
+		if env.StrictOASValidation {
+			log.WithFields(map[string]any{
+				"error":       map[string]any{"message": err.Error()},
+				"oasFilePath": env.APIPermissionsFilePath,
+				"oasApiPath":  env.TargetServiceOASPath,
+			}).Error("invalid OAS configuration")
+			return
+		}
+	}
+
 	var mongoDriver *mongoclient.MongoClient
 	if env.MongoDBUrl != "" {
-		client, err := mongoclient.NewMongoClient(rondLogger, env.MongoDBUrl, mongoclient.ConnectionOpts{
+		client, err := mongoclient.NewMongoClient(log, env.MongoDBUrl, mongoclient.ConnectionOpts{
 			MaxIdleTimeMs: env.MongoDBConnectionMaxIdleTimeMs,
 		})
 		if err != nil {
-			log.WithFields(logrus.Fields{
-				"error": logrus.Fields{"message": err.Error()},
-			}).Errorf("MongoDB setup failed")
+			log.WithFields(map[string]any{
+				"error": map[string]any{"message": err.Error()},
+			}).Error("MongoDB setup failed")
 			return
 		}
 		defer func() {
 			if err := client.Disconnect(); err != nil {
-				log.WithFields(logrus.Fields{
-					"error": logrus.Fields{"message": err.Error()},
-				}).Errorf("MongoDB disconnection failed")
+				log.WithFields(map[string]any{
+					"error": map[string]any{"message": err.Error()},
+				}).Error("MongoDB disconnection failed")
 			}
 		}()
 		mongoDriver = client
@@ -118,60 +179,136 @@ func entrypoint(shutdown chan os.Signal) {
 
 	var mongoClientForUserBindings inputuser.Client
 	var mongoClientForBuiltin custom_builtins.IMongoClient
+	var rateLimitStore custom_builtins.RateLimitStore = custom_builtins.NewInMemoryRateLimitStore()
 	if mongoDriver != nil {
-		client, err := inputusermongoclient.NewMongoClient(rondLogger, mongoDriver, inputusermongoclient.Config{
+		client, err := inputusermongoclient.NewMongoClient(log, mongoDriver, inputusermongoclient.Config{
 			RolesCollectionName:    env.RolesCollectionName,
 			BindingsCollectionName: env.BindingsCollectionName,
 		})
 		if err != nil {
-			log.WithFields(logrus.Fields{
-				"error": logrus.Fields{"message": err.Error()},
-			}).Errorf("MongoDB setup failed")
+			log.WithFields(map[string]any{
+				"error": map[string]any{"message": err.Error()},
+			}).Error("MongoDB setup failed")
 			return
 		}
 		mongoClientForUserBindings = client
 
-		clientForBuiltin, err := custom_builtins.NewMongoClient(rondLogger, mongoDriver)
+		clientForBuiltin, err := custom_builtins.NewMongoClient(log, mongoDriver)
 		if err != nil {
-			log.WithFields(logrus.Fields{
-				"error": logrus.Fields{"message": err.Error()},
-			}).Errorf("MongoDB for builtin setup failed")
+			log.WithFields(map[string]any{
+				"error": map[string]any{"message": err.Error()},
+			}).Error("MongoDB for builtin setup failed")
 			return
 		}
 		mongoClientForBuiltin = clientForBuiltin
+
+		if env.RateLimitCollectionName != "" {
+			store, err := custom_builtins.NewMongoRateLimitStore(context.Background(), mongoDriver, env.RateLimitCollectionName)
+			if err != nil {
+				log.WithFields(map[string]any{
+					"error": map[string]any{"message": err.Error()},
+				}).Error("MongoDB for rate limit setup failed")
+				return
+			}
+			rateLimitStore = store
+		}
 	}
 
-	var m *metrics.Metrics
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		OTLPEndpoint:   env.TracingOTLPEndpoint,
+		Insecure:       env.TracingOTLPInsecure,
+		ServiceVersion: env.ServiceVersion,
+	})
+	if err != nil {
+		log.WithFields(map[string]any{
+			"error": map[string]any{"message": err.Error()},
+		}).Error("tracing setup failed")
+		return
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.WithField("error", map[string]any{"message": err.Error()}).Warn("failed tracing shutdown")
+		}
+	}()
+
+	m := metrics.NoOpMetrics()
 	var registry *prometheus.Registry
 	if env.ExposeMetrics {
-		registry = prometheus.NewRegistry()
-		registry.MustRegister(
-			collectors.NewGoCollector(),
-			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
-		)
-		m = rondprometheus.SetupMetrics(registry)
+		var shutdownMetrics func(context.Context) error
+		m, registry, shutdownMetrics, err = setupMetrics(env)
+		if err != nil {
+			log.WithFields(map[string]any{
+				"error": map[string]any{"message": err.Error()},
+			}).Error("metrics setup failed")
+			return
+		}
+		defer func() {
+			if err := shutdownMetrics(context.Background()); err != nil {
+				log.WithField("error", map[string]any{"message": err.Error()}).Warn("failed metrics shutdown")
+			}
+		}()
 	}
 
 	sdkBoot := service.NewSDKBootState()
 	go func(sdkBoot *service.SDKBootState) {
-		sdk := prepSDKOrDie(log, env, opaModuleConfig, oas, mongoClientForBuiltin, rondLogger, m)
+		sdk := prepSDKOrDie(log, env, opaModuleConfig, oas, mongoClientForBuiltin, rateLimitStore, m)
 		sdkBoot.Ready(sdk)
+		m.SDKLoadTimestampSeconds.Set(float64(time.Now().Unix()))
 	}(sdkBoot)
 
 	// Routing
 	log.Trace("router setup initialization")
-	router, _ := service.SetupRouter(log, env, opaModuleConfig, oas, sdkBoot, mongoClientForUserBindings, registry)
+	router, _ := service.SetupRouter(log, env, opaModuleConfig, oas, sdkBoot, mongoClientForUserBindings, registry, m)
 	log.Trace("router setup initialization done")
 
+	if env.ExtAuthzGRPCPort != "" {
+		listener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", env.ExtAuthzGRPCPort))
+		if err != nil {
+			log.WithFields(map[string]any{
+				"error": map[string]any{"message": err.Error()},
+				"port":  env.ExtAuthzGRPCPort,
+			}).Error("ext_authz gRPC server setup failed")
+			return
+		}
+		grpcServer := grpc.NewServer()
+		authv3.RegisterAuthorizationServer(grpcServer, service.NewExtAuthzServer(log, env, opaModuleConfig, sdkBoot, mongoClientForUserBindings))
+		go func() {
+			log.WithField("port", env.ExtAuthzGRPCPort).Info("Starting ext_authz gRPC server")
+			if err := grpcServer.Serve(listener); err != nil {
+				log.WithField("error", map[string]any{"message": err.Error()}).Error("ext_authz gRPC server stopped")
+			}
+		}()
+		defer grpcServer.GracefulStop()
+	}
+
 	srv := &http.Server{
 		Addr:              fmt.Sprintf("0.0.0.0:%s", env.HTTPPort),
 		Handler:           router,
 		ReadHeaderTimeout: time.Second,
 	}
+	if env.TLSCertFile != "" {
+		certificateReloader, err := helpers.NewCertificateReloader(log, env.TLSCertFile, env.TLSKeyFile, env.TLSClientCAFile)
+		if err != nil {
+			log.WithFields(map[string]any{
+				"error": map[string]any{"message": err.Error()},
+			}).Error("server TLS setup failed")
+			return
+		}
+		srv.TLSConfig = certificateReloader.TLSConfig()
+	}
 	go func() {
-		log.WithField("port", env.HTTPPort).Info("Starting server")
-		if err := srv.ListenAndServe(); err != nil {
-			log.Println(err)
+		log.WithFields(map[string]any{
+			"port": env.HTTPPort,
+			"tls":  srv.TLSConfig != nil,
+		}).Info("Starting server")
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
+			log.WithField("error", map[string]any{"message": err.Error()}).Error("server stopped")
 		}
 	}()
 
@@ -182,13 +319,85 @@ func entrypoint(shutdown chan os.Signal) {
 	helpers.GracefulShutdown(srv, shutdown, log, env.DelayShutdownSeconds)
 }
 
+// newLogger creates the logger of the backend chosen with LOG_BACKEND, writing
+// JSON lines to the standard output with the LOG_LEVEL level.
+func newLogger(env config.EnvironmentVariables) (logging.Logger, error) {
+	if env.LogBackend != config.LogBackendSlog {
+		log, err := glogrus.InitHelper(glogrus.InitOptions{Level: env.LogLevel})
+		if err != nil {
+			return nil, err
+		}
+		return rondlogrus.NewLogger(log), nil
+	}
+
+	var level slog.Level
+	switch env.LogLevel {
+	case "trace":
+		level = rondslog.LevelTrace
+	case "warning":
+		level = slog.LevelWarn
+	default:
+		if err := level.UnmarshalText([]byte(env.LogLevel)); err != nil {
+			return nil, fmt.Errorf("invalid log level %s: %w", env.LogLevel, err)
+		}
+	}
+	return rondslog.NewLogger(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: rondslog.ReplaceAttr,
+	}))), nil
+}
+
+// setupMetrics creates the metrics of the backend chosen with METRICS_BACKEND. The
+// Prometheus registry is returned only if the Prometheus backend is enabled, while
+// the OTel metrics are pushed with OTLP/HTTP until shutdown is called.
+func setupMetrics(env config.EnvironmentVariables) (*metrics.Metrics, *prometheus.Registry, func(context.Context) error, error) {
+	var registry *prometheus.Registry
+	var prometheusMetrics *metrics.Metrics
+	if env.MetricsBackend != config.MetricsBackendOTel {
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+		prometheusMetrics = rondprometheus.SetupMetrics(registry)
+		if env.MetricsBackend == config.MetricsBackendPrometheus {
+			return prometheusMetrics, registry, func(context.Context) error { return nil }, nil
+		}
+	}
+
+	exporterOptions := []otlpmetrichttp.Option{}
+	if env.MetricsOTLPEndpoint != "" {
+		exporterOptions = append(exporterOptions, otlpmetrichttp.WithEndpoint(env.MetricsOTLPEndpoint))
+	}
+	if env.MetricsOTLPInsecure {
+		exporterOptions = append(exporterOptions, otlpmetrichttp.WithInsecure())
+	}
+	exporter, err := otlpmetrichttp.New(context.Background(), exporterOptions...)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed OTLP metrics exporter creation: %w", err)
+	}
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(tracing.NewResource(env.ServiceVersion)),
+	)
+
+	otelMetrics, err := rondotel.SetupMetrics(meterProvider)
+	if err != nil {
+		return nil, nil, nil, errors.Join(err, meterProvider.Shutdown(context.Background()))
+	}
+	if prometheusMetrics == nil {
+		return otelMetrics, nil, meterProvider.Shutdown, nil
+	}
+	return metrics.Combine(prometheusMetrics, otelMetrics), registry, meterProvider.Shutdown, nil
+}
+
 func prepSDKOrDie(
-	log *logrus.Logger,
+	log logging.Logger,
 	env config.EnvironmentVariables,
 	opaModuleConfig *core.OPAModuleConfig,
 	oas *openapi.OpenAPISpec,
 	mongoClientForBuiltin custom_builtins.IMongoClient,
-	rondLogger logging.Logger,
+	rateLimitStore custom_builtins.RateLimitStore,
 	m *metrics.Metrics,
 ) sdk.OASEvaluatorFinder {
 	sdk, err := sdk.NewFromOAS(context.Background(), opaModuleConfig, oas, &sdk.Options{
@@ -196,13 +405,17 @@ func prepSDKOrDie(
 		EvaluatorOptions: &sdk.EvaluatorOptions{
 			EnablePrintStatements: env.IsTraceLogLevel(),
 			MongoClient:           mongoClientForBuiltin,
+			RateLimitStore:        rateLimitStore,
 		},
-		Logger: rondLogger,
+		Logger: log,
+		// the missing policies are reported by the OAS validation
+		SkipMissingPoliciesCheck: true,
 	})
 	if err != nil {
-		log.WithFields(logrus.Fields{
-			"error": logrus.Fields{"message": err.Error()},
-		}).Fatalf("failed to create sdk")
+		log.WithFields(map[string]any{
+			"error": map[string]any{"message": err.Error()},
+		}).Error("failed to create sdk")
+		os.Exit(1)
 	}
 	return sdk
 }
@@ -41,6 +41,7 @@ import (
 	"github.com/rond-authz/rond/service"
 	"github.com/rond-authz/rond/types"
 
+	dto "github.com/prometheus/client_model/go"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -192,6 +193,21 @@ func TestEntrypoint(t *testing.T) {
 		require.True(t, true, "If we get here the service has not started")
 	})
 
+	t.Run("fails for invalid rond configuration with strict OAS validation", func(t *testing.T) {
+		setEnvs(t, []env{
+			{name: "HTTP_PORT", value: "3000"},
+			{name: "TARGET_SERVICE_HOST", value: "localhost:3001"},
+			{name: "API_PERMISSIONS_FILE_PATH", value: "./mocks/oasWithRondConfigIssues.json"},
+			{name: "OPA_MODULES_DIRECTORY", value: "./mocks/rego-policies"},
+			{name: "STRICT_OAS_VALIDATION", value: "true"},
+			{name: "LOG_LEVEL", value: "fatal"},
+		})
+		shutdown := make(chan os.Signal, 1)
+
+		entrypoint(shutdown)
+		require.True(t, true, "If we get here the service has not started")
+	})
+
 	t.Run("opens server on port 3000", func(t *testing.T) {
 		shutdown := make(chan os.Signal, 1)
 		defer gock.Off()
@@ -1774,6 +1790,7 @@ func TestSetupRouterStandaloneMode(t *testing.T) {
 		PathPrefixStandalone:     "/my-prefix",
 		ServiceVersion:           "my-version",
 		BindingsCrudServiceURL:   "http://crud:3030",
+		RolesCrudServiceURL:      "http://crud:3030/roles",
 		AdditionalHeadersToProxy: "miauserid",
 	}
 	opa := &core.OPAModuleConfig{
@@ -1819,7 +1836,7 @@ filter_policy {
 
 	sdkState := service.NewSDKBootState()
 	sdkState.Ready(rondSDK)
-	router, err := service.SetupRouter(log, env, opa, oas, sdkState, nil, nil)
+	router, err := service.SetupRouter(rondlogrus.NewLogger(log), env, opa, oas, sdkState, nil, nil, nil)
 	require.NoError(t, err, "unexpected error")
 
 	t.Run("some eval API", func(t *testing.T) {
@@ -1905,6 +1922,23 @@ filter_policy {
 
 		responseBody := getResponseBody(t, w)
 		require.True(t, string(responseBody) != "")
+
+		var openAPIDocument struct {
+			Paths map[string]any `json:"paths"`
+		}
+		require.NoError(t, json.Unmarshal(responseBody, &openAPIDocument))
+		for _, path := range []string{
+			"/grant/bindings",
+			"/revoke/bindings",
+			"/bindings/subject/{subjectId}",
+			"/bindings/resource/{resourceType}/{resourceId}",
+			"/bindings/{bindingId}",
+			"/access-review/resource/{resourceType}/{resourceId}",
+			"/roles",
+			"/roles/{roleId}",
+		} {
+			require.Contains(t, openAPIDocument.Paths, path)
+		}
 	})
 
 	t.Run("API documentation is correctly exposed - yaml", func(t *testing.T) {
@@ -1983,7 +2017,7 @@ filter_policy {
 	}).Observe(123)
 	sdkState := service.NewSDKBootState()
 	sdkState.Ready(rondSDK)
-	router, err := service.SetupRouter(log, env, opa, oas, sdkState, nil, registry)
+	router, err := service.SetupRouter(rondlogrus.NewLogger(log), env, opa, oas, sdkState, nil, registry, m)
 	require.NoError(t, err, "unexpected error")
 
 	t.Run("metrics API exposed correctly", func(t *testing.T) {
@@ -1998,6 +2032,75 @@ filter_policy {
 	})
 }
 
+func TestNewLogger(t *testing.T) {
+	t.Run("creates the logrus logger by default", func(t *testing.T) {
+		logger, err := newLogger(config.EnvironmentVariables{LogLevel: "info", LogBackend: config.LogBackendLogrus})
+		require.NoError(t, err)
+		require.NotNil(t, logger)
+	})
+
+	t.Run("creates the slog logger", func(t *testing.T) {
+		for _, level := range []string{"trace", "debug", "info", "warning", "warn", "error"} {
+			logger, err := newLogger(config.EnvironmentVariables{LogLevel: level, LogBackend: config.LogBackendSlog})
+			require.NoError(t, err, level)
+			require.NotNil(t, logger)
+		}
+	})
+
+	t.Run("fails with invalid slog level", func(t *testing.T) {
+		_, err := newLogger(config.EnvironmentVariables{LogLevel: "verbose", LogBackend: config.LogBackendSlog})
+		require.ErrorContains(t, err, "invalid log level verbose")
+	})
+}
+
+func TestSetupMetrics(t *testing.T) {
+	t.Run("prometheus backend returns the registry", func(t *testing.T) {
+		m, registry, shutdown, err := setupMetrics(config.EnvironmentVariables{MetricsBackend: config.MetricsBackendPrometheus})
+		require.NoError(t, err)
+		require.NotNil(t, registry)
+		require.NoError(t, shutdown(context.Background()))
+
+		m.PolicyEvaluationDurationMilliseconds.With(metrics.Labels{"policy_name": "myPolicy"}).Observe(10)
+		families, err := registry.Gather()
+		require.NoError(t, err)
+		require.Contains(t, metricFamilyNames(families), fmt.Sprintf("rond_%s", metrics.PolicyEvalDurationMetricName))
+	})
+
+	t.Run("otel backend returns no registry", func(t *testing.T) {
+		m, registry, _, err := setupMetrics(config.EnvironmentVariables{
+			MetricsBackend:      config.MetricsBackendOTel,
+			MetricsOTLPEndpoint: "localhost:4318",
+			MetricsOTLPInsecure: true,
+		})
+		require.NoError(t, err)
+		require.Nil(t, registry)
+		require.NotNil(t, m.PolicyEvaluationDurationMilliseconds)
+	})
+
+	t.Run("both backends record to the registry", func(t *testing.T) {
+		m, registry, _, err := setupMetrics(config.EnvironmentVariables{
+			MetricsBackend:      config.MetricsBackendBoth,
+			MetricsOTLPEndpoint: "localhost:4318",
+			MetricsOTLPInsecure: true,
+		})
+		require.NoError(t, err)
+		require.NotNil(t, registry)
+
+		m.PolicyEvaluationDurationMilliseconds.With(metrics.Labels{"policy_name": "myPolicy"}).Observe(10)
+		families, err := registry.Gather()
+		require.NoError(t, err)
+		require.Contains(t, metricFamilyNames(families), fmt.Sprintf("rond_%s", metrics.PolicyEvalDurationMetricName))
+	})
+}
+
+func metricFamilyNames(families []*dto.MetricFamily) []string {
+	names := make([]string, 0, len(families))
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	return names
+}
+
 func getResponseBody(t *testing.T, w *httptest.ResponseRecorder) []byte {
 	t.Helper()
 
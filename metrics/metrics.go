@@ -14,10 +14,27 @@
 
 package metrics
 
+import (
+	"context"
+)
+
 const (
 	Prefix = "rond"
 
-	PolicyEvalDurationMetricName = "policy_evaluation_duration_milliseconds"
+	PolicyEvalDurationMetricName         = "policy_evaluation_duration_milliseconds"
+	PolicyDecisionsMetricName            = "policy_decisions_total"
+	ResponsePolicyEvalDurationMetricName = "response_policy_evaluation_duration_milliseconds"
+	InputUserFetchDurationMetricName     = "input_user_fetch_duration_milliseconds"
+	MongoQueryDurationMetricName         = "mongo_query_duration_milliseconds"
+	ProxyRequestDurationMetricName       = "proxy_request_duration_milliseconds"
+	SDKLoadTimestampMetricName           = "sdk_load_timestamp_seconds"
+)
+
+// Values of the decision label of the PolicyDecisionsTotal counter.
+const (
+	DecisionAllow = "allow"
+	DecisionDeny  = "deny"
+	DecisionError = "error"
 )
 
 type Labels map[string]string
@@ -30,8 +47,38 @@ type HistogramVec interface {
 	With(labels Labels) Observer
 }
 
+type Counter interface {
+	Inc()
+}
+
+type CounterVec interface {
+	With(labels Labels) Counter
+}
+
+type Gauge interface {
+	Set(float64)
+}
+
 type Metrics struct {
 	PolicyEvaluationDurationMilliseconds HistogramVec
+	// PolicyDecisionsTotal counts the policy evaluations by policy_name, matched_path
+	// and decision, which is one of allow, deny or error.
+	PolicyDecisionsTotal CounterVec
+	// ResponsePolicyEvaluationDurationMilliseconds observes the whole response policy
+	// evaluation, response body decoding and encoding included, by policy_name.
+	ResponsePolicyEvaluationDurationMilliseconds HistogramVec
+	// InputUserFetchDurationMilliseconds observes the user bindings and roles
+	// retrieval, by resource (bindings or roles).
+	InputUserFetchDurationMilliseconds HistogramVec
+	// MongoQueryDurationMilliseconds observes the queries of the find_one and
+	// find_many builtins, by operation and collection.
+	MongoQueryDurationMilliseconds HistogramVec
+	// ProxyRequestDurationMilliseconds observes the requests proxied to the target
+	// service, retries included, by upstream host and status_code.
+	ProxyRequestDurationMilliseconds HistogramVec
+	// SDKLoadTimestampSeconds is set to the unix time of the last policies and OAS
+	// load, so that it is not set until the SDK is ready.
+	SDKLoadTimestampSeconds Gauge
 }
 
 type noopHistogram struct{}
@@ -44,8 +91,158 @@ type noopObserver struct{}
 
 func (o noopObserver) Observe(float64) {}
 
+type noopCounterVec struct{}
+
+func (c noopCounterVec) With(labels Labels) Counter {
+	return noopCounter{}
+}
+
+type noopCounter struct{}
+
+func (c noopCounter) Inc() {}
+
+type noopGauge struct{}
+
+func (g noopGauge) Set(float64) {}
+
 func NoOpMetrics() *Metrics {
 	return &Metrics{
-		PolicyEvaluationDurationMilliseconds: noopHistogram{},
+		PolicyEvaluationDurationMilliseconds:         noopHistogram{},
+		PolicyDecisionsTotal:                         noopCounterVec{},
+		ResponsePolicyEvaluationDurationMilliseconds: noopHistogram{},
+		InputUserFetchDurationMilliseconds:           noopHistogram{},
+		MongoQueryDurationMilliseconds:               noopHistogram{},
+		ProxyRequestDurationMilliseconds:             noopHistogram{},
+		SDKLoadTimestampSeconds:                      noopGauge{},
+	}
+}
+
+// WithNoOpDefaults returns a copy of the metrics with the unset ones replaced by
+// no-op implementations, or the no-op metrics if m is nil.
+func WithNoOpDefaults(m *Metrics) *Metrics {
+	defaults := NoOpMetrics()
+	if m == nil {
+		return defaults
+	}
+	result := *m
+	if result.PolicyEvaluationDurationMilliseconds == nil {
+		result.PolicyEvaluationDurationMilliseconds = defaults.PolicyEvaluationDurationMilliseconds
+	}
+	if result.PolicyDecisionsTotal == nil {
+		result.PolicyDecisionsTotal = defaults.PolicyDecisionsTotal
+	}
+	if result.ResponsePolicyEvaluationDurationMilliseconds == nil {
+		result.ResponsePolicyEvaluationDurationMilliseconds = defaults.ResponsePolicyEvaluationDurationMilliseconds
+	}
+	if result.InputUserFetchDurationMilliseconds == nil {
+		result.InputUserFetchDurationMilliseconds = defaults.InputUserFetchDurationMilliseconds
+	}
+	if result.MongoQueryDurationMilliseconds == nil {
+		result.MongoQueryDurationMilliseconds = defaults.MongoQueryDurationMilliseconds
+	}
+	if result.ProxyRequestDurationMilliseconds == nil {
+		result.ProxyRequestDurationMilliseconds = defaults.ProxyRequestDurationMilliseconds
+	}
+	if result.SDKLoadTimestampSeconds == nil {
+		result.SDKLoadTimestampSeconds = defaults.SDKLoadTimestampSeconds
+	}
+	return &result
+}
+
+// Combine returns metrics recording each measurement with all the given metrics,
+// so that they can be exported with more backends at the same time.
+func Combine(ms ...*Metrics) *Metrics {
+	return &Metrics{
+		PolicyEvaluationDurationMilliseconds: combinedHistogramVec(collect(ms, func(m *Metrics) HistogramVec {
+			return m.PolicyEvaluationDurationMilliseconds
+		})),
+		PolicyDecisionsTotal: combinedCounterVec(collect(ms, func(m *Metrics) CounterVec {
+			return m.PolicyDecisionsTotal
+		})),
+		ResponsePolicyEvaluationDurationMilliseconds: combinedHistogramVec(collect(ms, func(m *Metrics) HistogramVec {
+			return m.ResponsePolicyEvaluationDurationMilliseconds
+		})),
+		InputUserFetchDurationMilliseconds: combinedHistogramVec(collect(ms, func(m *Metrics) HistogramVec {
+			return m.InputUserFetchDurationMilliseconds
+		})),
+		MongoQueryDurationMilliseconds: combinedHistogramVec(collect(ms, func(m *Metrics) HistogramVec {
+			return m.MongoQueryDurationMilliseconds
+		})),
+		ProxyRequestDurationMilliseconds: combinedHistogramVec(collect(ms, func(m *Metrics) HistogramVec {
+			return m.ProxyRequestDurationMilliseconds
+		})),
+		SDKLoadTimestampSeconds: combinedGauge(collect(ms, func(m *Metrics) Gauge {
+			return m.SDKLoadTimestampSeconds
+		})),
+	}
+}
+
+func collect[T any](ms []*Metrics, get func(*Metrics) T) []T {
+	result := make([]T, 0, len(ms))
+	for _, m := range ms {
+		result = append(result, get(WithNoOpDefaults(m)))
+	}
+	return result
+}
+
+type combinedHistogramVec []HistogramVec
+
+func (h combinedHistogramVec) With(labels Labels) Observer {
+	observers := combinedObserver{}
+	for _, histogram := range h {
+		observers = append(observers, histogram.With(labels))
+	}
+	return observers
+}
+
+type combinedObserver []Observer
+
+func (o combinedObserver) Observe(v float64) {
+	for _, observer := range o {
+		observer.Observe(v)
+	}
+}
+
+type combinedCounterVec []CounterVec
+
+func (c combinedCounterVec) With(labels Labels) Counter {
+	counters := combinedCounter{}
+	for _, counter := range c {
+		counters = append(counters, counter.With(labels))
+	}
+	return counters
+}
+
+type combinedCounter []Counter
+
+func (c combinedCounter) Inc() {
+	for _, counter := range c {
+		counter.Inc()
+	}
+}
+
+type combinedGauge []Gauge
+
+func (g combinedGauge) Set(v float64) {
+	for _, gauge := range g {
+		gauge.Set(v)
+	}
+}
+
+type metricsKey struct{}
+
+// WithContext sets the metrics in the context, so that they are recorded by the
+// components without direct access to them, such as the input user retrieval and
+// the custom builtins.
+func WithContext(ctx context.Context, m *Metrics) context.Context {
+	return context.WithValue(ctx, metricsKey{}, WithNoOpDefaults(m))
+}
+
+// FromContext returns the metrics set in the context, or the no-op ones.
+func FromContext(ctx context.Context) *Metrics {
+	m, ok := ctx.Value(metricsKey{}).(*Metrics)
+	if !ok {
+		return NoOpMetrics()
 	}
+	return m
 }
@@ -0,0 +1,73 @@
+// Copyright 2021 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithNoOpDefaults(t *testing.T) {
+	t.Run("returns no-op metrics if nil", func(t *testing.T) {
+		require.Equal(t, NoOpMetrics(), WithNoOpDefaults(nil))
+	})
+
+	t.Run("keeps the set metrics and fills the others", func(t *testing.T) {
+		histogram := noopHistogram{}
+		m := WithNoOpDefaults(&Metrics{PolicyEvaluationDurationMilliseconds: histogram})
+
+		require.Equal(t, histogram, m.PolicyEvaluationDurationMilliseconds)
+		require.NotNil(t, m.PolicyDecisionsTotal)
+		require.NotNil(t, m.ProxyRequestDurationMilliseconds)
+		require.NotNil(t, m.SDKLoadTimestampSeconds)
+	})
+}
+
+func TestContext(t *testing.T) {
+	t.Run("returns no-op metrics if not set", func(t *testing.T) {
+		require.Equal(t, NoOpMetrics(), FromContext(context.Background()))
+	})
+
+	t.Run("returns the metrics set in context", func(t *testing.T) {
+		m := NoOpMetrics()
+		ctx := WithContext(context.Background(), m)
+		require.Equal(t, m, FromContext(ctx))
+	})
+}
+
+func TestCombine(t *testing.T) {
+	first := &recordingHistogramVec{}
+	second := &recordingHistogramVec{}
+	m := Combine(&Metrics{PolicyEvaluationDurationMilliseconds: first}, &Metrics{PolicyEvaluationDurationMilliseconds: second}, nil)
+
+	m.PolicyEvaluationDurationMilliseconds.With(Labels{"policy_name": "allow"}).Observe(10)
+	require.Equal(t, []float64{10}, first.observed)
+	require.Equal(t, []float64{10}, second.observed)
+
+	require.NotPanics(t, func() {
+		m.PolicyDecisionsTotal.With(Labels{"decision": DecisionAllow}).Inc()
+		m.SDKLoadTimestampSeconds.Set(1700000000)
+	})
+}
+
+type recordingHistogramVec struct {
+	observed []float64
+}
+
+func (h *recordingHistogramVec) With(Labels) Observer { return h }
+
+func (h *recordingHistogramVec) Observe(v float64) { h.observed = append(h.observed, v) }
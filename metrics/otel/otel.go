@@ -0,0 +1,162 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondotel
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+
+	"github.com/rond-authz/rond/metrics"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/rond-authz/rond"
+
+// SetupMetrics creates the rond instruments with a meter of the given provider,
+// named as the Prometheus ones, so that SDK users can export them with their
+// own MeterProvider.
+func SetupMetrics(meterProvider metric.MeterProvider) (*metrics.Metrics, error) {
+	meter := meterProvider.Meter(meterName)
+
+	duration, err := newHistogramVec(meter, metrics.PolicyEvalDurationMetricName, "A histogram of the policy evaluation durations in milliseconds.", "ms", 1, 5, 10, 50, 100, 250, 500)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions, err := meter.Int64Counter(
+		metricName(metrics.PolicyDecisionsMetricName),
+		metric.WithDescription("A counter of the policy decisions, by policy, matched path and decision (allow, deny or error)."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	responsePolicyDuration, err := newHistogramVec(meter, metrics.ResponsePolicyEvalDurationMetricName, "A histogram of the response policy evaluation durations in milliseconds, response body encoding included.", "ms", 1, 5, 10, 50, 100, 250, 500)
+	if err != nil {
+		return nil, err
+	}
+
+	inputUserFetchDuration, err := newHistogramVec(meter, metrics.InputUserFetchDurationMetricName, "A histogram of the user bindings and roles retrieval durations in milliseconds.", "ms", 1, 5, 10, 50, 100, 250, 500)
+	if err != nil {
+		return nil, err
+	}
+
+	mongoQueryDuration, err := newHistogramVec(meter, metrics.MongoQueryDurationMetricName, "A histogram of the MongoDB queries durations of the custom builtins in milliseconds.", "ms", 1, 5, 10, 50, 100, 250, 500)
+	if err != nil {
+		return nil, err
+	}
+
+	proxyDuration, err := newHistogramVec(meter, metrics.ProxyRequestDurationMetricName, "A histogram of the durations of the requests proxied to the upstream services in milliseconds.", "ms", 5, 10, 50, 100, 250, 500, 1000, 2500, 5000)
+	if err != nil {
+		return nil, err
+	}
+
+	sdkLoadTimestamp := &gauge{}
+	sdkLoadTimestamp.value.Store(math.Float64bits(math.NaN()))
+	if _, err := meter.Float64ObservableGauge(
+		metricName(metrics.SDKLoadTimestampMetricName),
+		metric.WithDescription("The unix time of the last load of policies and OAS, not set until rond is ready."),
+		metric.WithUnit("s"),
+		metric.WithFloat64Callback(sdkLoadTimestamp.observe),
+	); err != nil {
+		return nil, err
+	}
+
+	return &metrics.Metrics{
+		PolicyEvaluationDurationMilliseconds:         duration,
+		PolicyDecisionsTotal:                         counterVec{decisions},
+		ResponsePolicyEvaluationDurationMilliseconds: responsePolicyDuration,
+		InputUserFetchDurationMilliseconds:           inputUserFetchDuration,
+		MongoQueryDurationMilliseconds:               mongoQueryDuration,
+		ProxyRequestDurationMilliseconds:             proxyDuration,
+		SDKLoadTimestampSeconds:                      sdkLoadTimestamp,
+	}, nil
+}
+
+func metricName(name string) string {
+	return metrics.Prefix + "_" + name
+}
+
+func attributes(labels metrics.Labels) metric.MeasurementOption {
+	keyValues := make([]attribute.KeyValue, 0, len(labels))
+	for key, value := range labels {
+		keyValues = append(keyValues, attribute.String(key, value))
+	}
+	return metric.WithAttributes(keyValues...)
+}
+
+type histogramVec struct {
+	histogram metric.Float64Histogram
+}
+
+func newHistogramVec(meter metric.Meter, name, description, unit string, buckets ...float64) (histogramVec, error) {
+	histogram, err := meter.Float64Histogram(
+		metricName(name),
+		metric.WithDescription(description),
+		metric.WithUnit(unit),
+		metric.WithExplicitBucketBoundaries(buckets...),
+	)
+	return histogramVec{histogram}, err
+}
+
+type observer struct {
+	histogram metric.Float64Histogram
+	labels    metrics.Labels
+}
+
+func (o observer) Observe(v float64) {
+	o.histogram.Record(context.Background(), v, attributes(o.labels))
+}
+
+func (h histogramVec) With(labels metrics.Labels) metrics.Observer {
+	return observer{histogram: h.histogram, labels: labels}
+}
+
+type counterVec struct {
+	counter metric.Int64Counter
+}
+
+type counter struct {
+	counter metric.Int64Counter
+	labels  metrics.Labels
+}
+
+func (c counter) Inc() {
+	c.counter.Add(context.Background(), 1, attributes(c.labels))
+}
+
+func (c counterVec) With(labels metrics.Labels) metrics.Counter {
+	return counter{counter: c.counter, labels: labels}
+}
+
+// gauge keeps the last set value, reported by the observable gauge callback. The
+// value is not reported until it is set.
+type gauge struct {
+	value atomic.Uint64
+}
+
+func (g *gauge) Set(v float64) {
+	g.value.Store(math.Float64bits(v))
+}
+
+func (g *gauge) observe(_ context.Context, o metric.Float64Observer) error {
+	if v := math.Float64frombits(g.value.Load()); !math.IsNaN(v) {
+		o.Observe(v)
+	}
+	return nil
+}
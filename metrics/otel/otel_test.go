@@ -0,0 +1,134 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondotel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rond-authz/rond/metrics"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	m, err := SetupMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	require.NoError(t, err)
+
+	collect := func(t *testing.T) map[string]metricdata.Metrics {
+		t.Helper()
+		var resourceMetrics metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &resourceMetrics))
+
+		result := map[string]metricdata.Metrics{}
+		for _, scopeMetrics := range resourceMetrics.ScopeMetrics {
+			require.Equal(t, meterName, scopeMetrics.Scope.Name)
+			for _, metric := range scopeMetrics.Metrics {
+				result[metric.Name] = metric
+			}
+		}
+		return result
+	}
+
+	t.Run("SDKLoadTimestampSeconds is not reported until set", func(t *testing.T) {
+		require.NotContains(t, collect(t), "rond_sdk_load_timestamp_seconds")
+	})
+
+	t.Run("PolicyEvaluationDurationMilliseconds", func(t *testing.T) {
+		m.PolicyEvaluationDurationMilliseconds.With(metrics.Labels{
+			"policy_name": "myPolicyName",
+		}).Observe(10)
+
+		metric := collect(t)["rond_policy_evaluation_duration_milliseconds"]
+		require.Equal(t, "ms", metric.Unit)
+		histogram, ok := metric.Data.(metricdata.Histogram[float64])
+		require.True(t, ok)
+		require.Len(t, histogram.DataPoints, 1)
+
+		dataPoint := histogram.DataPoints[0]
+		require.Equal(t, attribute.NewSet(attribute.String("policy_name", "myPolicyName")), dataPoint.Attributes)
+		require.Equal(t, []float64{1, 5, 10, 50, 100, 250, 500}, dataPoint.Bounds)
+		require.Equal(t, []uint64{0, 0, 1, 0, 0, 0, 0, 0}, dataPoint.BucketCounts)
+		require.Equal(t, float64(10), dataPoint.Sum)
+	})
+
+	t.Run("PolicyDecisionsTotal", func(t *testing.T) {
+		labels := metrics.Labels{
+			"policy_name":  "myPolicyName",
+			"matched_path": "/users/:id",
+		}
+		for _, decision := range []string{metrics.DecisionAllow, metrics.DecisionAllow, metrics.DecisionDeny} {
+			labels["decision"] = decision
+			m.PolicyDecisionsTotal.With(labels).Inc()
+		}
+
+		sum, ok := collect(t)["rond_policy_decisions_total"].Data.(metricdata.Sum[int64])
+		require.True(t, ok)
+		values := map[string]int64{}
+		for _, dataPoint := range sum.DataPoints {
+			decision, _ := dataPoint.Attributes.Value("decision")
+			values[decision.AsString()] = dataPoint.Value
+		}
+		require.Equal(t, map[string]int64{metrics.DecisionAllow: 2, metrics.DecisionDeny: 1}, values)
+	})
+
+	t.Run("histograms", func(t *testing.T) {
+		testCases := map[string]struct {
+			histogram metrics.HistogramVec
+			labels    metrics.Labels
+		}{
+			metrics.ResponsePolicyEvalDurationMetricName: {
+				histogram: m.ResponsePolicyEvaluationDurationMilliseconds,
+				labels:    metrics.Labels{"policy_name": "myPolicyName"},
+			},
+			metrics.InputUserFetchDurationMetricName: {
+				histogram: m.InputUserFetchDurationMilliseconds,
+				labels:    metrics.Labels{"resource": "bindings"},
+			},
+			metrics.MongoQueryDurationMetricName: {
+				histogram: m.MongoQueryDurationMilliseconds,
+				labels:    metrics.Labels{"operation": "find_one", "collection": "projects"},
+			},
+			metrics.ProxyRequestDurationMetricName: {
+				histogram: m.ProxyRequestDurationMilliseconds,
+				labels:    metrics.Labels{"upstream": "service:3000", "status_code": "200"},
+			},
+		}
+
+		for name, testCase := range testCases {
+			t.Run(name, func(t *testing.T) {
+				testCase.histogram.With(testCase.labels).Observe(10)
+
+				histogram, ok := collect(t)["rond_"+name].Data.(metricdata.Histogram[float64])
+				require.True(t, ok)
+				require.Len(t, histogram.DataPoints, 1)
+				require.Equal(t, uint64(1), histogram.DataPoints[0].Count)
+			})
+		}
+	})
+
+	t.Run("SDKLoadTimestampSeconds", func(t *testing.T) {
+		m.SDKLoadTimestampSeconds.Set(1700000000)
+
+		gauge, ok := collect(t)["rond_sdk_load_timestamp_seconds"].Data.(metricdata.Gauge[float64])
+		require.True(t, ok)
+		require.Len(t, gauge.DataPoints, 1)
+		require.Equal(t, float64(1700000000), gauge.DataPoints[0].Value)
+	})
+}
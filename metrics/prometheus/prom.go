@@ -27,12 +27,64 @@ func SetupMetrics(reg prometheus.Registerer) *metrics.Metrics {
 		Buckets:   []float64{1, 5, 10, 50, 100, 250, 500},
 	}, []string{"policy_name"})
 
+	decisions := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Prefix,
+		Name:      metrics.PolicyDecisionsMetricName,
+		Help:      "A counter of the policy decisions, by policy, matched path and decision (allow, deny or error).",
+	}, []string{"policy_name", "matched_path", "decision"})
+
+	responsePolicyDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Prefix,
+		Name:      metrics.ResponsePolicyEvalDurationMetricName,
+		Help:      "A histogram of the response policy evaluation durations in milliseconds, response body encoding included.",
+		Buckets:   []float64{1, 5, 10, 50, 100, 250, 500},
+	}, []string{"policy_name"})
+
+	inputUserFetchDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Prefix,
+		Name:      metrics.InputUserFetchDurationMetricName,
+		Help:      "A histogram of the user bindings and roles retrieval durations in milliseconds.",
+		Buckets:   []float64{1, 5, 10, 50, 100, 250, 500},
+	}, []string{"resource"})
+
+	mongoQueryDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Prefix,
+		Name:      metrics.MongoQueryDurationMetricName,
+		Help:      "A histogram of the MongoDB queries durations of the custom builtins in milliseconds.",
+		Buckets:   []float64{1, 5, 10, 50, 100, 250, 500},
+	}, []string{"operation", "collection"})
+
+	proxyDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Prefix,
+		Name:      metrics.ProxyRequestDurationMetricName,
+		Help:      "A histogram of the durations of the requests proxied to the upstream services in milliseconds.",
+		Buckets:   []float64{5, 10, 50, 100, 250, 500, 1000, 2500, 5000},
+	}, []string{"upstream", "status_code"})
+
+	sdkLoadTimestamp := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Prefix,
+		Name:      metrics.SDKLoadTimestampMetricName,
+		Help:      "The unix time of the last load of policies and OAS, not set until rond is ready.",
+	})
+
 	m := &metrics.Metrics{
-		PolicyEvaluationDurationMilliseconds: histogramVec{duration},
+		PolicyEvaluationDurationMilliseconds:         histogramVec{duration},
+		PolicyDecisionsTotal:                         counterVec{decisions},
+		ResponsePolicyEvaluationDurationMilliseconds: histogramVec{responsePolicyDuration},
+		InputUserFetchDurationMilliseconds:           histogramVec{inputUserFetchDuration},
+		MongoQueryDurationMilliseconds:               histogramVec{mongoQueryDuration},
+		ProxyRequestDurationMilliseconds:             histogramVec{proxyDuration},
+		SDKLoadTimestampSeconds:                      sdkLoadTimestamp,
 	}
 
 	reg.MustRegister(
 		duration,
+		decisions,
+		responsePolicyDuration,
+		inputUserFetchDuration,
+		mongoQueryDuration,
+		proxyDuration,
+		sdkLoadTimestamp,
 	)
 
 	return m
@@ -49,3 +101,11 @@ type observer struct {
 func (h histogramVec) With(labels metrics.Labels) metrics.Observer {
 	return observer{h.HistogramVec.With(prometheus.Labels(labels))}
 }
+
+type counterVec struct {
+	*prometheus.CounterVec
+}
+
+func (c counterVec) With(labels metrics.Labels) metrics.Counter {
+	return c.CounterVec.With(prometheus.Labels(labels))
+}
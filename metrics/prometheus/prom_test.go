@@ -57,5 +57,69 @@ func TestMetrics(t *testing.T) {
 
 			require.NoError(t, testutil.CollectAndCompare(policyDuration.HistogramVec, strings.NewReader(metadata+expected), "test_prefix_policy_evaluation_duration_milliseconds"))
 		})
+
+		t.Run("PolicyDecisionsTotal", func(t *testing.T) {
+			decisions, ok := m.PolicyDecisionsTotal.(counterVec)
+			require.True(t, ok)
+
+			labels := metrics.Labels{
+				"policy_name":  "myPolicyName",
+				"matched_path": "/users/:id",
+			}
+			for _, decision := range []string{metrics.DecisionAllow, metrics.DecisionAllow, metrics.DecisionDeny} {
+				labels["decision"] = decision
+				m.PolicyDecisionsTotal.With(labels).Inc()
+			}
+
+			expected := `
+			# HELP rond_policy_decisions_total A counter of the policy decisions, by policy, matched path and decision (allow, deny or error).
+			# TYPE rond_policy_decisions_total counter
+			rond_policy_decisions_total{decision="allow",matched_path="/users/:id",policy_name="myPolicyName"} 2
+			rond_policy_decisions_total{decision="deny",matched_path="/users/:id",policy_name="myPolicyName"} 1
+`
+			require.NoError(t, testutil.CollectAndCompare(decisions.CounterVec, strings.NewReader(expected)))
+		})
+
+		t.Run("histograms", func(t *testing.T) {
+			testCases := map[string]struct {
+				histogram metrics.HistogramVec
+				labels    metrics.Labels
+			}{
+				metrics.ResponsePolicyEvalDurationMetricName: {
+					histogram: m.ResponsePolicyEvaluationDurationMilliseconds,
+					labels:    metrics.Labels{"policy_name": "myPolicyName"},
+				},
+				metrics.InputUserFetchDurationMetricName: {
+					histogram: m.InputUserFetchDurationMilliseconds,
+					labels:    metrics.Labels{"resource": "bindings"},
+				},
+				metrics.MongoQueryDurationMetricName: {
+					histogram: m.MongoQueryDurationMilliseconds,
+					labels:    metrics.Labels{"operation": "find_one", "collection": "projects"},
+				},
+				metrics.ProxyRequestDurationMetricName: {
+					histogram: m.ProxyRequestDurationMilliseconds,
+					labels:    metrics.Labels{"upstream": "service:3000", "status_code": "200"},
+				},
+			}
+
+			for name, testCase := range testCases {
+				t.Run(name, func(t *testing.T) {
+					histogram, ok := testCase.histogram.(histogramVec)
+					require.True(t, ok)
+
+					testCase.histogram.With(testCase.labels).Observe(10)
+					require.Equal(t, 1, testutil.CollectAndCount(histogram.HistogramVec, "rond_"+name))
+				})
+			}
+		})
+
+		t.Run("SDKLoadTimestampSeconds", func(t *testing.T) {
+			gauge, ok := m.SDKLoadTimestampSeconds.(prometheus.Gauge)
+			require.True(t, ok)
+
+			m.SDKLoadTimestampSeconds.Set(1700000000)
+			require.Equal(t, float64(1700000000), testutil.ToFloat64(gauge))
+		})
 	})
 }
@@ -38,20 +38,51 @@ func (h *Hook) AllEntries() Entries {
 	return h.Entries
 }
 
-func New() (*metrics.Metrics, *Hook) {
-	duration := histogramVec{
-		Namespace: metrics.Prefix,
-		Name:      metrics.PolicyEvalDurationMetricName,
-		Labels:    []string{"policy_name"},
+// EntriesByName returns the recorded entries of the metric with the given name.
+func (h *Hook) EntriesByName(name string) Entries {
+	entries := Entries{}
+	for _, entry := range h.Entries {
+		if entry.Name == name {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
 
-		hook: &Hook{},
+func New() (*metrics.Metrics, *Hook) {
+	hook := &Hook{}
+	newHistogramVec := func(name string, labels ...string) histogramVec {
+		return histogramVec{
+			Namespace: metrics.Prefix,
+			Name:      name,
+			Labels:    labels,
+
+			hook: hook,
+		}
 	}
 
 	m := &metrics.Metrics{
-		PolicyEvaluationDurationMilliseconds: duration,
+		PolicyEvaluationDurationMilliseconds: newHistogramVec(metrics.PolicyEvalDurationMetricName, "policy_name"),
+		PolicyDecisionsTotal: counterVec{
+			Namespace: metrics.Prefix,
+			Name:      metrics.PolicyDecisionsMetricName,
+			Labels:    []string{"policy_name", "matched_path", "decision"},
+
+			hook: hook,
+		},
+		ResponsePolicyEvaluationDurationMilliseconds: newHistogramVec(metrics.ResponsePolicyEvalDurationMetricName, "policy_name"),
+		InputUserFetchDurationMilliseconds:           newHistogramVec(metrics.InputUserFetchDurationMetricName, "resource"),
+		MongoQueryDurationMilliseconds:               newHistogramVec(metrics.MongoQueryDurationMetricName, "operation", "collection"),
+		ProxyRequestDurationMilliseconds:             newHistogramVec(metrics.ProxyRequestDurationMetricName, "upstream", "status_code"),
+		SDKLoadTimestampSeconds: gauge{
+			Namespace: metrics.Prefix,
+			Name:      metrics.SDKLoadTimestampMetricName,
+
+			hook: hook,
+		},
 	}
 
-	return m, duration.hook
+	return m, hook
 }
 
 type histogramVec struct {
@@ -78,3 +109,42 @@ func (h histogramVec) With(labels metrics.Labels) metrics.Observer {
 
 	return observer{hook: h.hook}
 }
+
+type counterVec struct {
+	Namespace string
+	Name      string
+	Labels    []string
+
+	hook *Hook
+}
+
+type counter struct {
+	hook *Hook
+}
+
+func (c counter) Inc() {
+	c.hook.setValueToLastEntry(1)
+}
+
+func (c counterVec) With(labels metrics.Labels) metrics.Counter {
+	c.hook.Entries = append(c.hook.Entries, Entry{
+		Name:   c.Name,
+		Labels: labels,
+	})
+
+	return counter{hook: c.hook}
+}
+
+type gauge struct {
+	Namespace string
+	Name      string
+
+	hook *Hook
+}
+
+func (g gauge) Set(v float64) {
+	g.hook.Entries = append(g.hook.Entries, Entry{
+		Name:  g.Name,
+		Value: v,
+	})
+}
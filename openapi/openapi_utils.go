@@ -21,17 +21,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/http/httptest"
+	"net/url"
+	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rond-authz/rond/core"
 	"github.com/rond-authz/rond/internal/utils"
 	"github.com/rond-authz/rond/logging"
-
-	"github.com/uptrace/bunrouter"
 )
 
 const HTTPScheme = "http"
@@ -94,6 +92,9 @@ type OpenAPIPaths map[string]PathVerbs
 
 type OpenAPISpec struct {
 	Paths OpenAPIPaths `json:"paths"`
+
+	// unknownKeysIssues are found while deserializing the spec, see Validate.
+	unknownKeysIssues []ValidationIssue
 }
 
 func cleanWildcard(path string) string {
@@ -123,23 +124,8 @@ func (rMap RoutesMap) contains(path string, method string) bool {
 	return hasRoute
 }
 
-func createOasHandler(scopedMethodContent VerbConfig, oasPathCleaned string) func(http.ResponseWriter, *http.Request) {
-	permission := scopedMethodContent.PermissionV2
-	return func(w http.ResponseWriter, r *http.Request) {
-		header := w.Header()
-		header.Set("allow", permission.RequestFlow.PolicyName)
-		header.Set("resourceFilter.rowFilter.enabled", strconv.FormatBool(permission.RequestFlow.GenerateQuery))
-		header.Set("resourceFilter.rowFilter.headerKey", permission.RequestFlow.QueryOptions.HeaderName)
-		header.Set("responseFilter.policy", permission.ResponseFlow.PolicyName)
-		header.Set("options.enableResourcePermissionsMapOptimization", strconv.FormatBool(permission.Options.EnableResourcePermissionsMapOptimization))
-		header.Set("requestFlow.preventBodyLoad", strconv.FormatBool(permission.RequestFlow.PreventBodyLoad))
-		header.Set("options.ignoreTrailingSlash", strconv.FormatBool(permission.Options.IgnoreTrailingSlash))
-		header.Set("pathTemplate", oasPathCleaned)
-	}
-}
-
-func (oas *OpenAPISpec) PrepareOASRouter() (*bunrouter.CompatRouter, error) {
-	OASRouter := bunrouter.New().Compat()
+func (oas *OpenAPISpec) PrepareOASRouter() (*OASRouter, error) {
+	OASRouter := newOASRouter()
 	routeMap := oas.createRoutesMap()
 
 	configurationError := validateConfiguration(oas)
@@ -153,16 +139,19 @@ func (oas *OpenAPISpec) PrepareOASRouter() (*bunrouter.CompatRouter, error) {
 
 		for method, methodContent := range OASContent {
 			scopedMethod := strings.ToUpper(method)
-			handler := createOasHandler(methodContent, pathWithPathVariablesToColons)
 
 			if scopedMethod != strings.ToUpper(AllHTTPMethod) {
-				registerLaxPath(OASRouter, scopedMethod, methodContent, OASPathCleaned, handler)
+				if err := registerLaxPath(OASRouter, scopedMethod, methodContent, OASPathCleaned, pathWithPathVariablesToColons); err != nil {
+					return nil, err
+				}
 				continue
 			}
 
 			for _, method := range OasSupportedHTTPMethods {
 				if !routeMap.contains(OASPath, method) {
-					registerLaxPath(OASRouter, method, methodContent, OASPathCleaned, handler)
+					if err := registerLaxPath(OASRouter, method, methodContent, OASPathCleaned, pathWithPathVariablesToColons); err != nil {
+						return nil, err
+					}
 				}
 			}
 		}
@@ -171,8 +160,10 @@ func (oas *OpenAPISpec) PrepareOASRouter() (*bunrouter.CompatRouter, error) {
 	return OASRouter, nil
 }
 
-func registerLaxPath(OASRouter *bunrouter.CompatRouter, method string, methodContent VerbConfig, OASPathCleaned string, handler http.HandlerFunc) {
-	OASRouter.Handle(method, OASPathCleaned, handler)
+func registerLaxPath(OASRouter *OASRouter, method string, methodContent VerbConfig, OASPathCleaned, pathTemplate string) error {
+	if err := OASRouter.add(method, OASPathCleaned, pathTemplate, methodContent.PermissionV2); err != nil {
+		return err
+	}
 	if methodContent.PermissionV2 != nil && methodContent.PermissionV2.Options.IgnoreTrailingSlash {
 		slashLaxPathToRegister := OASPathCleaned
 		if strings.HasSuffix(OASPathCleaned, "/") {
@@ -180,65 +171,21 @@ func registerLaxPath(OASRouter *bunrouter.CompatRouter, method string, methodCon
 		} else {
 			slashLaxPathToRegister += "/"
 		}
-		OASRouter.Handle(method, slashLaxPathToRegister, handler)
+		return OASRouter.add(method, slashLaxPathToRegister, pathTemplate, methodContent.PermissionV2)
 	}
+	return nil
 }
 
 // FIXME: This is not a logic method of OAS, but could be a method of OASRouter
-func (oas *OpenAPISpec) FindPermission(OASRouter *bunrouter.CompatRouter, path string, method string) (core.RondConfig, RouterInfo, error) {
-	routerInfo := RouterInfo{
-		Method:        method,
-		RequestedPath: path,
-	}
-
-	recorder := httptest.NewRecorder()
-	responseReader := strings.NewReader("request-permissions")
-	request, err := http.NewRequest(method, path, responseReader)
+func (oas *OpenAPISpec) FindPermission(OASRouter *OASRouter, path string, method string) (core.RondConfig, RouterInfo, error) {
+	match, err := OASRouter.Match(method, path)
 	if err != nil {
-		return core.RondConfig{}, routerInfo, err
+		return core.RondConfig{}, match.RouterInfo, err
 	}
-	OASRouter.ServeHTTP(recorder, request)
-
-	if recorder.Code != http.StatusOK {
-		return core.RondConfig{}, routerInfo, fmt.Errorf("%w: %s %s", ErrNotFoundOASDefinition, utils.SanitizeString(method), utils.SanitizeString(path))
+	if match.RondConfig == nil {
+		return core.RondConfig{}, match.RouterInfo, nil
 	}
-
-	recorderResult := recorder.Result()
-	pathTemplate := recorderResult.Header.Get("pathTemplate")
-	routerInfo.MatchedPath = pathTemplate
-	rowFilterEnabled, err := strconv.ParseBool(recorderResult.Header.Get("resourceFilter.rowFilter.enabled"))
-	if err != nil {
-		return core.RondConfig{}, routerInfo, fmt.Errorf("error while parsing rowFilter.enabled: %s", err)
-	}
-	enableResourcePermissionsMapOptimization, err := strconv.ParseBool(recorderResult.Header.Get("options.enableResourcePermissionsMapOptimization"))
-	if err != nil {
-		return core.RondConfig{}, routerInfo, fmt.Errorf("error while parsing options.enableResourcePermissionsMapOptimization: %s", err)
-	}
-	ignoreTrailingSlash, err := strconv.ParseBool(recorderResult.Header.Get("options.ignoreTrailingSlash"))
-	if err != nil {
-		return core.RondConfig{}, routerInfo, fmt.Errorf("error while parsing options.ignoreTrailingSlash: %s", err)
-	}
-	preventRequestBodyLoad, err := strconv.ParseBool(recorderResult.Header.Get("requestFlow.preventBodyLoad"))
-	if err != nil {
-		return core.RondConfig{}, routerInfo, fmt.Errorf("error while parsing requestFlow.preventBodyLoad")
-	}
-	return core.RondConfig{
-		RequestFlow: core.RequestFlow{
-			PolicyName:      recorderResult.Header.Get("allow"),
-			GenerateQuery:   rowFilterEnabled,
-			PreventBodyLoad: preventRequestBodyLoad,
-			QueryOptions: core.QueryOptions{
-				HeaderName: recorderResult.Header.Get("resourceFilter.rowFilter.headerKey"),
-			},
-		},
-		ResponseFlow: core.ResponseFlow{
-			PolicyName: recorderResult.Header.Get("responseFilter.policy"),
-		},
-		Options: core.PermissionOptions{
-			EnableResourcePermissionsMapOptimization: enableResourcePermissionsMapOptimization,
-			IgnoreTrailingSlash:                      ignoreTrailingSlash,
-		},
-	}, routerInfo, nil
+	return *match.RondConfig, match.RouterInfo, nil
 }
 
 func newRondConfigFromPermissionV1(v1Permission *XPermission) *core.RondConfig {
@@ -281,19 +228,30 @@ func adaptOASSpec(spec *OpenAPISpec) {
 	}
 }
 
-func deserializeSpec(spec []byte, errorWrapper error) (*OpenAPISpec, error) {
+func deserializeSpec(client *http.Client, spec []byte, location *url.URL, errorWrapper error) (*OpenAPISpec, error) {
+	paths, err := loadSpecPaths(client, spec, location)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unmarshal error: %s", errorWrapper, err.Error())
+	}
+
 	var oas OpenAPISpec
-	if err := json.Unmarshal(spec, &oas); err != nil {
+	if err := json.Unmarshal(paths, &oas); err != nil {
 		return nil, fmt.Errorf("%w: unmarshal error: %s", errorWrapper, err.Error())
 	}
 
 	adaptOASSpec(&oas)
+	oas.unknownKeysIssues = findUnknownKeys(paths)
 
 	return &oas, nil
 }
 
-func fetchOpenAPI(log logging.Logger, url string) (*OpenAPISpec, error) {
-	resp, err := http.DefaultClient.Get(url)
+func fetchOpenAPI(log logging.Logger, client *http.Client, documentationURL string) (*OpenAPISpec, error) {
+	location, err := url.Parse(documentationURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRequestFailed, err)
+	}
+
+	resp, err := client.Get(documentationURL)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrRequestFailed, err)
 	}
@@ -311,24 +269,68 @@ func fetchOpenAPI(log logging.Logger, url string) (*OpenAPISpec, error) {
 	}
 
 	bodyBytes, _ := io.ReadAll(resp.Body)
-	return deserializeSpec(bodyBytes, ErrRequestFailed)
+	return deserializeSpec(client, bodyBytes, location, ErrRequestFailed)
 }
 
+// LoadOASFile loads the OpenAPI document from file, either JSON or YAML. The
+// relative $ref are resolved from the file directory, and only local files
+// can be referenced.
 func LoadOASFile(APIPermissionsFilePath string) (*OpenAPISpec, error) {
 	fileContentByte, err := utils.ReadFile(APIPermissionsFilePath)
 	if err != nil {
 		return nil, err
 	}
-	return deserializeSpec(fileContentByte, utils.ErrFileLoadFailed)
+	absolutePath, err := filepath.Abs(APIPermissionsFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", utils.ErrFileLoadFailed, err.Error())
+	}
+	return deserializeSpec(nil, fileContentByte, &url.URL{Path: filepath.ToSlash(absolutePath)}, utils.ErrFileLoadFailed)
 }
 
 type LoadOptions struct {
 	APIPermissionsFilePath string
 	TargetServiceOASPath   string
 	TargetServiceHost      string
+	// TargetServiceScheme defaults to HTTPScheme.
+	TargetServiceScheme string
+	// HTTPClient is used to fetch the OAS and the remote $ref from network,
+	// defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// AdditionalSources are merged with the OAS loaded from file or target service.
+	AdditionalSources []OASSource
 }
 
 func LoadOASFromFileOrNetwork(log logging.Logger, config LoadOptions) (*OpenAPISpec, error) {
+	oas, err := loadMainOAS(log, config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, source := range config.AdditionalSources {
+		sourceOAS, err := loadOASSource(log, config.httpClient(), source)
+		if err != nil {
+			return nil, err
+		}
+		if err := oas.Merge(sourceOAS, source.PathPrefix); err != nil {
+			return nil, err
+		}
+		log.WithFields(map[string]any{
+			"oasFilePath": source.FilePath,
+			"oasURL":      source.URL,
+			"pathPrefix":  source.PathPrefix,
+		}).Debug("OAS source merged")
+	}
+	return oas, nil
+}
+
+func (config LoadOptions) httpClient() *http.Client {
+	if config.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return config.HTTPClient
+}
+
+func loadMainOAS(log logging.Logger, config LoadOptions) (*OpenAPISpec, error) {
 	if config.APIPermissionsFilePath != "" {
 		log.WithField("oasFilePath", config.APIPermissionsFilePath).Debug("Attempt to load OAS from file")
 		oas, err := LoadOASFile(config.APIPermissionsFilePath)
@@ -344,28 +346,50 @@ func LoadOASFromFileOrNetwork(log logging.Logger, config LoadOptions) (*OpenAPIS
 
 	if config.TargetServiceOASPath != "" {
 		log.WithField("oasApiPath", config.TargetServiceOASPath).Debug("Attempt to load OAS from target service")
-		var oas *OpenAPISpec
-		documentationURL := fmt.Sprintf("%s://%s%s", HTTPScheme, config.TargetServiceHost, config.TargetServiceOASPath)
-		for {
-			fetchedOAS, err := fetchOpenAPI(log, documentationURL)
-			if err != nil {
-				log.WithFields(map[string]any{
-					"targetServiceHost": config.TargetServiceHost,
-					"targetOASPath":     config.TargetServiceOASPath,
-					"error":             map[string]any{"message": err.Error()},
-				}).Warn("failed OAS fetch, retry in 1s")
-				time.Sleep(1 * time.Second)
-				continue
-			}
-			oas = fetchedOAS
-			break
+		scheme := HTTPScheme
+		if config.TargetServiceScheme != "" {
+			scheme = config.TargetServiceScheme
 		}
-		return oas, nil
+		documentationURL := fmt.Sprintf("%s://%s%s", scheme, config.TargetServiceHost, config.TargetServiceOASPath)
+		return fetchOpenAPIWithRetry(log, config.httpClient(), documentationURL), nil
+	}
+
+	if len(config.AdditionalSources) > 0 {
+		return &OpenAPISpec{Paths: OpenAPIPaths{}}, nil
 	}
 
 	return nil, fmt.Errorf("missing openapi config: one of TargetServiceOASPath or APIPermissionsFilePath is required")
 }
 
+func loadOASSource(log logging.Logger, client *http.Client, source OASSource) (*OpenAPISpec, error) {
+	if source.FilePath != "" {
+		log.WithField("oasFilePath", source.FilePath).Debug("Attempt to load OAS source from file")
+		return LoadOASFile(source.FilePath)
+	}
+	if source.URL != "" {
+		log.WithField("oasURL", source.URL).Debug("Attempt to load OAS source from network")
+		return fetchOpenAPIWithRetry(log, client, source.URL), nil
+	}
+	return nil, fmt.Errorf("%w: one of FilePath or URL is required", ErrInvalidOASSource)
+}
+
+// fetchOpenAPIWithRetry fetches the OAS until it succeeds, since the service
+// exposing it may not be ready yet.
+func fetchOpenAPIWithRetry(log logging.Logger, client *http.Client, documentationURL string) *OpenAPISpec {
+	for {
+		fetchedOAS, err := fetchOpenAPI(log, client, documentationURL)
+		if err != nil {
+			log.WithFields(map[string]any{
+				"documentationURL": documentationURL,
+				"error":            map[string]any{"message": err.Error()},
+			}).Warn("failed OAS fetch, retry in 1s")
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		return fetchedOAS
+	}
+}
+
 func WithXPermission(requestContext context.Context, permission *core.RondConfig) context.Context {
 	return context.WithValue(requestContext, XPermissionKey{}, permission)
 }
@@ -18,9 +18,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/utils"
 	"github.com/rond-authz/rond/logging"
 
 	"github.com/stretchr/testify/require"
@@ -30,6 +36,62 @@ import (
 func TestFetchOpenAPI(t *testing.T) {
 	log := logging.NewNoOpLogger()
 
+	t.Run("fetches yaml OAS resolving remote path items references", func(t *testing.T) {
+		defer gock.Off()
+
+		gock.New("http://localhost:3000").
+			Get("/documentation/yaml").
+			Reply(200).
+			BodyString(`openapi: 3.0.3
+info:
+  title: remote OAS
+  version: 1.0.0
+paths:
+  /users/{userId}:
+    $ref: "./oasUserPathItem.yaml"
+`)
+		gock.New("http://localhost:3000").
+			Get("/documentation/oasUserPathItem.yaml").
+			Reply(200).
+			File("../mocks/oasUserPathItem.yaml")
+
+		openApiSpec, err := fetchOpenAPI(log, http.DefaultClient, "http://localhost:3000/documentation/yaml")
+
+		require.True(t, gock.IsDone(), "Mock has not been invoked")
+		require.NoError(t, err)
+		require.Equal(t, OpenAPIPaths{
+			"/users/{userId}": PathVerbs{
+				"get": VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_user"}},
+				},
+				"delete": VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_user_delete"}},
+				},
+			},
+		}, openApiSpec.Paths)
+	})
+
+	t.Run("fails resolving path items references out of the document origin", func(t *testing.T) {
+		for _, ref := range []string{
+			"file:///etc/passwd",
+			"http://other-host:3000/documentation/paths.yaml#/users",
+			"https://localhost:3000/documentation/paths.yaml#/users",
+		} {
+			t.Run(ref, func(t *testing.T) {
+				defer gock.Off()
+
+				gock.New("http://localhost:3000").
+					Get("/documentation/json").
+					Reply(200).
+					JSON(map[string]any{"paths": map[string]any{"/users": map[string]any{"$ref": ref}}})
+
+				_, err := fetchOpenAPI(log, http.DefaultClient, "http://localhost:3000/documentation/json")
+				require.ErrorIs(t, err, ErrRequestFailed)
+				require.ErrorContains(t, err, fmt.Sprintf("reference %s out of the document origin", ref))
+			})
+		}
+	})
+
 	t.Run("fetches json OAS", func(t *testing.T) {
 		defer gock.Off()
 
@@ -40,7 +102,7 @@ func TestFetchOpenAPI(t *testing.T) {
 
 		url := "http://localhost:3000/documentation/json"
 
-		openApiSpec, err := fetchOpenAPI(log, url)
+		openApiSpec, err := fetchOpenAPI(log, http.DefaultClient, url)
 
 		require.True(t, gock.IsDone(), "Mock has not been invoked")
 		require.NoError(t, err, "unexpected error")
@@ -94,7 +156,7 @@ func TestFetchOpenAPI(t *testing.T) {
 	t.Run("request execution fails for invalid URL", func(t *testing.T) {
 		url := "http://invalidUrl.com"
 
-		_, err := fetchOpenAPI(log, url)
+		_, err := fetchOpenAPI(log, http.DefaultClient, url)
 
 		t.Logf("Expected error occurred: %s", err.Error())
 		require.True(t, errors.Is(err, ErrRequestFailed), "unexpected error")
@@ -103,7 +165,7 @@ func TestFetchOpenAPI(t *testing.T) {
 	t.Run("request execution fails for invalid URL syntax", func(t *testing.T) {
 		url := "	http://url with a tab.com"
 
-		_, err := fetchOpenAPI(log, url)
+		_, err := fetchOpenAPI(log, http.DefaultClient, url)
 
 		t.Logf("Expected error occurred: %s", err.Error())
 		require.True(t, errors.Is(err, ErrRequestFailed), "unexpected error")
@@ -119,7 +181,7 @@ func TestFetchOpenAPI(t *testing.T) {
 
 		url := "http://localhost:3000/documentation/json"
 
-		_, err := fetchOpenAPI(log, url)
+		_, err := fetchOpenAPI(log, http.DefaultClient, url)
 
 		t.Logf("Expected error occurred: %s", err.Error())
 		require.True(t, errors.Is(err, ErrRequestFailed), "unexpected error")
@@ -134,7 +196,7 @@ func TestFetchOpenAPI(t *testing.T) {
 
 		url := "http://localhost:3000/documentation/json"
 
-		_, err := fetchOpenAPI(log, url)
+		_, err := fetchOpenAPI(log, http.DefaultClient, url)
 
 		t.Logf("Expected error occurred: %s", err.Error())
 		require.True(t, errors.Is(err, ErrRequestFailed), "unexpected error")
@@ -171,6 +233,79 @@ func TestLoadOASFile(t *testing.T) {
 		}, openAPIFile.Paths)
 	})
 
+	t.Run("get oas config from YAML file resolving path items references", func(t *testing.T) {
+		openAPIFile, err := LoadOASFile("../mocks/oasWithRefs.yaml")
+		require.NoError(t, err)
+		require.Equal(t, OpenAPIPaths{
+			"/users/": PathVerbs{
+				"get": VerbConfig{
+					PermissionV2: &core.RondConfig{
+						RequestFlow:  core.RequestFlow{PolicyName: "allow", GenerateQuery: true},
+						ResponseFlow: core.ResponseFlow{PolicyName: "filter_response"},
+					},
+				},
+			},
+			"/users/{userId}": PathVerbs{
+				"get": VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_user"}},
+				},
+				"delete": VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_user_delete"}},
+				},
+			},
+			"/projects/": PathVerbs{
+				"all": VerbConfig{
+					PermissionV2: &core.RondConfig{
+						RequestFlow: core.RequestFlow{PolicyName: "allow_projects"},
+						Options:     core.PermissionOptions{IgnoreTrailingSlash: true},
+					},
+				},
+			},
+		}, openAPIFile.Paths)
+	})
+
+	t.Run("get oas config from YAML file ignoring dangling references out of path items", func(t *testing.T) {
+		openAPIFile, err := LoadOASFile("../mocks/oasWithDanglingSchemaRef.yaml")
+		require.NoError(t, err)
+		require.Equal(t, OpenAPIPaths{
+			"/users/": PathVerbs{
+				"get": VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow"}},
+				},
+			},
+			"/users/{userId}": PathVerbs{
+				"get": VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_user"}},
+				},
+				"delete": VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_user_delete"}},
+				},
+			},
+			"/orders/": PathVerbs{
+				"get": VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_orders"}},
+				},
+			},
+		}, openAPIFile.Paths)
+	})
+
+	t.Run("fail for path item reference to a remote document", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "oas.yaml")
+		require.NoError(t, os.WriteFile(filePath, []byte(`paths:
+  /users:
+    $ref: "http://localhost:3000/documentation/paths.yaml#/users"
+`), 0600))
+
+		_, err := LoadOASFile(filePath)
+		require.ErrorIs(t, err, utils.ErrFileLoadFailed)
+		require.ErrorContains(t, err, "out of the document origin")
+	})
+
+	t.Run("fail for not existing path item reference", func(t *testing.T) {
+		_, err := LoadOASFile("../mocks/oasWithMissingRef.yaml")
+		require.ErrorIs(t, err, utils.ErrFileLoadFailed)
+	})
+
 	t.Run("fail for invalid filePath", func(t *testing.T) {
 		_, err := LoadOASFile("./notExistingFilePath.json")
 
@@ -216,6 +351,58 @@ func TestLoadOAS(t *testing.T) {
 		}, openApiSpec.Paths)
 	})
 
+	t.Run("expect to fetch oasApiSpec from API over TLS", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/documentation/json", r.URL.Path)
+			http.ServeFile(w, r, "../mocks/simplifiedMock.json")
+		}))
+		defer server.Close()
+		serverURL, err := url.Parse(server.URL)
+		require.NoError(t, err)
+
+		openApiSpec, err := LoadOASFromFileOrNetwork(log, LoadOptions{
+			TargetServiceHost:    serverURL.Host,
+			TargetServiceOASPath: "/documentation/json",
+			TargetServiceScheme:  "https",
+			HTTPClient:           server.Client(),
+		})
+		require.NoError(t, err, "unexpected error")
+		require.Contains(t, openApiSpec.Paths, "/assert-user")
+	})
+
+	t.Run("expect to fetch path item references over TLS with the configured client", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/documentation/json":
+				w.Write([]byte(`{"openapi":"3.0.3","paths":{"/users":{"$ref":"paths.json#/users"}}}`))
+			case "/documentation/paths.json":
+				w.Write([]byte(`{"users":{"get":{"x-rond":{"requestFlow":{"policyName":"allow"}}}}}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+		serverURL, err := url.Parse(server.URL)
+		require.NoError(t, err)
+
+		openApiSpec, err := LoadOASFromFileOrNetwork(log, LoadOptions{
+			TargetServiceHost:    serverURL.Host,
+			TargetServiceOASPath: "/documentation/json",
+			TargetServiceScheme:  "https",
+			HTTPClient:           server.Client(),
+		})
+		require.NoError(t, err)
+		require.Equal(t, OpenAPIPaths{
+			"/users": PathVerbs{
+				"get": VerbConfig{
+					PermissionV2: &core.RondConfig{
+						RequestFlow: core.RequestFlow{PolicyName: "allow"},
+					},
+				},
+			},
+		}, openApiSpec.Paths)
+	})
+
 	t.Run("expect to fetch oasApiSpec from API", func(t *testing.T) {
 		options := LoadOptions{
 			TargetServiceHost:    "localhost:3000",
@@ -309,7 +496,7 @@ func TestFindPermission(t *testing.T) {
 
 		found, matchedPath, err := oas.FindPermission(OASRouter, "/not/existing/route", "/invalid-method")
 		require.Empty(t, core.RondConfig{}, found)
-		require.EqualError(t, err, "net/http: invalid method \"/invalid-method\"")
+		require.EqualError(t, err, fmt.Sprintf("%s: /invalid-method /not/existing/route", ErrNotFoundOASDefinition))
 		require.Equal(t, RouterInfo{
 			Method:        "/invalid-method",
 			RequestedPath: "/not/existing/route",
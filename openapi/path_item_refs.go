@@ -0,0 +1,176 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/invopop/yaml"
+)
+
+// The OpenAPI documents are not loaded with the kin-openapi loader, since it
+// resolves every $ref of the document and fails on the dangling ones (e.g. the
+// schemas referencing missing components in mocks/oasWithDanglingSchemaRef.yaml),
+// while rond needs only the path items.
+//
+// The references are followed only on the origin of the document containing
+// them: local files for the documents read from file, and the same scheme and
+// host for the fetched ones.
+
+// maxPathItemRefDepth limits the chain of path items referencing other path items.
+const maxPathItemRefDepth = 10
+
+// loadSpecPaths loads the OpenAPI document, either JSON or YAML, resolving the
+// path items $ref (external files included) and returns its paths encoded in JSON.
+// The other references are not resolved, since only the path items are used by rond.
+// The remote references are fetched with the client, which is not used for the
+// documents read from file.
+func loadSpecPaths(client *http.Client, spec []byte, location *url.URL) ([]byte, error) {
+	if len(bytes.TrimSpace(spec)) == 0 {
+		return nil, errors.New("empty document")
+	}
+
+	document, err := yaml.YAMLToJSON(spec)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Paths map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, err
+	}
+
+	for path, pathItem := range doc.Paths {
+		resolvedPathItem, err := resolvePathItem(client, pathItem, document, location, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed path %s resolution: %w", path, err)
+		}
+		doc.Paths[path] = resolvedPathItem
+	}
+	return json.Marshal(doc)
+}
+
+// resolvePathItem returns the path item referenced with $ref, if any. The reference
+// is relative to the location of the document containing the path item.
+func resolvePathItem(client *http.Client, pathItem json.RawMessage, document []byte, location *url.URL, depth int) (json.RawMessage, error) {
+	var reference struct {
+		Ref string `json:"$ref"`
+	}
+	if err := json.Unmarshal(pathItem, &reference); err != nil {
+		return nil, err
+	}
+	if reference.Ref == "" {
+		return pathItem, nil
+	}
+	if depth >= maxPathItemRefDepth {
+		return nil, fmt.Errorf("too many nested references resolving %s", reference.Ref)
+	}
+
+	refURL, err := url.Parse(reference.Ref)
+	if err != nil {
+		return nil, err
+	}
+	if location != nil {
+		refURL = location.ResolveReference(refURL)
+	}
+
+	documentURL := *refURL
+	documentURL.Fragment = ""
+	documentURL.RawFragment = ""
+	if !strings.HasPrefix(reference.Ref, "#") {
+		if !isSameOrigin(location, &documentURL) {
+			return nil, fmt.Errorf("reference %s out of the document origin", reference.Ref)
+		}
+		spec, err := readSpecDocument(client, &documentURL)
+		if err != nil {
+			return nil, err
+		}
+		if document, err = yaml.YAMLToJSON(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	referencedPathItem, err := findJSONPointer(document, refURL.Fragment)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", reference.Ref, err)
+	}
+	return resolvePathItem(client, referencedPathItem, document, &documentURL, depth+1)
+}
+
+// findJSONPointer returns the value of the document at the JSON pointer.
+func findJSONPointer(document []byte, pointer string) (json.RawMessage, error) {
+	value := json.RawMessage(document)
+	if pointer == "" || pointer == "/" {
+		return value, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(value, &object); err != nil {
+			return nil, fmt.Errorf("invalid pointer %s", pointer)
+		}
+		var ok bool
+		if value, ok = object[token]; !ok {
+			return nil, fmt.Errorf("pointer %s not found", pointer)
+		}
+	}
+	return value, nil
+}
+
+// isSameOrigin reports whether the referenced document can be read from the
+// document at location: a local file references only local files, while a
+// fetched document references only documents with its same scheme and host.
+func isSameOrigin(location, reference *url.URL) bool {
+	if location == nil {
+		return false
+	}
+	switch location.Scheme {
+	case "", "file":
+		return (reference.Scheme == "" || reference.Scheme == "file") && reference.Host == ""
+	case "http", "https":
+		return reference.Scheme == location.Scheme && strings.EqualFold(reference.Host, location.Host)
+	default:
+		return false
+	}
+}
+
+func readSpecDocument(client *http.Client, location *url.URL) ([]byte, error) {
+	switch location.Scheme {
+	case "http", "https":
+		resp, err := client.Get(location.String())
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("invalid status code %d reading %s", resp.StatusCode, location)
+		}
+		return io.ReadAll(resp.Body)
+	case "", "file":
+		return os.ReadFile(filepath.FromSlash(location.Path))
+	default:
+		return nil, fmt.Errorf("unsupported reference %s", location)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/utils"
+)
+
+// OASRouter is the route table built from the OAS paths. For each HTTP method it holds
+// a tree of path segments, where static segments take precedence over path parameters
+// and path parameters take precedence over wildcards.
+type OASRouter struct {
+	trees map[string]*routeNode
+}
+
+// RouteMatch is the result of a successful route lookup.
+type RouteMatch struct {
+	RondConfig *core.RondConfig
+	RouterInfo RouterInfo
+	// PathParams contains the path parameters values, as found in the requested path.
+	// The value matched by a wildcard is set with the `param` key.
+	PathParams map[string]string
+}
+
+type route struct {
+	rondConfig   *core.RondConfig
+	pathTemplate string
+	paramNames   []string
+	wildcardName string
+}
+
+type routeNode struct {
+	static   map[string]*routeNode
+	param    *routeNode
+	route    *route
+	wildcard *route
+}
+
+func newOASRouter() *OASRouter {
+	return &OASRouter{trees: map[string]*routeNode{}}
+}
+
+// add registers the route for the method. Registering twice the same route overrides
+// the previous configuration.
+func (r *OASRouter) add(method, path, pathTemplate string, rondConfig *core.RondConfig) error {
+	root, ok := r.trees[method]
+	if !ok {
+		root = &routeNode{}
+		r.trees[method] = root
+	}
+
+	segments := splitPath(path)
+	current := root
+	newRoute := &route{rondConfig: rondConfig, pathTemplate: pathTemplate}
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, "*"):
+			if i != len(segments)-1 {
+				return fmt.Errorf("invalid path %s: wildcard must be the last path segment", path)
+			}
+			newRoute.wildcardName = segment[1:]
+			current.wildcard = newRoute
+			return nil
+		case strings.HasPrefix(segment, ":"):
+			if current.param == nil {
+				current.param = &routeNode{}
+			}
+			newRoute.paramNames = append(newRoute.paramNames, segment[1:])
+			current = current.param
+		default:
+			if current.static == nil {
+				current.static = map[string]*routeNode{}
+			}
+			child, ok := current.static[segment]
+			if !ok {
+				child = &routeNode{}
+				current.static[segment] = child
+			}
+			current = child
+		}
+	}
+	current.route = newRoute
+	return nil
+}
+
+// Match looks up the route registered for the method and path.
+// It returns an ErrNotFoundOASDefinition error if no route matches.
+func (r *OASRouter) Match(method, path string) (RouteMatch, error) {
+	routerInfo := RouterInfo{
+		Method:        method,
+		RequestedPath: path,
+	}
+
+	lookupPath, err := lookupPath(path)
+	if err != nil {
+		return RouteMatch{RouterInfo: routerInfo}, err
+	}
+
+	root, ok := r.trees[method]
+	if !ok || !strings.HasPrefix(lookupPath, "/") {
+		return RouteMatch{RouterInfo: routerInfo}, notFoundError(method, path)
+	}
+
+	segments := splitPath(lookupPath)
+	var paramValues []string
+	matchedRoute, wildcardValue := root.match(segments, &paramValues)
+	if matchedRoute == nil {
+		return RouteMatch{RouterInfo: routerInfo}, notFoundError(method, path)
+	}
+
+	routerInfo.MatchedPath = matchedRoute.pathTemplate
+	match := RouteMatch{
+		RondConfig: matchedRoute.rondConfig,
+		RouterInfo: routerInfo,
+	}
+	if len(matchedRoute.paramNames) > 0 || matchedRoute.wildcardName != "" {
+		match.PathParams = make(map[string]string, len(matchedRoute.paramNames)+1)
+		for i, name := range matchedRoute.paramNames {
+			match.PathParams[name] = paramValues[i]
+		}
+		if matchedRoute.wildcardName != "" {
+			match.PathParams[matchedRoute.wildcardName] = wildcardValue
+		}
+	}
+	return match, nil
+}
+
+// match walks the tree backtracking when a branch does not lead to a route.
+// Empty segments are matched as the previous http router did: an empty
+// segment followed by other segments is matched by a route ending with a path
+// parameter, whose value is the last segment of the path, while a trailing
+// empty segment is left to wildcards, which match any remainder of the path
+// after the slash, even if empty.
+func (n *routeNode) match(segments []string, paramValues *[]string) (*route, string) {
+	if len(segments) == 0 {
+		return n.route, ""
+	}
+
+	segment := segments[0]
+	if child, ok := n.static[segment]; ok {
+		if found, wildcardValue := child.match(segments[1:], paramValues); found != nil {
+			return found, wildcardValue
+		}
+	}
+
+	if n.param != nil {
+		switch {
+		case segment != "":
+			*paramValues = append(*paramValues, segment)
+			if found, wildcardValue := n.param.match(segments[1:], paramValues); found != nil {
+				return found, wildcardValue
+			}
+			*paramValues = (*paramValues)[:len(*paramValues)-1]
+		case len(segments) > 1 && n.param.route != nil:
+			*paramValues = append(*paramValues, segments[len(segments)-1])
+			return n.param.route, ""
+		}
+	}
+
+	if n.wildcard != nil {
+		return n.wildcard, strings.Join(segments, "/")
+	}
+	return nil, ""
+}
+
+// splitPath returns the path segments, without the leading slash.
+// A trailing slash produces a final empty segment, so that the root path is
+// matched by a wildcard as any other path ending with a slash.
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// lookupPath returns the escaped path to match, parsing it as URL only if
+// it contains characters with a special meaning.
+func lookupPath(path string) (string, error) {
+	if !strings.ContainsAny(path, "%?#") && !strings.HasPrefix(path, "//") {
+		return path, nil
+	}
+
+	parsedURL, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+	if parsedURL.RawPath != "" {
+		return parsedURL.RawPath, nil
+	}
+	return parsedURL.Path, nil
+}
+
+func notFoundError(method, path string) error {
+	return fmt.Errorf("%w: %s %s", ErrNotFoundOASDefinition, utils.SanitizeString(method), utils.SanitizeString(path))
+}
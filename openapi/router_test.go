@@ -0,0 +1,316 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rond-authz/rond/core"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bunrouter"
+)
+
+func TestOASRouterMatch(t *testing.T) {
+	oas := prepareOASFromFile(t, "../mocks/nestedPathsConfig.json")
+	router, err := oas.PrepareOASRouter()
+	require.NoError(t, err)
+
+	t.Run("returns rond config and path params", func(t *testing.T) {
+		match, err := router.Match(http.MethodGet, "/foo/bar/barId")
+		require.NoError(t, err)
+		require.Equal(t, "foo_bar_params", match.RondConfig.RequestFlow.PolicyName)
+		require.Equal(t, "/foo/bar/:params", match.RouterInfo.MatchedPath)
+		require.Equal(t, map[string]string{"params": "barId"}, match.PathParams)
+	})
+
+	t.Run("returns wildcard value as path param", func(t *testing.T) {
+		match, err := router.Match(http.MethodGet, "/foo/bar/barId/another-params-not-configured")
+		require.NoError(t, err)
+		require.Equal(t, "/foo/bar/*", match.RouterInfo.MatchedPath)
+		require.Equal(t, map[string]string{"param": "barId/another-params-not-configured"}, match.PathParams)
+	})
+
+	t.Run("static routes do not have path params", func(t *testing.T) {
+		match, err := router.Match(http.MethodGet, "/foo/bar/nested")
+		require.NoError(t, err)
+		require.Equal(t, "/foo/bar/nested", match.RouterInfo.MatchedPath)
+		require.Nil(t, match.PathParams)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		match, err := router.Match(http.MethodGet, "/not/existing/route")
+		require.ErrorIs(t, err, ErrNotFoundOASDefinition)
+		require.Nil(t, match.RondConfig)
+		require.Equal(t, RouterInfo{Method: http.MethodGet, RequestedPath: "/not/existing/route"}, match.RouterInfo)
+	})
+}
+
+func TestOASRouterPrecedence(t *testing.T) {
+	router := newOASRouter()
+	for path, policy := range map[string]string{
+		"/":                       "root",
+		"/*param":                 "root_wildcard",
+		"/users/:userId":          "user",
+		"/users/me":               "me",
+		"/users/:userId/posts":    "user_posts",
+		"/users/me/settings/*all": "me_settings",
+		"/users/:userId/*param":   "user_wildcard",
+	} {
+		require.NoError(t, router.add(http.MethodGet, path, path, &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: policy}}))
+	}
+
+	testCases := []struct {
+		path           string
+		expectedPolicy string
+		expectedParams map[string]string
+	}{
+		{path: "/", expectedPolicy: "root"},
+		{path: "/other", expectedPolicy: "root_wildcard", expectedParams: map[string]string{"param": "other"}},
+		{path: "/users/me", expectedPolicy: "me"},
+		{path: "/users/piero", expectedPolicy: "user", expectedParams: map[string]string{"userId": "piero"}},
+		{path: "/users/me/posts", expectedPolicy: "user_posts", expectedParams: map[string]string{"userId": "me"}},
+		{path: "/users/me/settings/", expectedPolicy: "me_settings", expectedParams: map[string]string{"all": ""}},
+		{path: "/users/me/other", expectedPolicy: "user_wildcard", expectedParams: map[string]string{"userId": "me", "param": "other"}},
+		{path: "/users/", expectedPolicy: "root_wildcard", expectedParams: map[string]string{"param": "users/"}},
+		{path: "/users//", expectedPolicy: "user", expectedParams: map[string]string{"userId": ""}},
+		{path: "/users//other", expectedPolicy: "user", expectedParams: map[string]string{"userId": "other"}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			match, err := router.Match(http.MethodGet, testCase.path)
+			require.NoError(t, err)
+			require.Equal(t, testCase.expectedPolicy, match.RondConfig.RequestFlow.PolicyName)
+			require.Equal(t, testCase.expectedParams, match.PathParams)
+		})
+	}
+
+	t.Run("wildcard must be the last segment", func(t *testing.T) {
+		err := router.add(http.MethodGet, "/invalid/*param/path", "/invalid/*/path", &core.RondConfig{})
+		require.EqualError(t, err, "invalid path /invalid/*param/path: wildcard must be the last path segment")
+	})
+}
+
+// TestOASRouterMatchesHTTPRouter checks that the route table resolves the
+// same configuration as the previous http router for every mock spec.
+func TestOASRouterMatchesHTTPRouter(t *testing.T) {
+	specFiles, err := filepath.Glob("../mocks/*.json")
+	require.NoError(t, err)
+
+	for _, specFile := range specFiles {
+		oas, err := LoadOASFile(specFile)
+		if err != nil || len(oas.Paths) == 0 {
+			continue
+		}
+		router, err := oas.PrepareOASRouter()
+		if err != nil {
+			continue
+		}
+		httpRouter, ok := tryPrepareHTTPRouter(oas)
+		if !ok {
+			continue
+		}
+
+		t.Run(filepath.Base(specFile), func(t *testing.T) {
+			for _, path := range samplePaths(oas) {
+				for _, method := range OasSupportedHTTPMethods {
+					expected, expectedErr := findPermissionWithHTTPRouter(httpRouter, path, method)
+					actual, _, actualErr := oas.FindPermission(router, path, method)
+					if expectedErr != nil {
+						require.ErrorIs(t, actualErr, ErrNotFoundOASDefinition, "%s %s", method, path)
+						continue
+					}
+					require.NoError(t, actualErr, "%s %s", method, path)
+					require.Equal(t, expected, actual, "%s %s", method, path)
+				}
+			}
+		})
+	}
+}
+
+// tryPrepareHTTPRouter prepares the previous http router, which panics on
+// conflicting routes the route table instead accepts.
+func tryPrepareHTTPRouter(oas *OpenAPISpec) (router *bunrouter.CompatRouter, ok bool) {
+	defer func() {
+		if recover() != nil {
+			router, ok = nil, false
+		}
+	}()
+	return prepareHTTPRouter(oas), true
+}
+
+// samplePaths returns, for each path of the spec, requests filling the path
+// parameters with both a value and an empty segment, followed by suffixes
+// with empty segments and extra segments.
+func samplePaths(oas *OpenAPISpec) []string {
+	suffixes := []string{"", "/", "//", "/extra", "//extra", "/extra/"}
+	paths := []string{"/", "//", "/extra"}
+	for OASPath := range oas.Paths {
+		for _, paramValue := range []string{"value", ""} {
+			segments := strings.Split(cleanWildcard(ConvertPathVariablesToColons(OASPath)), "/")
+			for i, segment := range segments {
+				if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+					segments[i] = paramValue
+				}
+			}
+			path := strings.Join(segments, "/")
+			for _, suffix := range suffixes {
+				paths = append(paths, path+suffix)
+			}
+		}
+	}
+	return paths
+}
+
+var benchmarkPaths = []struct {
+	method string
+	path   string
+}{
+	{method: http.MethodGet, path: "/foo/bar/barId"},
+	{method: http.MethodGet, path: "/foo/bar/nested/case/really/nested"},
+	{method: http.MethodPatch, path: "/foo/simple"},
+	{method: http.MethodPut, path: "/test/all/verb"},
+	{method: http.MethodGet, path: "/with/trailing/slash"},
+	{method: http.MethodGet, path: "/not/existing/route"},
+}
+
+func BenchmarkFindPermission(b *testing.B) {
+	oas, err := LoadOASFile("../mocks/nestedPathsConfig.json")
+	require.NoError(b, err)
+	router, err := oas.PrepareOASRouter()
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, benchmarkPath := range benchmarkPaths {
+			//#nosec G104 -- not found errors are expected
+			oas.FindPermission(router, benchmarkPath.path, benchmarkPath.method)
+		}
+	}
+}
+
+// BenchmarkFindPermissionHTTPRouter measures the previous implementation, which
+// served a request into an http router and decoded the configuration from the
+// response headers, to compare it with the route table lookup.
+func BenchmarkFindPermissionHTTPRouter(b *testing.B) {
+	oas, err := LoadOASFile("../mocks/nestedPathsConfig.json")
+	require.NoError(b, err)
+	router := prepareHTTPRouter(oas)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, benchmarkPath := range benchmarkPaths {
+			//#nosec G104 -- not found errors are expected
+			findPermissionWithHTTPRouter(router, benchmarkPath.path, benchmarkPath.method)
+		}
+	}
+}
+
+func prepareHTTPRouter(oas *OpenAPISpec) *bunrouter.CompatRouter {
+	router := bunrouter.New().Compat()
+	routeMap := oas.createRoutesMap()
+	for OASPath, OASContent := range oas.Paths {
+		pathWithPathVariablesToColons := ConvertPathVariablesToColons(OASPath)
+		OASPathCleaned := cleanWildcard(pathWithPathVariablesToColons)
+		for method, methodContent := range OASContent {
+			permission := methodContent.PermissionV2
+			if permission == nil {
+				permission = &core.RondConfig{}
+			}
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				header := w.Header()
+				header.Set("allow", permission.RequestFlow.PolicyName)
+				header.Set("resourceFilter.rowFilter.enabled", strconv.FormatBool(permission.RequestFlow.GenerateQuery))
+				header.Set("resourceFilter.rowFilter.headerKey", permission.RequestFlow.QueryOptions.HeaderName)
+				header.Set("responseFilter.policy", permission.ResponseFlow.PolicyName)
+				header.Set("options.enableResourcePermissionsMapOptimization", strconv.FormatBool(permission.Options.EnableResourcePermissionsMapOptimization))
+				header.Set("requestFlow.preventBodyLoad", strconv.FormatBool(permission.RequestFlow.PreventBodyLoad))
+				header.Set("options.ignoreTrailingSlash", strconv.FormatBool(permission.Options.IgnoreTrailingSlash))
+				header.Set("pathTemplate", pathWithPathVariablesToColons)
+			}
+			methods := []string{strings.ToUpper(method)}
+			if strings.EqualFold(method, AllHTTPMethod) {
+				methods = []string{}
+				for _, supportedMethod := range OasSupportedHTTPMethods {
+					if !routeMap.contains(OASPath, supportedMethod) {
+						methods = append(methods, supportedMethod)
+					}
+				}
+			}
+			for _, method := range methods {
+				router.Handle(method, OASPathCleaned, handler)
+				if permission.Options.IgnoreTrailingSlash {
+					if strings.HasSuffix(OASPathCleaned, "/") {
+						router.Handle(method, strings.TrimSuffix(OASPathCleaned, "/"), handler)
+					} else {
+						router.Handle(method, OASPathCleaned+"/", handler)
+					}
+				}
+			}
+		}
+	}
+	return router
+}
+
+func findPermissionWithHTTPRouter(router *bunrouter.CompatRouter, path, method string) (core.RondConfig, error) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(method, path, strings.NewReader("request-permissions"))
+	if err != nil {
+		return core.RondConfig{}, err
+	}
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		return core.RondConfig{}, fmt.Errorf("%w: %s %s", ErrNotFoundOASDefinition, method, path)
+	}
+
+	header := recorder.Result().Header
+	rowFilterEnabled, err := strconv.ParseBool(header.Get("resourceFilter.rowFilter.enabled"))
+	if err != nil {
+		return core.RondConfig{}, err
+	}
+	enableResourcePermissionsMapOptimization, err := strconv.ParseBool(header.Get("options.enableResourcePermissionsMapOptimization"))
+	if err != nil {
+		return core.RondConfig{}, err
+	}
+	ignoreTrailingSlash, err := strconv.ParseBool(header.Get("options.ignoreTrailingSlash"))
+	if err != nil {
+		return core.RondConfig{}, err
+	}
+	preventRequestBodyLoad, err := strconv.ParseBool(header.Get("requestFlow.preventBodyLoad"))
+	if err != nil {
+		return core.RondConfig{}, err
+	}
+	return core.RondConfig{
+		RequestFlow: core.RequestFlow{
+			PolicyName:      header.Get("allow"),
+			GenerateQuery:   rowFilterEnabled,
+			PreventBodyLoad: preventRequestBodyLoad,
+			QueryOptions:    core.QueryOptions{HeaderName: header.Get("resourceFilter.rowFilter.headerKey")},
+		},
+		ResponseFlow: core.ResponseFlow{PolicyName: header.Get("responseFilter.policy")},
+		Options: core.PermissionOptions{
+			EnableResourcePermissionsMapOptimization: enableResourcePermissionsMapOptimization,
+			IgnoreTrailingSlash:                      ignoreTrailingSlash,
+		},
+	}, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrConflictingOASDefinition = errors.New("conflicting OAS definition")
+	ErrInvalidOASSource         = errors.New("invalid OAS source")
+)
+
+// OASSource is an OpenAPI document, loaded either from file or from URL, whose
+// paths are prefixed with PathPrefix when merged with the other documents.
+type OASSource struct {
+	FilePath   string
+	URL        string
+	PathPrefix string
+}
+
+// ParseOASSources parses a comma separated list of sources in the form
+// [<pathPrefix>=]<source>, where source is either an http(s) URL or a file path,
+// e.g. "/orders=http://orders/documentation/json,/payments=./payments.yaml".
+func ParseOASSources(sources string) ([]OASSource, error) {
+	oasSources := []OASSource{}
+	for _, source := range strings.Split(sources, ",") {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+
+		oasSource := OASSource{}
+		if prefix, location, found := strings.Cut(source, "="); found && strings.HasPrefix(prefix, "/") {
+			oasSource.PathPrefix = prefix
+			source = location
+		}
+		if source == "" {
+			return nil, fmt.Errorf("%w: missing source for path prefix %s", ErrInvalidOASSource, oasSource.PathPrefix)
+		}
+
+		if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+			oasSource.URL = source
+		} else {
+			oasSource.FilePath = source
+		}
+		oasSources = append(oasSources, oasSource)
+	}
+	return oasSources, nil
+}
+
+// Merge adds the paths of the source spec, prefixed with pathPrefix, to the spec.
+// It fails without changing the spec if an API of the source spec matches the same
+// requests of an API already defined.
+func (oas *OpenAPISpec) Merge(source *OpenAPISpec, pathPrefix string) error {
+	if oas.Paths == nil {
+		oas.Paths = OpenAPIPaths{}
+	}
+	pathPrefix = normalizePathPrefix(pathPrefix)
+
+	definedAPIs := map[string][]string{}
+	for path, pathVerbs := range oas.Paths {
+		for method := range pathVerbs {
+			definedAPIs[pathShape(path)] = append(definedAPIs[pathShape(path)], method)
+		}
+	}
+
+	for _, path := range source.sortedPaths() {
+		prefixedPath := pathPrefix + path
+		for _, method := range sortedMethods(source.Paths[path]) {
+			for _, definedMethod := range definedAPIs[pathShape(prefixedPath)] {
+				if methodsOverlap(method, definedMethod) {
+					return fmt.Errorf("%w: %s %s is already defined", ErrConflictingOASDefinition, strings.ToUpper(method), prefixedPath)
+				}
+			}
+		}
+	}
+
+	for path, pathVerbs := range source.Paths {
+		prefixedPath := pathPrefix + path
+		if _, ok := oas.Paths[prefixedPath]; !ok {
+			oas.Paths[prefixedPath] = PathVerbs{}
+		}
+		for method, verbConfig := range pathVerbs {
+			oas.Paths[prefixedPath][method] = verbConfig
+		}
+	}
+	for _, issue := range source.unknownKeysIssues {
+		issue.Path = pathPrefix + issue.Path
+		oas.unknownKeysIssues = append(oas.unknownKeysIssues, issue)
+	}
+	return nil
+}
+
+func normalizePathPrefix(pathPrefix string) string {
+	pathPrefix = strings.TrimSuffix(pathPrefix, "/")
+	if pathPrefix != "" && !strings.HasPrefix(pathPrefix, "/") {
+		pathPrefix = "/" + pathPrefix
+	}
+	return pathPrefix
+}
+
+// methodsOverlap reports whether the methods match the same requests, since the
+// all method matches the requests of every method.
+func methodsOverlap(method, otherMethod string) bool {
+	return strings.EqualFold(method, otherMethod) ||
+		strings.EqualFold(method, AllHTTPMethod) ||
+		strings.EqualFold(otherMethod, AllHTTPMethod)
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"testing"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/logging"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestParseOASSources(t *testing.T) {
+	t.Run("parses sources with and without path prefix", func(t *testing.T) {
+		sources, err := ParseOASSources("/orders=http://orders/documentation/json, ./payments.yaml,/invoices=https://invoices/oas?format=yaml,,")
+		require.NoError(t, err)
+		require.Equal(t, []OASSource{
+			{PathPrefix: "/orders", URL: "http://orders/documentation/json"},
+			{FilePath: "./payments.yaml"},
+			{PathPrefix: "/invoices", URL: "https://invoices/oas?format=yaml"},
+		}, sources)
+	})
+
+	t.Run("returns no sources for empty string", func(t *testing.T) {
+		sources, err := ParseOASSources("")
+		require.NoError(t, err)
+		require.Empty(t, sources)
+	})
+
+	t.Run("fails for path prefix without source", func(t *testing.T) {
+		_, err := ParseOASSources("/orders=")
+		require.ErrorIs(t, err, ErrInvalidOASSource)
+	})
+}
+
+func TestMerge(t *testing.T) {
+	allowUsers := VerbConfig{PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_users"}}}
+	allowOrders := VerbConfig{PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_orders"}}}
+
+	t.Run("merges paths with prefix", func(t *testing.T) {
+		oas := &OpenAPISpec{Paths: OpenAPIPaths{
+			"/users/{userId}": PathVerbs{"get": allowUsers},
+		}}
+		source := &OpenAPISpec{
+			Paths: OpenAPIPaths{
+				"/{orderId}":      PathVerbs{"get": allowOrders},
+				"/users/{userId}": PathVerbs{"delete": allowOrders},
+			},
+			unknownKeysIssues: []ValidationIssue{{Path: "/{orderId}", Method: "get", Message: "some issue"}},
+		}
+
+		err := oas.Merge(source, "orders/")
+		require.NoError(t, err)
+		require.Equal(t, OpenAPIPaths{
+			"/users/{userId}":        PathVerbs{"get": allowUsers},
+			"/orders/{orderId}":      PathVerbs{"get": allowOrders},
+			"/orders/users/{userId}": PathVerbs{"delete": allowOrders},
+		}, oas.Paths)
+		require.Equal(t, []ValidationIssue{{Path: "/orders/{orderId}", Method: "get", Message: "some issue"}}, oas.unknownKeysIssues)
+	})
+
+	t.Run("merges different methods of the same path", func(t *testing.T) {
+		oas := &OpenAPISpec{Paths: OpenAPIPaths{
+			"/users/{userId}": PathVerbs{"get": allowUsers},
+		}}
+
+		err := oas.Merge(&OpenAPISpec{Paths: OpenAPIPaths{"/users/{userId}": PathVerbs{"delete": allowOrders}}}, "")
+		require.NoError(t, err)
+		require.Equal(t, OpenAPIPaths{
+			"/users/{userId}": PathVerbs{"get": allowUsers, "delete": allowOrders},
+		}, oas.Paths)
+	})
+
+	t.Run("merges into empty spec", func(t *testing.T) {
+		oas := &OpenAPISpec{}
+
+		err := oas.Merge(&OpenAPISpec{Paths: OpenAPIPaths{"/users/": PathVerbs{"get": allowUsers}}}, "/api")
+		require.NoError(t, err)
+		require.Equal(t, OpenAPIPaths{"/api/users/": PathVerbs{"get": allowUsers}}, oas.Paths)
+	})
+
+	testCases := map[string]struct {
+		path   string
+		method string
+	}{
+		"fails for the same method and path":               {path: "/users/{userId}", method: "GET"},
+		"fails for the same method and equivalent path":    {path: "/users/{id}", method: "get"},
+		"fails for all method on the same path":            {path: "/users/{userId}", method: "all"},
+		"fails for method already defined with all method": {path: "/projects/", method: "post"},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			oas := &OpenAPISpec{Paths: OpenAPIPaths{
+				"/users/{userId}": PathVerbs{"get": allowUsers},
+				"/projects/":      PathVerbs{"all": allowUsers},
+			}}
+			source := &OpenAPISpec{Paths: OpenAPIPaths{
+				"/orders/":    PathVerbs{"get": allowOrders},
+				testCase.path: PathVerbs{testCase.method: allowOrders},
+			}}
+
+			err := oas.Merge(source, "")
+			require.ErrorIs(t, err, ErrConflictingOASDefinition)
+			require.Equal(t, OpenAPIPaths{
+				"/users/{userId}": PathVerbs{"get": allowUsers},
+				"/projects/":      PathVerbs{"all": allowUsers},
+			}, oas.Paths, "spec must not change on conflict")
+		})
+	}
+}
+
+func TestLoadOASWithAdditionalSources(t *testing.T) {
+	log := logging.NewNoOpLogger()
+
+	t.Run("merges file and network sources", func(t *testing.T) {
+		defer gock.Off()
+
+		gock.New("http://orders:3000").
+			Get("/documentation/json").
+			Reply(200).
+			JSON(map[string]any{
+				"paths": map[string]any{
+					"/{orderId}": map[string]any{
+						"get": map[string]any{"x-rond": map[string]any{"requestFlow": map[string]any{"policyName": "allow_orders"}}},
+					},
+				},
+			})
+
+		oas, err := LoadOASFromFileOrNetwork(log, LoadOptions{
+			APIPermissionsFilePath: "../mocks/pathsConfig.json",
+			AdditionalSources: []OASSource{
+				{URL: "http://orders:3000/documentation/json", PathPrefix: "/orders"},
+				{FilePath: "../mocks/oasWithRefs.yaml", PathPrefix: "/api"},
+			},
+		})
+		require.True(t, gock.IsDone(), "Mock has not been invoked")
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"/api/projects/",
+			"/api/users/",
+			"/api/users/{userId}",
+			"/no-permission-from-static-file",
+			"/orders/{orderId}",
+			"/users-from-static-file/",
+		}, oas.sortedPaths())
+		require.Equal(t, "allow_orders", oas.Paths["/orders/{orderId}"]["get"].PermissionV2.RequestFlow.PolicyName)
+	})
+
+	t.Run("loads only additional sources", func(t *testing.T) {
+		oas, err := LoadOASFromFileOrNetwork(log, LoadOptions{
+			AdditionalSources: []OASSource{{FilePath: "../mocks/pathsConfig.json"}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"/no-permission-from-static-file", "/users-from-static-file/"}, oas.sortedPaths())
+	})
+
+	t.Run("fails for conflicting sources", func(t *testing.T) {
+		_, err := LoadOASFromFileOrNetwork(log, LoadOptions{
+			APIPermissionsFilePath: "../mocks/pathsConfig.json",
+			AdditionalSources:      []OASSource{{FilePath: "../mocks/pathsConfig.json"}},
+		})
+		require.ErrorIs(t, err, ErrConflictingOASDefinition)
+		require.EqualError(t, err, "conflicting OAS definition: POST /no-permission-from-static-file is already defined")
+	})
+
+	t.Run("fails for not existing source file", func(t *testing.T) {
+		_, err := LoadOASFromFileOrNetwork(log, LoadOptions{
+			APIPermissionsFilePath: "../mocks/pathsConfig.json",
+			AdditionalSources:      []OASSource{{FilePath: "./notExistingFilePath.json"}},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("fails for source without location", func(t *testing.T) {
+		_, err := LoadOASFromFileOrNetwork(log, LoadOptions{
+			APIPermissionsFilePath: "../mocks/pathsConfig.json",
+			AdditionalSources:      []OASSource{{PathPrefix: "/api"}},
+		})
+		require.ErrorIs(t, err, ErrInvalidOASSource)
+	})
+}
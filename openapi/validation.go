@@ -0,0 +1,225 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/utils"
+)
+
+var ErrInvalidOASConfiguration = errors.New("invalid OAS configuration")
+
+// ValidationIssue is a problem of the rond configuration of an API. Path and Method
+// are empty if the issue does not refer to a specific API.
+type ValidationIssue struct {
+	Path    string
+	Method  string
+	Message string
+}
+
+func (issue ValidationIssue) String() string {
+	if issue.Path == "" {
+		return issue.Message
+	}
+	return fmt.Sprintf("%s %s: %s", strings.ToUpper(issue.Method), issue.Path, issue.Message)
+}
+
+type ValidationError struct {
+	Issues []ValidationIssue
+}
+
+func (e ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		messages = append(messages, issue.String())
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidOASConfiguration, strings.Join(messages, "; "))
+}
+
+func (e ValidationError) Unwrap() error {
+	return ErrInvalidOASConfiguration
+}
+
+type rawVerbConfig struct {
+	PermissionV1 json.RawMessage `json:"x-permission"`
+	PermissionV2 json.RawMessage `json:"x-rond"`
+}
+
+// findUnknownKeys decodes strictly the x-rond and x-permission extensions of the
+// spec, reporting the keys rond does not know, which are otherwise silently ignored.
+func findUnknownKeys(spec []byte) []ValidationIssue {
+	var rawSpec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &rawSpec); err != nil {
+		return nil
+	}
+
+	issues := []ValidationIssue{}
+	for path, pathContent := range rawSpec.Paths {
+		for method, methodContent := range pathContent {
+			var verbConfig rawVerbConfig
+			if err := json.Unmarshal(methodContent, &verbConfig); err != nil {
+				// not an operation object (e.g. path parameters)
+				continue
+			}
+			if err := strictUnmarshal(verbConfig.PermissionV2, &core.RondConfig{}); err != nil {
+				issues = append(issues, ValidationIssue{Path: path, Method: method, Message: fmt.Sprintf("invalid x-rond: %s", err.Error())})
+			}
+			if err := strictUnmarshal(verbConfig.PermissionV1, &XPermission{}); err != nil {
+				issues = append(issues, ValidationIssue{Path: path, Method: method, Message: fmt.Sprintf("invalid x-permission: %s", err.Error())})
+			}
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Path != issues[j].Path {
+			return issues[i].Path < issues[j].Path
+		}
+		return issues[i].Method < issues[j].Method
+	})
+	return issues
+}
+
+func strictUnmarshal(data json.RawMessage, target any) error {
+	if len(data) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
+
+// Validate checks the rond configuration of the spec, reporting:
+//   - the unknown keys of the x-rond and x-permission extensions, for specs loaded from file or network;
+//   - the APIs without a request policy or whose policies are not defined in the rego module;
+//   - the path templates matching the same requests (e.g. /users/{id} and /users/{userId}).
+//
+// The returned error is a ValidationError listing all the issues found.
+func (oas *OpenAPISpec) Validate(opaModuleConfig *core.OPAModuleConfig) error {
+	issues := append([]ValidationIssue{}, oas.unknownKeysIssues...)
+
+	policyNames, err := opaModuleConfig.PolicyNames()
+	if err != nil {
+		issues = append(issues, ValidationIssue{Message: err.Error()})
+	}
+	for _, path := range oas.sortedPaths() {
+		for _, method := range sortedMethods(oas.Paths[path]) {
+			rondConfig := oas.Paths[path][method].PermissionV2
+			if rondConfig == nil {
+				continue
+			}
+			issues = append(issues, validatePolicies(path, method, rondConfig, policyNames)...)
+		}
+	}
+	issues = append(issues, oas.findConflictingPaths()...)
+
+	if len(issues) == 0 {
+		return nil
+	}
+	return ValidationError{Issues: issues}
+}
+
+func validatePolicies(path, method string, rondConfig *core.RondConfig, policyNames []string) []ValidationIssue {
+	issues := []ValidationIssue{}
+	if !utils.Contains(OasSupportedHTTPMethods, strings.ToUpper(method)) && !strings.EqualFold(method, AllHTTPMethod) {
+		issues = append(issues, ValidationIssue{Path: path, Method: method, Message: "unsupported HTTP method"})
+	}
+	if rondConfig.RequestFlow.PolicyName == "" {
+		issues = append(issues, ValidationIssue{Path: path, Method: method, Message: "missing request flow policy"})
+	}
+	// the policies are not checked if the rego module is not valid
+	if policyNames == nil {
+		return issues
+	}
+	if policy := rondConfig.RequestFlow.PolicyName; policy != "" && !core.IsPolicyDefined(policyNames, policy) {
+		issues = append(issues, ValidationIssue{Path: path, Method: method, Message: fmt.Sprintf("request flow policy %s is not defined in the rego module", policy)})
+	}
+	if policy := rondConfig.ResponseFlow.PolicyName; policy != "" && !core.IsPolicyDefined(policyNames, policy) {
+		issues = append(issues, ValidationIssue{Path: path, Method: method, Message: fmt.Sprintf("response flow policy %s is not defined in the rego module", policy)})
+	}
+	return issues
+}
+
+// findConflictingPaths reports the different path templates which match the same
+// requests for the same method, since only one of them is used by the router.
+func (oas *OpenAPISpec) findConflictingPaths() []ValidationIssue {
+	routeMap := oas.createRoutesMap()
+	registeredRoutes := map[string]string{}
+	issues := []ValidationIssue{}
+	for _, path := range oas.sortedPaths() {
+		routeShape := pathShape(path)
+		for _, method := range sortedMethods(oas.Paths[path]) {
+			methods := []string{strings.ToUpper(method)}
+			if strings.EqualFold(method, AllHTTPMethod) {
+				methods = []string{}
+				for _, supportedMethod := range OasSupportedHTTPMethods {
+					if !routeMap.contains(path, supportedMethod) {
+						methods = append(methods, supportedMethod)
+					}
+				}
+			}
+
+			for _, method := range methods {
+				route := method + " " + routeShape
+				conflictingPath, ok := registeredRoutes[route]
+				if !ok {
+					registeredRoutes[route] = path
+					continue
+				}
+				if conflictingPath != path {
+					issues = append(issues, ValidationIssue{Path: path, Method: method, Message: fmt.Sprintf("path conflicts with %s", conflictingPath)})
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// pathShape returns the path with anonymous path parameters, so that the paths
+// matching the same requests have the same shape.
+func pathShape(path string) string {
+	segments := strings.Split(ConvertPathVariablesToColons(path), "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = ":"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (oas *OpenAPISpec) sortedPaths() []string {
+	paths := make([]string, 0, len(oas.Paths))
+	for path := range oas.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func sortedMethods(pathVerbs PathVerbs) []string {
+	methods := make([]string, 0, len(pathVerbs))
+	for method := range pathVerbs {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
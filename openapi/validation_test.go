@@ -0,0 +1,142 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rond-authz/rond/core"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	opaModule := &core.OPAModuleConfig{
+		Name: "example.rego",
+		Content: `package policies
+allow_users { true }
+filter_projects { true }
+filter_projects_response [response] { response := input.response.body }`,
+	}
+
+	t.Run("valid configuration", func(t *testing.T) {
+		oas := &OpenAPISpec{
+			Paths: OpenAPIPaths{
+				"/projects/{projectId}": PathVerbs{
+					"all": VerbConfig{
+						PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_users"}},
+					},
+				},
+				"/projects/": PathVerbs{
+					"get": VerbConfig{
+						PermissionV2: &core.RondConfig{
+							RequestFlow:  core.RequestFlow{PolicyName: "filter_projects", GenerateQuery: true},
+							ResponseFlow: core.ResponseFlow{PolicyName: "filter_projects_response"},
+						},
+					},
+				},
+				"/users/": PathVerbs{
+					"get": VerbConfig{},
+				},
+			},
+		}
+
+		require.NoError(t, oas.Validate(opaModule))
+	})
+
+	t.Run("reports issues of configuration loaded from file", func(t *testing.T) {
+		oas := prepareOASFromFile(t, "../mocks/oasWithRondConfigIssues.json")
+
+		err := oas.Validate(opaModule)
+		require.ErrorIs(t, err, ErrInvalidOASConfiguration)
+
+		var validationError ValidationError
+		require.True(t, errors.As(err, &validationError))
+		require.Equal(t, []ValidationIssue{
+			{Path: "/projects/", Method: "post", Message: `invalid x-permission: json: unknown field "resourceFiltre"`},
+			{Path: "/users/{id}", Method: "get", Message: `invalid x-rond: json: unknown field "policyNmae"`},
+			{Path: "/projects/", Method: "post", Message: "request flow policy not_existing_policy is not defined in the rego module"},
+			{Path: "/users/{id}", Method: "get", Message: "missing request flow policy"},
+			{Path: "/users/{userId}", Method: "get", Message: "response flow policy filter_users_response is not defined in the rego module"},
+			{Path: "/users/{userId}", Method: "GET", Message: "path conflicts with /users/{id}"},
+		}, validationError.Issues)
+	})
+
+	t.Run("policies with dots are resolved as rego rules", func(t *testing.T) {
+		oas := &OpenAPISpec{
+			Paths: OpenAPIPaths{
+				"/projects/": PathVerbs{
+					"get": VerbConfig{
+						PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "filter.projects"}},
+					},
+				},
+			},
+		}
+
+		require.NoError(t, oas.Validate(opaModule))
+	})
+
+	t.Run("reports unsupported method and conflicts with all method", func(t *testing.T) {
+		oas := &OpenAPISpec{
+			Paths: OpenAPIPaths{
+				"/projects/{projectId}": PathVerbs{
+					"all": VerbConfig{
+						PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_users"}},
+					},
+				},
+				"/projects/{id}": PathVerbs{
+					"delete": VerbConfig{
+						PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_users"}},
+					},
+					"subscribe": VerbConfig{
+						PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_users"}},
+					},
+				},
+			},
+		}
+
+		err := oas.Validate(opaModule)
+		var validationError ValidationError
+		require.True(t, errors.As(err, &validationError))
+		require.Equal(t, []ValidationIssue{
+			{Path: "/projects/{id}", Method: "subscribe", Message: "unsupported HTTP method"},
+			{Path: "/projects/{projectId}", Method: "DELETE", Message: "path conflicts with /projects/{id}"},
+		}, validationError.Issues)
+	})
+
+	t.Run("reports invalid rego module", func(t *testing.T) {
+		oas := &OpenAPISpec{
+			Paths: OpenAPIPaths{
+				"/projects/": PathVerbs{
+					"get": VerbConfig{
+						PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "filter_projects"}},
+					},
+				},
+			},
+		}
+
+		err := oas.Validate(&core.OPAModuleConfig{Name: "invalid.rego", Content: "package policies\nfoo ["})
+		var validationError ValidationError
+		require.True(t, errors.As(err, &validationError))
+		require.Len(t, validationError.Issues, 1)
+		require.ErrorContains(t, err, core.ErrRegoModuleParseFailed.Error())
+	})
+}
+
+func TestValidationIssue(t *testing.T) {
+	require.Equal(t, "GET /users/: some issue", ValidationIssue{Path: "/users/", Method: "get", Message: "some issue"}.String())
+	require.Equal(t, "some issue", ValidationIssue{Message: "some issue"}.String())
+}
@@ -18,14 +18,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/rond-authz/rond/core"
 	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/metrics"
 )
 
 type PolicyResult struct {
 	QueryToProxy []byte
 	Allowed      bool
+	// RateLimitExceeded is true if the request is not allowed and a rate limit,
+	// checked by the policy with the rate_limit builtin, has been exceeded.
+	RateLimitExceeded bool
+	// RetryAfter is the time to wait before the exceeded rate limit allows new requests.
+	RetryAfter time.Duration
 }
 
 // Warning: This interface is experimental, and it could change with breaking also in rond patches.
@@ -49,6 +56,7 @@ type evaluator struct {
 
 	evaluatorOptions        *EvaluatorOptions
 	policyEvaluationOptions *core.PolicyEvaluationOptions
+	matchedPath             string
 }
 
 func (e evaluator) Config() core.RondConfig {
@@ -57,6 +65,9 @@ func (e evaluator) Config() core.RondConfig {
 
 type EvaluateOptions struct {
 	Logger logging.Logger
+	// EnablePrintStatements writes the output of the policies print statements
+	// for this evaluation, also when it is not enabled for all the evaluations.
+	EnablePrintStatements bool
 }
 
 func (e EvaluateOptions) GetLogger() logging.Logger {
@@ -66,12 +77,53 @@ func (e EvaluateOptions) GetLogger() logging.Logger {
 	return e.Logger
 }
 
-func (e evaluator) EvaluateRequestPolicy(ctx context.Context, rondInput core.Input, options *EvaluateOptions) (PolicyResult, error) {
+// evaluationContext enables the print statements output for the evaluation, if
+// requested by the options or by the rond configuration of the route.
+func (e evaluator) evaluationContext(ctx context.Context, options *EvaluateOptions) context.Context {
+	if options.EnablePrintStatements || e.rondConfig.Options.EnablePrintStatements {
+		return core.WithPrintStatements(ctx)
+	}
+	return ctx
+}
+
+func (e evaluator) metrics() *metrics.Metrics {
+	if e.policyEvaluationOptions == nil || e.policyEvaluationOptions.Metrics == nil {
+		return metrics.NoOpMetrics()
+	}
+	return e.policyEvaluationOptions.Metrics
+}
+
+// recordDecision counts the policy decision, telling apart the denied requests
+// from the failed evaluations.
+func (e evaluator) recordDecision(policyName string, err error) {
+	decision := metrics.DecisionAllow
+	if errors.Is(err, core.ErrPolicyNotAllowed) {
+		decision = metrics.DecisionDeny
+	} else if err != nil {
+		decision = metrics.DecisionError
+	}
+	e.metrics().PolicyDecisionsTotal.With(metrics.Labels{
+		"policy_name":  policyName,
+		"matched_path": e.matchedPath,
+		"decision":     decision,
+	}).Inc()
+}
+
+func (e evaluator) EvaluateRequestPolicy(ctx context.Context, rondInput core.Input, options *EvaluateOptions) (result PolicyResult, err error) {
 	rondConfig := e.Config()
+	defer func() {
+		if err == nil && !result.Allowed {
+			e.recordDecision(rondConfig.RequestFlow.PolicyName, core.ErrPolicyNotAllowed)
+			return
+		}
+		e.recordDecision(rondConfig.RequestFlow.PolicyName, err)
+	}()
+
 	if options == nil {
 		options = &EvaluateOptions{}
 	}
 	logger := options.GetLogger()
+	ctx = e.evaluationContext(ctx, options)
 
 	regoInput, err := core.CreateRegoQueryInput(logger, rondInput, core.RegoInputOptions{
 		EnableResourcePermissionsMapOptimization: rondConfig.Options.EnableResourcePermissionsMapOptimization,
@@ -105,6 +157,13 @@ func (e evaluator) EvaluateRequestPolicy(ctx context.Context, rondInput core.Inp
 			"policyName": rondConfig.RequestFlow.PolicyName,
 			"message":    err.Error(),
 		}).Error("RBAC policy evaluation failed")
+		var rateLimitErr *core.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			return PolicyResult{
+				RateLimitExceeded: true,
+				RetryAfter:        rateLimitErr.RetryAfter,
+			}, nil
+		}
 		if errors.Is(err, core.ErrPolicyNotAllowed) {
 			return PolicyResult{}, nil
 		}
@@ -125,12 +184,21 @@ func (e evaluator) EvaluateRequestPolicy(ctx context.Context, rondInput core.Inp
 	}, nil
 }
 
-func (e evaluator) EvaluateResponsePolicy(ctx context.Context, rondInput core.Input, options *EvaluateOptions) ([]byte, error) {
+func (e evaluator) EvaluateResponsePolicy(ctx context.Context, rondInput core.Input, options *EvaluateOptions) (marshalledBody []byte, err error) {
 	rondConfig := e.Config()
+	evaluationStart := time.Now()
+	defer func() {
+		e.metrics().ResponsePolicyEvaluationDurationMilliseconds.With(metrics.Labels{
+			"policy_name": rondConfig.ResponseFlow.PolicyName,
+		}).Observe(float64(time.Since(evaluationStart).Milliseconds()))
+		e.recordDecision(rondConfig.ResponseFlow.PolicyName, err)
+	}()
+
 	if options == nil {
 		options = &EvaluateOptions{}
 	}
 	logger := options.GetLogger()
+	ctx = e.evaluationContext(ctx, options)
 
 	regoInput, err := core.CreateRegoQueryInput(logger, rondInput, core.RegoInputOptions{
 		EnableResourcePermissionsMapOptimization: rondConfig.Options.EnableResourcePermissionsMapOptimization,
@@ -151,7 +219,7 @@ func (e evaluator) EvaluateResponsePolicy(ctx context.Context, rondInput core.In
 		return nil, err
 	}
 
-	marshalledBody, err := json.Marshal(bodyToProxy)
+	marshalledBody, err = json.Marshal(bodyToProxy)
 	if err != nil {
 		return nil, err
 	}
@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/rond-authz/rond/core"
 	"github.com/rond-authz/rond/custom_builtins"
@@ -374,14 +375,29 @@ func TestEvaluateRequestPolicy(t *testing.T) {
 				})
 
 				t.Run("metrics", func(t *testing.T) {
-					require.Len(t, hook.AllEntries(), 1)
+					durationEntries := hook.EntriesByName(metrics.PolicyEvalDurationMetricName)
+					require.Len(t, durationEntries, 1)
 					require.Equal(t, metricstest.Entry{
 						Name: "policy_evaluation_duration_milliseconds",
 						Labels: metrics.Labels{
 							"policy_name": evaluate.Config().RequestFlow.PolicyName,
 						},
-						Value: hook.Entries[0].Value,
-					}, hook.Entries[0])
+						Value: durationEntries[0].Value,
+					}, durationEntries[0])
+
+					decision := metrics.DecisionAllow
+					if !actual.Allowed {
+						decision = metrics.DecisionDeny
+					}
+					require.Equal(t, metricstest.Entries{{
+						Name: "policy_decisions_total",
+						Labels: metrics.Labels{
+							"policy_name":  evaluate.Config().RequestFlow.PolicyName,
+							"matched_path": evaluate.(evaluator).matchedPath,
+							"decision":     decision,
+						},
+						Value: 1,
+					}}, hook.EntriesByName(metrics.PolicyDecisionsMetricName))
 				})
 			})
 		}
@@ -404,6 +420,48 @@ func TestEvaluateRequestPolicy(t *testing.T) {
 			Allowed: true,
 		}, result)
 	})
+
+	t.Run("with rate limit exceeded", func(t *testing.T) {
+		opaModule := &core.OPAModuleConfig{
+			Name: "example.rego",
+			Content: `package policies
+			todo { rate_limit(input.user.id, 1, "1h") }
+			global_quota { rate_limit("global", 1, "1h") }
+			generate_filter {
+				rate_limit(input.user.id, 1, "1h")
+				query := data.resources[_]
+				query.owner == input.user.id
+			}`,
+		}
+
+		for _, requestFlow := range []core.RequestFlow{
+			{PolicyName: "todo"},
+			{PolicyName: "global_quota"},
+			{PolicyName: "generate_filter", GenerateQuery: true},
+		} {
+			t.Run(requestFlow.PolicyName, func(t *testing.T) {
+				sdk, err := NewWithConfig(context.Background(), opaModule, core.RondConfig{
+					RequestFlow: requestFlow,
+				}, &Options{
+					EvaluatorOptions: &EvaluatorOptions{
+						RateLimitStore: custom_builtins.NewInMemoryRateLimitStore(),
+					},
+				})
+				require.NoError(t, err)
+
+				input := core.Input{User: core.InputUser{ID: "my-user"}}
+				result, err := sdk.EvaluateRequestPolicy(context.Background(), input, nil)
+				require.NoError(t, err)
+				require.True(t, result.Allowed)
+
+				result, err = sdk.EvaluateRequestPolicy(context.Background(), input, nil)
+				require.NoError(t, err)
+				require.False(t, result.Allowed)
+				require.True(t, result.RateLimitExceeded)
+				require.Greater(t, result.RetryAfter, 59*time.Minute)
+			})
+		}
+	})
 }
 
 func TestEvaluateResponsePolicy(t *testing.T) {
@@ -577,14 +635,35 @@ func TestEvaluateResponsePolicy(t *testing.T) {
 				})
 
 				t.Run("metrics", func(t *testing.T) {
-					require.Len(t, hook.AllEntries(), 1)
+					durationEntries := hook.EntriesByName(metrics.PolicyEvalDurationMetricName)
+					require.Len(t, durationEntries, 1)
 					require.Equal(t, metricstest.Entry{
 						Name: "policy_evaluation_duration_milliseconds",
 						Labels: metrics.Labels{
 							"policy_name": evaluate.Config().ResponseFlow.PolicyName,
 						},
-						Value: hook.Entries[0].Value,
-					}, hook.Entries[0])
+						Value: durationEntries[0].Value,
+					}, durationEntries[0])
+
+					responsePolicyEntries := hook.EntriesByName(metrics.ResponsePolicyEvalDurationMetricName)
+					require.Len(t, responsePolicyEntries, 1)
+					require.Equal(t, metrics.Labels{
+						"policy_name": evaluate.Config().ResponseFlow.PolicyName,
+					}, responsePolicyEntries[0].Labels)
+
+					decision := metrics.DecisionAllow
+					if testCase.notAllowed {
+						decision = metrics.DecisionDeny
+					}
+					require.Equal(t, metricstest.Entries{{
+						Name: "policy_decisions_total",
+						Labels: metrics.Labels{
+							"policy_name":  evaluate.Config().ResponseFlow.PolicyName,
+							"matched_path": evaluate.(evaluator).matchedPath,
+							"decision":     decision,
+						},
+						Value: 1,
+					}}, hook.EntriesByName(metrics.PolicyDecisionsMetricName))
 				})
 			})
 		}
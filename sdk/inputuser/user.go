@@ -17,11 +17,16 @@ package inputuser
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/tracing"
 	"github.com/rond-authz/rond/internal/utils"
 	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/metrics"
 	"github.com/rond-authz/rond/types"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func rolesIDsFromBindings(bindings []types.Binding) []string {
@@ -36,7 +41,18 @@ func rolesIDsFromBindings(bindings []types.Binding) []string {
 	return rolesIds
 }
 
-func Get(ctx context.Context, logger logging.Logger, client Client, user types.User) (core.InputUser, error) {
+func observeFetchDuration(ctx context.Context, resource string, fetchStart time.Time) {
+	metrics.FromContext(ctx).InputUserFetchDurationMilliseconds.With(metrics.Labels{
+		"resource": resource,
+	}).Observe(float64(time.Since(fetchStart).Milliseconds()))
+}
+
+// Get builds the input user, retrieving its bindings and roles with the client if set.
+// The retrieval durations are recorded with the metrics set in the context.
+func Get(ctx context.Context, logger logging.Logger, client Client, user types.User) (_ core.InputUser, err error) {
+	ctx, span := tracing.Start(ctx, "inputuser.Get")
+	defer func() { tracing.End(span, err) }()
+
 	inputUser := core.InputUser{
 		Groups:     user.Groups,
 		ID:         user.ID,
@@ -44,20 +60,27 @@ func Get(ctx context.Context, logger logging.Logger, client Client, user types.U
 	}
 
 	if client != nil && user.ID != "" {
-		var err error
+		fetchStart := time.Now()
 		inputUser.Bindings, err = client.RetrieveUserBindings(ctx, user)
+		observeFetchDuration(ctx, "bindings", fetchStart)
 		if err != nil {
 			logger.WithField("error", map[string]any{"message": err.Error()}).Error("something went wrong while retrieving user bindings")
 			return core.InputUser{}, fmt.Errorf("error while retrieving user bindings: %s", err.Error())
 		}
 
 		userRolesIds := rolesIDsFromBindings(inputUser.Bindings)
+		fetchStart = time.Now()
 		inputUser.Roles, err = client.RetrieveUserRolesByRolesID(ctx, userRolesIds)
+		observeFetchDuration(ctx, "roles", fetchStart)
 		if err != nil {
 			logger.WithField("error", map[string]any{"message": err.Error()}).Error("something went wrong while retrieving user roles")
 
 			return core.InputUser{}, fmt.Errorf("error while retrieving user Roles: %s", err.Error())
 		}
+		span.SetAttributes(
+			attribute.Int("rond.bindings_count", len(inputUser.Bindings)),
+			attribute.Int("rond.roles_count", len(inputUser.Roles)),
+		)
 		logger.WithFields(map[string]any{
 			"foundBindingsLength": len(inputUser.Bindings),
 			"foundRolesLength":    len(inputUser.Roles),
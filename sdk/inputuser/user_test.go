@@ -22,10 +22,14 @@ import (
 
 	"github.com/rond-authz/rond/core"
 	"github.com/rond-authz/rond/internal/fake"
+	"github.com/rond-authz/rond/internal/testutils"
 	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/metrics"
+	metricstest "github.com/rond-authz/rond/metrics/test"
 	"github.com/rond-authz/rond/types"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
 )
 
 func TestRolesIDSFromBindings(t *testing.T) {
@@ -177,4 +181,34 @@ func TestRetrieveUserBindingsAndRoles(t *testing.T) {
 			},
 		}, inputUser)
 	})
+
+	t.Run("traces the retrieval recording the failures", func(t *testing.T) {
+		exporter := testutils.SetupTracing(t)
+		mock := fake.InputUserClient{UserBindingsError: fmt.Errorf("some error")}
+
+		_, err := Get(context.Background(), log, mock, types.User{ID: "userId"})
+		require.Error(t, err)
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, "inputuser.Get", spans[0].Name)
+		require.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+
+	t.Run("records bindings and roles retrieval durations with metrics in context", func(t *testing.T) {
+		mock := fake.InputUserClient{
+			UserBindings: []types.Binding{{Roles: []string{"r1"}}},
+			UserRoles:    []types.Role{{RoleID: "r1", Permissions: []string{"p1"}}},
+		}
+		testMetrics, hook := metricstest.New()
+		ctx := metrics.WithContext(context.Background(), testMetrics)
+
+		_, err := Get(ctx, log, mock, types.User{ID: "userId"})
+		require.NoError(t, err)
+
+		entries := hook.EntriesByName(metrics.InputUserFetchDurationMetricName)
+		require.Len(t, entries, 2)
+		require.Equal(t, metrics.Labels{"resource": "bindings"}, entries[0].Labels)
+		require.Equal(t, metrics.Labels{"resource": "roles"}, entries[1].Labels)
+	})
 }
@@ -17,6 +17,7 @@ package sdk_test
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/rond-authz/rond/core"
@@ -24,6 +25,7 @@ import (
 	"github.com/rond-authz/rond/logging"
 	"github.com/rond-authz/rond/openapi"
 	"github.com/rond-authz/rond/sdk"
+	rondhttp "github.com/rond-authz/rond/sdk/rondinput/http"
 
 	"github.com/stretchr/testify/require"
 )
@@ -132,3 +134,51 @@ func TestUsageNewFromOasWithMongo(t *testing.T) {
 		Allowed: true,
 	})
 }
+
+func TestUsageNewFromOasWithPathParams(t *testing.T) {
+	opaModuleConfig := &core.OPAModuleConfig{
+		Name: "example.rego",
+		Content: `package policies
+		allow_own_user { input.request.pathParams.userId == input.user.id }`,
+	}
+	openAPISpec := &openapi.OpenAPISpec{
+		Paths: openapi.OpenAPIPaths{
+			"/users/{userId}": openapi.PathVerbs{
+				"get": openapi.VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_own_user"}},
+				},
+			},
+		},
+	}
+
+	ctx := context.Background()
+	oasFinder, err := sdk.NewFromOAS(ctx, opaModuleConfig, openAPISpec, nil)
+	require.NoError(t, err)
+
+	// A router other than gorilla mux does not expose the OAS path params:
+	// they are taken from the route matched by rond.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		evaluator, route, err := sdk.FindEvaluatorAndRoute(oasFinder, r.Method, r.URL.EscapedPath())
+		require.NoError(t, err)
+		require.Equal(t, "/users/:userId", route.PathTemplate)
+
+		config := evaluator.Config()
+		input, err := rondhttp.NewInput(&config, r, "", route.PathParams, core.InputUser{ID: "piero"}, nil)
+		require.NoError(t, err)
+
+		result, err := evaluator.EvaluateRequestPolicy(r.Context(), input, nil)
+		require.NoError(t, err)
+		if !result.Allowed {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/piero", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/ghigo", nil))
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -18,13 +18,11 @@ import (
 	"github.com/rond-authz/rond/core"
 	"github.com/rond-authz/rond/metrics"
 	"github.com/rond-authz/rond/openapi"
-
-	"github.com/uptrace/bunrouter"
 )
 
 type oasImpl struct {
 	oas       *openapi.OpenAPISpec
-	oasRouter *bunrouter.CompatRouter
+	oasRouter *openapi.OASRouter
 
 	opaModuleConfig         *core.OPAModuleConfig
 	partialResultEvaluators core.PartialResultsEvaluators
@@ -33,10 +31,20 @@ type oasImpl struct {
 }
 
 func (r oasImpl) FindEvaluator(method, path string) (Evaluator, error) {
-	permission, routerInfo, err := r.oas.FindPermission(r.oasRouter, path, method)
+	evaluator, _, err := r.FindEvaluatorAndRoute(method, path)
+	return evaluator, err
+}
+
+func (r oasImpl) FindEvaluatorAndRoute(method, path string) (Evaluator, MatchedRoute, error) {
+	match, err := r.oasRouter.Match(method, path)
 	if err != nil {
-		return nil, err
+		return nil, MatchedRoute{}, err
 	}
+	permission := core.RondConfig{}
+	if match.RondConfig != nil {
+		permission = *match.RondConfig
+	}
+	routerInfo := match.RouterInfo
 	return evaluator{
 		rondConfig:              permission,
 		opaModuleConfig:         r.opaModuleConfig,
@@ -51,9 +59,37 @@ func (r oasImpl) FindEvaluator(method, path string) (Evaluator, error) {
 				"method":        routerInfo.Method,
 			},
 		},
-	}, err
+		matchedPath: routerInfo.MatchedPath,
+	}, MatchedRoute{PathTemplate: routerInfo.MatchedPath, PathParams: match.PathParams}, nil
+}
+
+// MatchedRoute describes the OAS route matched by a request.
+type MatchedRoute struct {
+	// PathTemplate is the matched OAS path, with path parameters in the `:param` form.
+	PathTemplate string
+	// PathParams contains the path parameters extracted from the requested path, not
+	// unescaped. It can be used as input.request.pathParams by routers other than the
+	// one used by rond.
+	PathParams map[string]string
 }
 
 type OASEvaluatorFinder interface {
 	FindEvaluator(method, path string) (Evaluator, error)
 }
+
+// RouteFinder is implemented by the OASEvaluatorFinder which also return the route
+// matched by the request, such as the one returned by NewFromOAS.
+type RouteFinder interface {
+	// FindEvaluatorAndRoute works as FindEvaluator, also returning the matched route.
+	FindEvaluatorAndRoute(method, path string) (Evaluator, MatchedRoute, error)
+}
+
+// FindEvaluatorAndRoute returns the evaluator and the route matched by the request.
+// The route is empty if the finder does not implement RouteFinder.
+func FindEvaluatorAndRoute(finder OASEvaluatorFinder, method, path string) (Evaluator, MatchedRoute, error) {
+	if routeFinder, ok := finder.(RouteFinder); ok {
+		return routeFinder.FindEvaluatorAndRoute(method, path)
+	}
+	evaluator, err := finder.FindEvaluator(method, path)
+	return evaluator, MatchedRoute{}, err
+}
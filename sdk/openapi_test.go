@@ -74,6 +74,7 @@ func TestOasSDK(t *testing.T) {
 				partialResultEvaluators: oas.partialResultEvaluators,
 				policyEvaluationOptions: evaluatorOptions,
 				evaluatorOptions:        &EvaluatorOptions{},
+				matchedPath:             "/users/",
 			}, actual)
 
 			t.Run("get permissions", func(t *testing.T) {
@@ -85,4 +86,50 @@ func TestOasSDK(t *testing.T) {
 			})
 		})
 	})
+
+	t.Run("FindEvaluatorAndRoute", func(t *testing.T) {
+		t.Run("throws if path and method not found", func(t *testing.T) {
+			actual, route, err := FindEvaluatorAndRoute(sdk, http.MethodGet, "/not-existent/path")
+			require.ErrorContains(t, err, "not found oas definition: GET /not-existent/path")
+			require.Nil(t, actual)
+			require.Equal(t, MatchedRoute{}, route)
+		})
+
+		t.Run("returns matched template and path params", func(t *testing.T) {
+			sdk, err := NewFromOAS(context.Background(), opaModule, &openapi.OpenAPISpec{
+				Paths: openapi.OpenAPIPaths{
+					"/users/{userId}/posts/{postId}": openapi.PathVerbs{
+						"get": openapi.VerbConfig{
+							PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "very_very_composed_permission"}},
+						},
+					},
+				},
+			}, nil)
+			require.NoError(t, err)
+
+			actual, route, err := FindEvaluatorAndRoute(sdk, http.MethodGet, "/users/piero/posts/42")
+			require.NoError(t, err)
+			require.Equal(t, "very_very_composed_permission", actual.Config().RequestFlow.PolicyName)
+			require.Equal(t, MatchedRoute{
+				PathTemplate: "/users/:userId/posts/:postId",
+				PathParams:   map[string]string{"userId": "piero", "postId": "42"},
+			}, route)
+		})
+
+		t.Run("returns empty route if the finder does not implement RouteFinder", func(t *testing.T) {
+			actual, route, err := FindEvaluatorAndRoute(evaluatorFinder{sdk}, http.MethodGet, "/users/")
+			require.NoError(t, err)
+			require.NotNil(t, actual)
+			require.Equal(t, MatchedRoute{}, route)
+		})
+	})
+}
+
+// evaluatorFinder implements only OASEvaluatorFinder.
+type evaluatorFinder struct {
+	finder OASEvaluatorFinder
+}
+
+func (f evaluatorFinder) FindEvaluator(method, path string) (Evaluator, error) {
+	return f.finder.FindEvaluator(method, path)
 }
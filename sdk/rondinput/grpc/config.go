@@ -0,0 +1,107 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/sdk"
+)
+
+var ErrMethodNotFound = errors.New("not found gRPC method definition")
+
+// MethodConfig is the configuration of a gRPC method. As for the OAS paths,
+// the rond configuration is set with the x-rond key.
+type MethodConfig struct {
+	PermissionV2 *core.RondConfig `json:"x-rond"`
+}
+
+// Config maps the gRPC full method names (e.g. /package.Service/Method) to their
+// configuration. A method set to /package.Service/* applies to all the methods
+// of the service which are not configured explicitly.
+//
+//	{
+//	  "methods": {
+//	    "/package.Service/Method": {
+//	      "x-rond": {"requestFlow": {"policyName": "allow"}}
+//	    }
+//	  }
+//	}
+type Config struct {
+	Methods map[string]MethodConfig `json:"methods"`
+}
+
+func LoadConfigFile(configFilePath string) (*Config, error) {
+	fileContentByte, err := utils.ReadFile(configFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(fileContentByte, &config); err != nil {
+		return nil, fmt.Errorf("%w: unmarshal error: %s", utils.ErrFileLoadFailed, err.Error())
+	}
+	return &config, nil
+}
+
+type MethodEvaluatorFinder interface {
+	FindEvaluator(fullMethod string) (sdk.Evaluator, error)
+}
+
+type methodEvaluators map[string]sdk.Evaluator
+
+// NewMethodEvaluatorFinder prepares an evaluator for each configured method.
+// Methods without a policy are not configured, so their calls are denied.
+func NewMethodEvaluatorFinder(ctx context.Context, opaModuleConfig *core.OPAModuleConfig, config *Config, options *sdk.Options) (MethodEvaluatorFinder, error) {
+	if config == nil {
+		return nil, fmt.Errorf("gRPC config must not be nil")
+	}
+
+	evaluators := methodEvaluators{}
+	for fullMethod, methodConfig := range config.Methods {
+		if methodConfig.PermissionV2 == nil || methodConfig.PermissionV2.RequestFlow.PolicyName == "" {
+			continue
+		}
+		if !strings.HasPrefix(fullMethod, "/") || strings.Count(fullMethod, "/") != 2 {
+			return nil, fmt.Errorf("invalid gRPC method %s: expected /package.Service/Method", fullMethod)
+		}
+
+		evaluator, err := sdk.NewWithConfig(ctx, opaModuleConfig, *methodConfig.PermissionV2, options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration for gRPC method %s: %w", fullMethod, err)
+		}
+		evaluators[fullMethod] = evaluator
+	}
+	return evaluators, nil
+}
+
+func (m methodEvaluators) FindEvaluator(fullMethod string) (sdk.Evaluator, error) {
+	if evaluator, ok := m[fullMethod]; ok {
+		return evaluator, nil
+	}
+
+	if serviceSeparator := strings.LastIndex(fullMethod, "/"); serviceSeparator > 0 {
+		if evaluator, ok := m[fullMethod[:serviceSeparator]+"/*"]; ok {
+			return evaluator, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMethodNotFound, utils.SanitizeString(fullMethod))
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondgrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/utils"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Run("loads methods configuration", func(t *testing.T) {
+		config, err := LoadConfigFile("../../../mocks/grpcConfig.json")
+		require.NoError(t, err)
+		require.Len(t, config.Methods, 3)
+		require.Equal(t, &core.RondConfig{
+			RequestFlow: core.RequestFlow{
+				PolicyName:    "allow_service",
+				GenerateQuery: true,
+				QueryOptions:  core.QueryOptions{HeaderName: "X-Query"},
+			},
+		}, config.Methods["/grpc.health.v1.Health/Check"].PermissionV2)
+		require.Nil(t, config.Methods["/grpc.health.v1.Health/List"].PermissionV2)
+	})
+
+	t.Run("fails if file does not exist", func(t *testing.T) {
+		_, err := LoadConfigFile("../../../mocks/not-existing.json")
+		require.ErrorIs(t, err, utils.ErrFileLoadFailed)
+	})
+
+	t.Run("fails if file is not a valid configuration", func(t *testing.T) {
+		_, err := LoadConfigFile("../../../mocks/rego-policies/example.rego")
+		require.ErrorIs(t, err, utils.ErrFileLoadFailed)
+		require.ErrorContains(t, err, "unmarshal error")
+	})
+}
+
+func TestMethodEvaluatorFinder(t *testing.T) {
+	opaModule := &core.OPAModuleConfig{
+		Name: "example.rego",
+		Content: `package policies
+allow_service { true }
+allow_admin { true }`,
+	}
+	config, err := LoadConfigFile("../../../mocks/grpcConfig.json")
+	require.NoError(t, err)
+
+	finder, err := NewMethodEvaluatorFinder(context.Background(), opaModule, config, nil)
+	require.NoError(t, err)
+
+	t.Run("finds method evaluator", func(t *testing.T) {
+		evaluator, err := finder.FindEvaluator("/grpc.health.v1.Health/Check")
+		require.NoError(t, err)
+		require.Equal(t, "allow_service", evaluator.Config().RequestFlow.PolicyName)
+	})
+
+	t.Run("falls back to service evaluator", func(t *testing.T) {
+		evaluator, err := finder.FindEvaluator("/grpc.health.v1.Health/Watch")
+		require.NoError(t, err)
+		require.Equal(t, "allow_admin", evaluator.Config().RequestFlow.PolicyName)
+
+		evaluator, err = finder.FindEvaluator("/grpc.health.v1.Health/List")
+		require.NoError(t, err)
+		require.Equal(t, "allow_admin", evaluator.Config().RequestFlow.PolicyName)
+	})
+
+	t.Run("not found method", func(t *testing.T) {
+		_, err := finder.FindEvaluator("/other.Service/Check")
+		require.ErrorIs(t, err, ErrMethodNotFound)
+	})
+
+	t.Run("fails with invalid method name", func(t *testing.T) {
+		_, err := NewMethodEvaluatorFinder(context.Background(), opaModule, &Config{
+			Methods: map[string]MethodConfig{
+				"Check": {PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_admin"}}},
+			},
+		}, nil)
+		require.EqualError(t, err, "invalid gRPC method Check: expected /package.Service/Method")
+	})
+
+	t.Run("fails with invalid rego module", func(t *testing.T) {
+		invalidModule := &core.OPAModuleConfig{Name: "example.rego", Content: "package policies\nallow_admin { "}
+		_, err := NewMethodEvaluatorFinder(context.Background(), invalidModule, &Config{
+			Methods: map[string]MethodConfig{
+				"/package.Service/Method": {PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_admin"}}},
+			},
+		}, nil)
+		require.ErrorContains(t, err, "invalid configuration for gRPC method /package.Service/Method")
+	})
+
+	t.Run("fails without config", func(t *testing.T) {
+		_, err := NewMethodEvaluatorFinder(context.Background(), opaModule, nil, nil)
+		require.EqualError(t, err, "gRPC config must not be nil")
+	})
+}
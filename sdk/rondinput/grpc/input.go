@@ -0,0 +1,101 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondgrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rond-authz/rond/core"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func parseRequestMessage(message any) (any, error) {
+	if message == nil {
+		return nil, nil
+	}
+
+	var messageBytes []byte
+	var err error
+	if protoMessage, ok := message.(proto.Message); ok {
+		messageBytes, err = protojson.Marshal(protoMessage)
+	} else {
+		messageBytes, err = json.Marshal(message)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed request message serialization: %s", err.Error())
+	}
+
+	var requestBody any
+	if err := json.Unmarshal(messageBytes, &requestBody); err != nil {
+		return nil, fmt.Errorf("failed request message deserialization: %s", err.Error())
+	}
+	return requestBody, nil
+}
+
+// NewInput builds the rond input of a gRPC call, following the gRPC over HTTP/2
+// mapping: the method is always POST and the path is the full method name
+// (e.g. /package.Service/Method). Metadata are set as request headers and the
+// request message, if any, is set as request body using its JSON encoding.
+func NewInput(
+	config *core.RondConfig,
+	fullMethod string,
+	md metadata.MD,
+	clientTypeMetadataKey string,
+	message any,
+	user core.InputUser,
+) (core.Input, error) {
+	headers := http.Header{}
+	for key, values := range md {
+		for _, value := range values {
+			headers.Add(key, value)
+		}
+	}
+
+	input := core.Input{
+		ClientType: firstMetadataValue(md, clientTypeMetadataKey),
+		Request: core.InputRequest{
+			Method:  http.MethodPost,
+			Path:    fullMethod,
+			Headers: headers,
+		},
+		User: user,
+	}
+
+	if !config.RequestFlow.PreventBodyLoad {
+		requestBody, err := parseRequestMessage(message)
+		if err != nil {
+			return core.Input{}, err
+		}
+		input.Request.Body = requestBody
+	}
+
+	return input, nil
+}
+
+func firstMetadataValue(md metadata.MD, key string) string {
+	if key == "" {
+		return ""
+	}
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
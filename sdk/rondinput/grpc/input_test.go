@@ -0,0 +1,74 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondgrpc
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rond-authz/rond/core"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRondInput(t *testing.T) {
+	config := &core.RondConfig{}
+	user := core.InputUser{ID: "piero"}
+	fullMethod := "/grpc.health.v1.Health/Check"
+	md := metadata.Pairs("client-type", "my-client", "x-custom", "value1", "x-custom", "value2")
+
+	t.Run("maps call to request", func(t *testing.T) {
+		input, err := NewInput(config, fullMethod, md, "client-type", nil, user)
+		require.NoError(t, err)
+		require.Equal(t, core.Input{
+			ClientType: "my-client",
+			Request: core.InputRequest{
+				Method: http.MethodPost,
+				Path:   fullMethod,
+				Headers: http.Header{
+					"Client-Type": []string{"my-client"},
+					"X-Custom":    []string{"value1", "value2"},
+				},
+			},
+			User: user,
+		}, input)
+	})
+
+	t.Run("proto message is set as JSON body", func(t *testing.T) {
+		input, err := NewInput(config, fullMethod, md, "client-type", &grpc_health_v1.HealthCheckRequest{Service: "my-service"}, user)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"service": "my-service"}, input.Request.Body)
+	})
+
+	t.Run("non proto message is set as JSON body", func(t *testing.T) {
+		input, err := NewInput(config, fullMethod, md, "client-type", struct{ Key int }{Key: 42}, user)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"Key": float64(42)}, input.Request.Body)
+	})
+
+	t.Run("body is not set if prevented by config", func(t *testing.T) {
+		config := &core.RondConfig{RequestFlow: core.RequestFlow{PreventBodyLoad: true}}
+		input, err := NewInput(config, fullMethod, md, "client-type", &grpc_health_v1.HealthCheckRequest{Service: "my-service"}, user)
+		require.NoError(t, err)
+		require.Nil(t, input.Request.Body)
+	})
+
+	t.Run("fails with message not serializable", func(t *testing.T) {
+		_, err := NewInput(config, fullMethod, md, "client-type", make(chan int), user)
+		require.ErrorContains(t, err, "failed request message serialization")
+	})
+}
@@ -0,0 +1,223 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/sdk"
+	"github.com/rond-authz/rond/sdk/inputuser"
+	"github.com/rond-authz/rond/types"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	DefaultUserIDMetadataKey         = "miauserid"
+	DefaultUserGroupsMetadataKey     = "miausergroups"
+	DefaultUserPropertiesMetadataKey = "miauserproperties"
+	DefaultClientTypeMetadataKey     = "client-type"
+	// DefaultRowFilterMetadataKey is the incoming metadata key set with the generated
+	// query, if the method does not configure a custom one.
+	DefaultRowFilterMetadataKey = "acl_rows"
+)
+
+// UserExtractor returns the user performing the call.
+type UserExtractor func(ctx context.Context, md metadata.MD) (types.User, error)
+
+type InterceptorOptions struct {
+	// UserExtractor defaults to a MetadataUserExtractor with the default keys.
+	UserExtractor UserExtractor
+	// InputUserClient, if set, is used to retrieve the user bindings and roles.
+	InputUserClient inputuser.Client
+	// ClientTypeMetadataKey defaults to DefaultClientTypeMetadataKey.
+	ClientTypeMetadataKey string
+	Logger                logging.Logger
+}
+
+// MetadataUserExtractor reads the user from the incoming metadata: the groups value is
+// a comma separated list, while the properties value is a JSON object.
+func MetadataUserExtractor(idKey, groupsKey, propertiesKey string) UserExtractor {
+	return func(ctx context.Context, md metadata.MD) (types.User, error) {
+		user := types.User{
+			ID:         firstMetadataValue(md, idKey),
+			Groups:     []string{},
+			Properties: map[string]interface{}{},
+		}
+		if groups := firstMetadataValue(md, groupsKey); groups != "" {
+			user.Groups = strings.Split(groups, ",")
+		}
+		if properties := firstMetadataValue(md, propertiesKey); properties != "" {
+			if err := json.Unmarshal([]byte(properties), &user.Properties); err != nil {
+				return types.User{}, fmt.Errorf("user properties metadata is not valid: %s", err.Error())
+			}
+		}
+		return user, nil
+	}
+}
+
+type authorizer struct {
+	finder                MethodEvaluatorFinder
+	userExtractor         UserExtractor
+	inputUserClient       inputuser.Client
+	clientTypeMetadataKey string
+	logger                logging.Logger
+}
+
+func newAuthorizer(finder MethodEvaluatorFinder, options *InterceptorOptions) authorizer {
+	if options == nil {
+		options = &InterceptorOptions{}
+	}
+	a := authorizer{
+		finder:                finder,
+		userExtractor:         options.UserExtractor,
+		inputUserClient:       options.InputUserClient,
+		clientTypeMetadataKey: options.ClientTypeMetadataKey,
+		logger:                options.Logger,
+	}
+	if a.userExtractor == nil {
+		a.userExtractor = MetadataUserExtractor(DefaultUserIDMetadataKey, DefaultUserGroupsMetadataKey, DefaultUserPropertiesMetadataKey)
+	}
+	if a.clientTypeMetadataKey == "" {
+		a.clientTypeMetadataKey = DefaultClientTypeMetadataKey
+	}
+	if a.logger == nil {
+		a.logger = logging.NewNoOpLogger()
+	}
+	return a
+}
+
+// authorize evaluates the request policy of the method and returns the context the
+// handler must be invoked with, which holds the evaluator and, if the method
+// generates a query, the row filter in the incoming metadata.
+// The returned error is a gRPC status error.
+func (a authorizer) authorize(ctx context.Context, fullMethod string, message any) (context.Context, error) {
+	logger := a.logger.WithField("grpcMethod", fullMethod)
+
+	evaluator, err := a.finder.FindEvaluator(fullMethod)
+	if err != nil {
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed to find evaluator")
+		return nil, status.Error(codes.PermissionDenied, "the method doesn't match any known API")
+	}
+	rondConfig := evaluator.Config()
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		md = metadata.MD{}
+	}
+
+	user, err := a.userExtractor(ctx, md)
+	if err != nil {
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed to get input user")
+		return nil, status.Error(codes.Internal, "failed to get input user")
+	}
+	inputUser, err := inputuser.Get(ctx, logger, a.inputUserClient, user)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get input user")
+	}
+
+	input, err := NewInput(&rondConfig, fullMethod, md, a.clientTypeMetadataKey, message, inputUser)
+	if err != nil {
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed to create rond input")
+		return nil, status.Error(codes.Internal, "failed to create rond input")
+	}
+
+	result, err := evaluator.EvaluateRequestPolicy(ctx, input, &sdk.EvaluateOptions{Logger: logger})
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("RBAC policy evaluation failed: %s", err.Error()))
+	}
+	if result.RateLimitExceeded {
+		return nil, rateLimitExceededError(result.RetryAfter)
+	}
+	if !result.Allowed {
+		return nil, status.Error(codes.PermissionDenied, "user is not allowed to call the method")
+	}
+
+	if result.QueryToProxy != nil {
+		md = md.Copy()
+		md.Set(rowFilterMetadataKey(rondConfig), string(result.QueryToProxy))
+		ctx = metadata.NewIncomingContext(ctx, md)
+	}
+	return sdk.WithEvaluator(ctx, evaluator), nil
+}
+
+// UnaryServerInterceptor returns a gRPC unary interceptor evaluating the request
+// policy configured for the called method with the request message as body.
+// Denied calls fail with the PermissionDenied code, while rate limited calls fail
+// with the ResourceExhausted code and the retry delay in the status details.
+func UnaryServerInterceptor(finder MethodEvaluatorFinder, options *InterceptorOptions) grpc.UnaryServerInterceptor {
+	a := newAuthorizer(finder, options)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		authorizedCtx, err := a.authorize(ctx, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(authorizedCtx, req)
+	}
+}
+
+// StreamServerInterceptor returns a gRPC stream interceptor evaluating the request
+// policy configured for the called method when the stream is opened. Since the
+// streamed messages are not known yet, the policy is evaluated without body.
+// Denied calls fail with the PermissionDenied code, while rate limited calls fail
+// with the ResourceExhausted code and the retry delay in the status details.
+func StreamServerInterceptor(finder MethodEvaluatorFinder, options *InterceptorOptions) grpc.StreamServerInterceptor {
+	a := newAuthorizer(finder, options)
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		authorizedCtx, err := a.authorize(stream.Context(), info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: stream, ctx: authorizedCtx})
+	}
+}
+
+// rateLimitExceededError returns the ResourceExhausted status error with the
+// time to wait before retrying the call as RetryInfo detail.
+func rateLimitExceededError(retryAfter time.Duration) error {
+	rateLimitStatus := status.New(codes.ResourceExhausted, "rate limit exceeded")
+	withRetryInfo, err := rateLimitStatus.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if err != nil {
+		return rateLimitStatus.Err()
+	}
+	return withRetryInfo.Err()
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func rowFilterMetadataKey(rondConfig core.RondConfig) string {
+	if rondConfig.RequestFlow.QueryOptions.HeaderName != "" {
+		return strings.ToLower(rondConfig.RequestFlow.QueryOptions.HeaderName)
+	}
+	return DefaultRowFilterMetadataKey
+}
@@ -0,0 +1,257 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondgrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/custom_builtins"
+	"github.com/rond-authz/rond/internal/fake"
+	"github.com/rond-authz/rond/sdk"
+	"github.com/rond-authz/rond/types"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	calls []context.Context
+}
+
+func (s *healthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	s.calls = append(s.calls, ctx)
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *healthServer) Watch(req *grpc_health_v1.HealthCheckRequest, stream grpc_health_v1.Health_WatchServer) error {
+	s.calls = append(s.calls, stream.Context())
+	return stream.Send(&grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING})
+}
+
+func startHealthServer(t *testing.T, finder MethodEvaluatorFinder, options *InterceptorOptions) (grpc_health_v1.HealthClient, *healthServer) {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(finder, options)),
+		grpc.StreamInterceptor(StreamServerInterceptor(finder, options)),
+	)
+	service := &healthServer{}
+	grpc_health_v1.RegisterHealthServer(server, service)
+	go func() {
+		//#nosec G104 -- the server is stopped at test cleanup
+		server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return grpc_health_v1.NewHealthClient(conn), service
+}
+
+func TestInterceptors(t *testing.T) {
+	opaModule := &core.OPAModuleConfig{
+		Name: "example.rego",
+		Content: `package policies
+allow_service {
+	resource := data.resources[_]
+	resource.service == input.request.body.service
+}
+allow_admin {
+	input.user.groups[_] == "admin"
+}
+allow_binding {
+	binding := input.user.bindings[_]
+	binding.resource.resourceId == input.request.body.service
+}`,
+	}
+	config, err := LoadConfigFile("../../../mocks/grpcConfig.json")
+	require.NoError(t, err)
+	finder, err := NewMethodEvaluatorFinder(context.Background(), opaModule, config, nil)
+	require.NoError(t, err)
+
+	t.Run("unary call is allowed with row filter", func(t *testing.T) {
+		client, service := startHealthServer(t, finder, nil)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), DefaultUserIDMetadataKey, "piero")
+		res, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "my-service"})
+		require.NoError(t, err)
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, res.Status)
+
+		require.Len(t, service.calls, 1)
+		md, ok := metadata.FromIncomingContext(service.calls[0])
+		require.True(t, ok)
+		require.Equal(t, []string{"piero"}, md.Get(DefaultUserIDMetadataKey))
+		require.Len(t, md.Get("x-query"), 1)
+		require.JSONEq(t, `{"$or":[{"$and":[{"service":{"$eq":"my-service"}}]}]}`, md.Get("x-query")[0])
+
+		evaluator, err := sdk.GetEvaluator(service.calls[0])
+		require.NoError(t, err)
+		require.Equal(t, "allow_service", evaluator.Config().RequestFlow.PolicyName)
+	})
+
+	t.Run("stream call is allowed", func(t *testing.T) {
+		client, service := startHealthServer(t, finder, nil)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), DefaultUserGroupsMetadataKey, "users,admin")
+		stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, res.Status)
+
+		require.Len(t, service.calls, 1)
+		evaluator, err := sdk.GetEvaluator(service.calls[0])
+		require.NoError(t, err)
+		require.Equal(t, "allow_admin", evaluator.Config().RequestFlow.PolicyName)
+	})
+
+	t.Run("stream call is denied", func(t *testing.T) {
+		client, service := startHealthServer(t, finder, nil)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), DefaultUserGroupsMetadataKey, "users")
+		stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+		require.Empty(t, service.calls)
+	})
+
+	t.Run("rate limited call is exhausted with retry info", func(t *testing.T) {
+		opaModule := &core.OPAModuleConfig{Name: "example.rego", Content: `package policies
+allow_limited {
+	rate_limit(input.user.id, 1, "1m")
+}`}
+		finder, err := NewMethodEvaluatorFinder(context.Background(), opaModule, &Config{
+			Methods: map[string]MethodConfig{
+				"/grpc.health.v1.Health/Check": {
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_limited"}},
+				},
+			},
+		}, &sdk.Options{
+			EvaluatorOptions: &sdk.EvaluatorOptions{
+				RateLimitStore: custom_builtins.NewInMemoryRateLimitStore(),
+			},
+		})
+		require.NoError(t, err)
+		client, service := startHealthServer(t, finder, nil)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), DefaultUserIDMetadataKey, "piero")
+		_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+
+		_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		details := status.Convert(err).Details()
+		require.Len(t, details, 1)
+		retryInfo, ok := details[0].(*errdetails.RetryInfo)
+		require.True(t, ok)
+		require.InDelta(t, time.Minute, retryInfo.RetryDelay.AsDuration(), float64(time.Second))
+		require.Len(t, service.calls, 1)
+	})
+
+	t.Run("method not configured is denied", func(t *testing.T) {
+		finder, err := NewMethodEvaluatorFinder(context.Background(), opaModule, &Config{}, nil)
+		require.NoError(t, err)
+		client, service := startHealthServer(t, finder, nil)
+
+		_, err = client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "my-service"})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+		require.Equal(t, "the method doesn't match any known API", status.Convert(err).Message())
+		require.Empty(t, service.calls)
+	})
+
+	t.Run("uses custom user extractor and input user client", func(t *testing.T) {
+		finder, err := NewMethodEvaluatorFinder(context.Background(), opaModule, &Config{
+			Methods: map[string]MethodConfig{
+				"/grpc.health.v1.Health/Check": {PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_binding"}}},
+			},
+		}, nil)
+		require.NoError(t, err)
+		client, service := startHealthServer(t, finder, &InterceptorOptions{
+			UserExtractor: func(ctx context.Context, md metadata.MD) (types.User, error) {
+				return types.User{ID: md.Get("x-user")[0]}, nil
+			},
+			InputUserClient: &fake.InputUserClient{
+				UserBindings: []types.Binding{
+					{BindingID: "b1", Subjects: []string{"piero"}, Resource: &types.Resource{ResourceType: "service", ResourceID: "my-service"}},
+				},
+				UserRoles: []types.Role{},
+			},
+		})
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user", "piero")
+		_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "my-service"})
+		require.NoError(t, err)
+		require.Len(t, service.calls, 1)
+
+		_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "other-service"})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+		require.Len(t, service.calls, 1)
+	})
+
+	t.Run("fails if user extraction fails", func(t *testing.T) {
+		client, service := startHealthServer(t, finder, &InterceptorOptions{
+			UserExtractor: func(ctx context.Context, md metadata.MD) (types.User, error) {
+				return types.User{}, errors.New("invalid token")
+			},
+		})
+
+		_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "my-service"})
+		require.Equal(t, codes.Internal, status.Code(err))
+		require.Empty(t, service.calls)
+	})
+}
+
+func TestMetadataUserExtractor(t *testing.T) {
+	extractor := MetadataUserExtractor("x-user", "x-groups", "x-properties")
+
+	t.Run("reads user from metadata", func(t *testing.T) {
+		md := metadata.Pairs("x-user", "piero", "x-groups", "litfiba,band", "x-properties", `{"name":"Piero"}`)
+
+		user, err := extractor(context.Background(), md)
+		require.NoError(t, err)
+		require.Equal(t, types.User{
+			ID:         "piero",
+			Groups:     []string{"litfiba", "band"},
+			Properties: map[string]interface{}{"name": "Piero"},
+		}, user)
+	})
+
+	t.Run("fails with invalid properties", func(t *testing.T) {
+		_, err := extractor(context.Background(), metadata.Pairs("x-properties", `{not-json`))
+		require.ErrorContains(t, err, "user properties metadata is not valid")
+	})
+}
@@ -63,6 +63,7 @@ func NewInput(
 			Headers:    req.Header,
 			Query:      req.URL.Query(),
 			PathParams: pathParams,
+			TLS:        core.NewInputRequestTLS(req.TLS),
 		},
 		Response: core.InputResponse{
 			Body: responseBody,
@@ -16,9 +16,15 @@ package rondhttp
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/rond-authz/rond/core"
@@ -129,4 +135,42 @@ func TestRondInput(t *testing.T) {
 		require.Equal(t, user.ID, input.User.ID)
 		require.EqualValues(t, user.Properties, input.User.Properties)
 	})
+
+	t.Run("request tls peer certificate", func(t *testing.T) {
+		t.Run("not set for plain http requests", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			input, err := NewInput(config, req, clientTypeHeaderKey, pathParams, user, nil)
+			require.NoError(t, err, "Unexpected error")
+			require.Nil(t, input.Request.TLS)
+		})
+
+		t.Run("set from the verified client certificate", func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.TLS = &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{{
+					Subject:      pkix.Name{CommonName: "rond-client", Organization: []string{"rond"}},
+					Issuer:       pkix.Name{CommonName: "rond CA"},
+					SerialNumber: big.NewInt(42),
+					DNSNames:     []string{"client.rond.test"},
+					URIs:         []*url.URL{{Scheme: "spiffe", Host: "rond.test", Path: "/client"}},
+					IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+				}}},
+			}
+
+			input, err := NewInput(config, req, clientTypeHeaderKey, pathParams, user, nil)
+			require.NoError(t, err, "Unexpected error")
+			require.Equal(t, &core.InputRequestTLS{
+				PeerCertificate: &core.InputPeerCertificate{
+					Subject:      "CN=rond-client,O=rond",
+					CommonName:   "rond-client",
+					Issuer:       "CN=rond CA",
+					SerialNumber: "42",
+					DNSNames:     []string{"client.rond.test"},
+					URIs:         []string{"spiffe://rond.test/client"},
+					IPAddresses:  []string{"10.0.0.1"},
+				},
+			}, input.Request.TLS)
+		})
+	})
 }
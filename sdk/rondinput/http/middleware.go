@@ -0,0 +1,210 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondhttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/opatranslator"
+	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/openapi"
+	"github.com/rond-authz/rond/sdk"
+	"github.com/rond-authz/rond/sdk/inputuser"
+	"github.com/rond-authz/rond/types"
+)
+
+const (
+	DefaultUserIDHeader         = "miauserid"
+	DefaultUserGroupsHeader     = "miausergroups"
+	DefaultUserPropertiesHeader = "miauserproperties"
+	DefaultClientTypeHeader     = "Client-Type"
+	// DefaultRowFilterHeader is the request header set with the generated query,
+	// if the route does not configure a custom one.
+	DefaultRowFilterHeader = "acl_rows"
+)
+
+var (
+	ErrRouteNotFound     = errors.New("the request doesn't match any known API")
+	ErrNotAllowed        = errors.New("user is not allowed to request the API")
+	ErrUserExtraction    = errors.New("failed to get input user")
+	ErrInputCreation     = errors.New("failed to create rond input")
+	ErrPolicyEvaluation  = errors.New("RBAC policy evaluation failed")
+	ErrMissingPolicyName = errors.New("no policy configured for the API")
+	ErrRateLimitExceeded = errors.New("rate limit exceeded")
+)
+
+// UserExtractor returns the user performing the request.
+type UserExtractor func(r *http.Request) (types.User, error)
+
+// ErrorRenderer writes the response of a request that is not forwarded to the next handler.
+// The error wraps one of the errors exported by this package.
+type ErrorRenderer func(w http.ResponseWriter, r *http.Request, statusCode int, err error)
+
+type MiddlewareOptions struct {
+	// UserExtractor defaults to a HeadersUserExtractor with the default headers.
+	UserExtractor UserExtractor
+	// InputUserClient, if set, is used to retrieve the user bindings and roles.
+	InputUserClient inputuser.Client
+	// ErrorRenderer defaults to a JSON response with the same format used by rond.
+	ErrorRenderer ErrorRenderer
+	// ClientTypeHeader defaults to DefaultClientTypeHeader.
+	ClientTypeHeader string
+	Logger           logging.Logger
+}
+
+// HeadersUserExtractor reads the user from the request headers: the groups header is
+// a comma separated list, while the properties header is a JSON object.
+func HeadersUserExtractor(idHeader, groupsHeader, propertiesHeader string) UserExtractor {
+	return func(r *http.Request) (types.User, error) {
+		user := types.User{
+			ID:     r.Header.Get(idHeader),
+			Groups: []string{},
+		}
+		if groups := r.Header.Get(groupsHeader); groups != "" {
+			user.Groups = strings.Split(groups, ",")
+		}
+
+		userProperties := make(map[string]interface{})
+		if _, err := utils.UnmarshalHeader(r.Header, propertiesHeader, &userProperties); err != nil {
+			return types.User{}, fmt.Errorf("user properties header is not valid: %s", err.Error())
+		}
+		user.Properties = userProperties
+		return user, nil
+	}
+}
+
+// DefaultErrorRenderer writes the error as a JSON types.RequestError.
+func DefaultErrorRenderer(w http.ResponseWriter, r *http.Request, statusCode int, err error) {
+	businessError := utils.NO_PERMISSIONS_ERROR_MESSAGE
+	if statusCode == http.StatusTooManyRequests {
+		businessError = utils.RATE_LIMIT_ERROR_MESSAGE
+	}
+	if statusCode >= http.StatusInternalServerError {
+		businessError = utils.GENERIC_BUSINESS_ERROR_MESSAGE
+	}
+	utils.FailResponseWithCode(w, statusCode, err.Error(), businessError)
+}
+
+// NewMiddleware returns a net/http middleware evaluating the request policy of the
+// matched OAS route. Allowed requests are forwarded to the next handler with the
+// evaluator in the request context (see sdk.GetEvaluator) and, if the route generates
+// a query, with the row filter header set.
+//
+// The path params of the input are the ones of the matched route, so they are
+// empty if the finder does not implement sdk.RouteFinder.
+//
+// Response policies are not applied by the middleware.
+func NewMiddleware(finder sdk.OASEvaluatorFinder, options *MiddlewareOptions) func(http.Handler) http.Handler {
+	if options == nil {
+		options = &MiddlewareOptions{}
+	}
+	userExtractor := options.UserExtractor
+	if userExtractor == nil {
+		userExtractor = HeadersUserExtractor(DefaultUserIDHeader, DefaultUserGroupsHeader, DefaultUserPropertiesHeader)
+	}
+	renderError := options.ErrorRenderer
+	if renderError == nil {
+		renderError = DefaultErrorRenderer
+	}
+	clientTypeHeader := options.ClientTypeHeader
+	if clientTypeHeader == "" {
+		clientTypeHeader = DefaultClientTypeHeader
+	}
+	logger := options.Logger
+	if logger == nil {
+		logger = logging.NewNoOpLogger()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			evaluator, route, err := sdk.FindEvaluatorAndRoute(finder, r.Method, r.URL.EscapedPath())
+			if err != nil {
+				logger.WithField("error", map[string]any{"message": err.Error()}).Error(ErrRouteNotFound.Error())
+				statusCode := http.StatusForbidden
+				if errors.Is(err, openapi.ErrNotFoundOASDefinition) {
+					statusCode = http.StatusNotFound
+				}
+				renderError(w, r, statusCode, fmt.Errorf("%w: %s", ErrRouteNotFound, err.Error()))
+				return
+			}
+
+			rondConfig := evaluator.Config()
+			if rondConfig.RequestFlow.PolicyName == "" {
+				renderError(w, r, http.StatusForbidden, ErrMissingPolicyName)
+				return
+			}
+
+			user, err := userExtractor(r)
+			if err != nil {
+				logger.WithField("error", map[string]any{"message": err.Error()}).Error(ErrUserExtraction.Error())
+				renderError(w, r, http.StatusInternalServerError, fmt.Errorf("%w: %s", ErrUserExtraction, err.Error()))
+				return
+			}
+			inputUser, err := inputuser.Get(r.Context(), logger, options.InputUserClient, user)
+			if err != nil {
+				renderError(w, r, http.StatusInternalServerError, fmt.Errorf("%w: %s", ErrUserExtraction, err.Error()))
+				return
+			}
+
+			input, err := NewInput(&rondConfig, r, clientTypeHeader, route.PathParams, inputUser, nil)
+			if err != nil {
+				logger.WithField("error", map[string]any{"message": err.Error()}).Error(ErrInputCreation.Error())
+				renderError(w, r, http.StatusInternalServerError, fmt.Errorf("%w: %s", ErrInputCreation, err.Error()))
+				return
+			}
+
+			result, err := evaluator.EvaluateRequestPolicy(r.Context(), input, &sdk.EvaluateOptions{Logger: logger})
+			if err != nil {
+				// As in rond, an empty query on a JSON request is a list with all elements filtered out.
+				if errors.Is(err, opatranslator.ErrEmptyQuery) && utils.HasApplicationJSONContentType(r.Header) {
+					w.Header().Set(utils.ContentTypeHeaderKey, utils.JSONContentTypeHeader)
+					w.WriteHeader(http.StatusOK)
+					if _, err := w.Write([]byte("[]")); err != nil {
+						logger.WithField("error", map[string]any{"message": err.Error()}).Warn("failed response write")
+					}
+					return
+				}
+				renderError(w, r, http.StatusForbidden, fmt.Errorf("%w: %s", ErrPolicyEvaluation, err.Error()))
+				return
+			}
+			if result.RateLimitExceeded {
+				utils.SetRetryAfterHeader(w.Header(), result.RetryAfter)
+				renderError(w, r, http.StatusTooManyRequests, ErrRateLimitExceeded)
+				return
+			}
+			if !result.Allowed {
+				renderError(w, r, http.StatusForbidden, ErrNotAllowed)
+				return
+			}
+
+			if result.QueryToProxy != nil {
+				r.Header.Set(rowFilterHeader(rondConfig), string(result.QueryToProxy))
+			}
+			next.ServeHTTP(w, r.WithContext(sdk.WithEvaluator(r.Context(), evaluator)))
+		})
+	}
+}
+
+func rowFilterHeader(rondConfig core.RondConfig) string {
+	if rondConfig.RequestFlow.QueryOptions.HeaderName != "" {
+		return rondConfig.RequestFlow.QueryOptions.HeaderName
+	}
+	return DefaultRowFilterHeader
+}
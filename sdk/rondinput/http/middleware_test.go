@@ -0,0 +1,292 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rondhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/custom_builtins"
+	"github.com/rond-authz/rond/internal/fake"
+	"github.com/rond-authz/rond/openapi"
+	"github.com/rond-authz/rond/sdk"
+	"github.com/rond-authz/rond/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	opaModule := &core.OPAModuleConfig{
+		Name: "example.rego",
+		Content: `package policies
+allow_own_user { input.request.pathParams.userId == input.user.id }
+allow_project_member {
+	binding := input.user.bindings[_]
+	binding.resource.resourceId == input.request.pathParams.projectId
+}
+filter_projects {
+	project := data.resources[_]
+	project.members[_] == input.user.id
+}
+filter_nothing {
+	project := data.resources[_]
+	false
+}`,
+	}
+	oas := &openapi.OpenAPISpec{
+		Paths: openapi.OpenAPIPaths{
+			"/users/{userId}": openapi.PathVerbs{
+				"get": openapi.VerbConfig{PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_own_user"}}},
+			},
+			"/projects/{projectId}": openapi.PathVerbs{
+				"get": openapi.VerbConfig{PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_project_member"}}},
+			},
+			"/projects/": openapi.PathVerbs{
+				"get": openapi.VerbConfig{PermissionV2: &core.RondConfig{
+					RequestFlow: core.RequestFlow{
+						PolicyName:    "filter_projects",
+						GenerateQuery: true,
+						QueryOptions:  core.QueryOptions{HeaderName: "x-query"},
+					},
+				}},
+			},
+			"/empty/": openapi.PathVerbs{
+				"get": openapi.VerbConfig{PermissionV2: &core.RondConfig{
+					RequestFlow: core.RequestFlow{PolicyName: "filter_nothing", GenerateQuery: true},
+				}},
+			},
+			"/no-policy": openapi.PathVerbs{
+				"get": openapi.VerbConfig{PermissionV2: &core.RondConfig{}},
+			},
+		},
+	}
+	finder, err := sdk.NewFromOAS(context.Background(), opaModule, oas, nil)
+	require.NoError(t, err)
+
+	var invoked bool
+	var forwardedRequest *http.Request
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		invoked = true
+		forwardedRequest = r
+		w.WriteHeader(http.StatusNoContent)
+	})
+	serve := func(t *testing.T, options *MiddlewareOptions, req *http.Request) *httptest.ResponseRecorder {
+		t.Helper()
+		invoked = false
+		forwardedRequest = nil
+
+		w := httptest.NewRecorder()
+		NewMiddleware(finder, options)(next).ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("forwards allowed requests using path params and default user headers", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users/piero", nil)
+		req.Header.Set(DefaultUserIDHeader, "piero")
+
+		w := serve(t, nil, req)
+
+		require.Equal(t, http.StatusNoContent, w.Code)
+		require.True(t, invoked)
+		evaluator, err := sdk.GetEvaluator(forwardedRequest.Context())
+		require.NoError(t, err)
+		require.Equal(t, "allow_own_user", evaluator.Config().RequestFlow.PolicyName)
+	})
+
+	t.Run("renders forbidden for denied requests", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users/piero", nil)
+		req.Header.Set(DefaultUserIDHeader, "ghigo")
+
+		w := serve(t, nil, req)
+
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.False(t, invoked)
+		require.JSONEq(t, `{
+			"error": "user is not allowed to request the API",
+			"message": "You do not have permissions to access this feature, contact the administrator for more information.",
+			"statusCode": 403
+		}`, w.Body.String())
+	})
+
+	t.Run("renders not found for unknown routes", func(t *testing.T) {
+		w := serve(t, nil, httptest.NewRequest(http.MethodPost, "/users/piero", nil))
+
+		require.Equal(t, http.StatusNotFound, w.Code)
+		require.False(t, invoked)
+	})
+
+	t.Run("renders forbidden for routes without policy", func(t *testing.T) {
+		w := serve(t, nil, httptest.NewRequest(http.MethodGet, "/no-policy", nil))
+
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.False(t, invoked)
+	})
+
+	t.Run("uses custom user extractor and input user client", func(t *testing.T) {
+		var userExtractorInvoked bool
+		w := serve(t, &MiddlewareOptions{
+			UserExtractor: func(r *http.Request) (types.User, error) {
+				userExtractorInvoked = true
+				return types.User{ID: "piero"}, nil
+			},
+			InputUserClient: &fake.InputUserClient{
+				UserBindings: []types.Binding{
+					{BindingID: "b1", Subjects: []string{"piero"}, Resource: &types.Resource{ResourceType: "project", ResourceID: "p1"}},
+				},
+				UserRoles: []types.Role{},
+			},
+		}, httptest.NewRequest(http.MethodGet, "/projects/p1", nil))
+
+		require.Equal(t, http.StatusNoContent, w.Code)
+		require.True(t, userExtractorInvoked)
+		require.True(t, invoked)
+	})
+
+	t.Run("renders internal error if user extraction fails", func(t *testing.T) {
+		w := serve(t, &MiddlewareOptions{
+			UserExtractor: func(r *http.Request) (types.User, error) {
+				return types.User{}, errors.New("invalid token")
+			},
+		}, httptest.NewRequest(http.MethodGet, "/users/piero", nil))
+
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		require.False(t, invoked)
+	})
+
+	t.Run("renders internal error if input user client fails", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/projects/p1", nil)
+		req.Header.Set(DefaultUserIDHeader, "piero")
+
+		w := serve(t, &MiddlewareOptions{
+			InputUserClient: &fake.InputUserClient{UserBindingsError: errors.New("some error")},
+		}, req)
+
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+		require.False(t, invoked)
+	})
+
+	t.Run("uses custom error renderer", func(t *testing.T) {
+		var renderedErr error
+		w := serve(t, &MiddlewareOptions{
+			ErrorRenderer: func(w http.ResponseWriter, r *http.Request, statusCode int, err error) {
+				renderedErr = err
+				w.WriteHeader(statusCode)
+				_, _ = w.Write([]byte("denied"))
+			},
+		}, httptest.NewRequest(http.MethodGet, "/users/piero", nil))
+
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.Equal(t, "denied", w.Body.String())
+		require.ErrorIs(t, renderedErr, ErrNotAllowed)
+	})
+
+	t.Run("sets row filter header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/projects/", nil)
+		req.Header.Set(DefaultUserIDHeader, "piero")
+
+		w := serve(t, nil, req)
+
+		require.Equal(t, http.StatusNoContent, w.Code)
+		require.True(t, invoked)
+		require.JSONEq(t, `{"$or":[{"$and":[{"members":{"$eq":"piero"}}]}]}`, forwardedRequest.Header.Get("x-query"))
+	})
+
+	t.Run("returns empty list for JSON requests with empty row filter", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/empty/", strings.NewReader(""))
+		req.Header.Set("content-type", "application/json")
+
+		w := serve(t, nil, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "[]", w.Body.String())
+		require.False(t, invoked)
+	})
+}
+
+func TestMiddlewareRateLimit(t *testing.T) {
+	opaModule := &core.OPAModuleConfig{
+		Name: "example.rego",
+		Content: `package policies
+allow_export { rate_limit(input.user.id, 1, "1h") }`,
+	}
+	oas := &openapi.OpenAPISpec{
+		Paths: openapi.OpenAPIPaths{
+			"/export": openapi.PathVerbs{
+				"get": openapi.VerbConfig{PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_export"}}},
+			},
+		},
+	}
+	finder, err := sdk.NewFromOAS(context.Background(), opaModule, oas, &sdk.Options{
+		EvaluatorOptions: &sdk.EvaluatorOptions{
+			RateLimitStore: custom_builtins.NewInMemoryRateLimitStore(),
+		},
+	})
+	require.NoError(t, err)
+
+	serve := func(t *testing.T) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/export", nil)
+		req.Header.Set(DefaultUserIDHeader, "piero")
+
+		w := httptest.NewRecorder()
+		NewMiddleware(finder, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})).ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusNoContent, serve(t).Code)
+
+	w := serve(t)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "3600", w.Header().Get("Retry-After"))
+	require.JSONEq(t, `{
+		"error": "rate limit exceeded",
+		"message": "You have exceeded the allowed number of requests, please try again later",
+		"statusCode": 429
+	}`, w.Body.String())
+}
+
+func TestHeadersUserExtractor(t *testing.T) {
+	extractor := HeadersUserExtractor("x-user", "x-groups", "x-properties")
+
+	t.Run("reads user from headers", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("x-user", "piero")
+		req.Header.Set("x-groups", "litfiba,band")
+		req.Header.Set("x-properties", `{"name":"Piero"}`)
+
+		user, err := extractor(req)
+		require.NoError(t, err)
+		require.Equal(t, types.User{
+			ID:         "piero",
+			Groups:     []string{"litfiba", "band"},
+			Properties: map[string]interface{}{"name": "Piero"},
+		}, user)
+	})
+
+	t.Run("fails with invalid properties", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("x-properties", `{not-json`)
+
+		_, err := extractor(req)
+		require.ErrorContains(t, err, "user properties header is not valid")
+	})
+}
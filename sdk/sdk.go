@@ -17,6 +17,7 @@ package sdk
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/rond-authz/rond/core"
 	"github.com/rond-authz/rond/custom_builtins"
@@ -26,7 +27,12 @@ import (
 )
 
 type EvaluatorOptions struct {
-	MongoClient           custom_builtins.IMongoClient
+	MongoClient custom_builtins.IMongoClient
+	// RateLimitStore keeps the hits of the rate limits checked by the policies
+	// with the rate_limit builtin.
+	RateLimitStore custom_builtins.RateLimitStore
+	// EnablePrintStatements writes the output of the policies print statements
+	// for all the evaluations.
 	EnablePrintStatements bool
 }
 
@@ -34,6 +40,7 @@ func (e EvaluatorOptions) opaEvaluatorOptions(logger logging.Logger) *core.OPAEv
 	return &core.OPAEvaluatorOptions{
 		Logger:                logger,
 		MongoClient:           e.MongoClient,
+		RateLimitStore:        e.RateLimitStore,
 		EnablePrintStatements: e.EnablePrintStatements,
 	}
 }
@@ -42,6 +49,13 @@ type Options struct {
 	EvaluatorOptions *EvaluatorOptions
 	Metrics          *metrics.Metrics
 	Logger           logging.Logger
+	// FailOnMissingPolicies makes the evaluators creation fail if a policy of the
+	// rond configuration is not defined in the rego module, instead of logging a warning.
+	FailOnMissingPolicies bool
+	// SkipMissingPoliciesCheck disables the check of the policies not defined in the
+	// rego module, e.g. when they are already reported by openapi.OpenAPISpec.Validate.
+	// The policies not referenced by the rond configuration are still reported.
+	SkipMissingPoliciesCheck bool
 }
 
 func NewFromOAS(ctx context.Context, opaModuleConfig *core.OPAModuleConfig, oas *openapi.OpenAPISpec, options *Options) (OASEvaluatorFinder, error) {
@@ -70,6 +84,10 @@ func NewFromOAS(ctx context.Context, opaModuleConfig *core.OPAModuleConfig, oas
 
 	logger.WithField("policiesLength", len(evaluator)).Debug("policies evaluators partial results computed")
 
+	if err := checkPolicies(logger, opaModuleConfig, oasPolicies(oas), options, true); err != nil {
+		return nil, err
+	}
+
 	oasRouter, err := oas.PrepareOASRouter()
 	if err != nil {
 		return nil, fmt.Errorf("invalid OAS configuration: %s", err)
@@ -82,7 +100,7 @@ func NewFromOAS(ctx context.Context, opaModuleConfig *core.OPAModuleConfig, oas
 		opaModuleConfig:         opaModuleConfig,
 		partialResultEvaluators: evaluator,
 		evaluatorOptions:        evaluatorOptions,
-		metrics:                 options.Metrics,
+		metrics:                 metrics.WithNoOpDefaults(options.Metrics),
 	}, nil
 }
 
@@ -105,6 +123,10 @@ func NewWithConfig(ctx context.Context, opaModuleConfig *core.OPAModuleConfig, r
 		return nil, err
 	}
 
+	if err := checkPolicies(logger, opaModuleConfig, rondConfigPolicies(rondConfig), options, false); err != nil {
+		return nil, err
+	}
+
 	return evaluator{
 		rondConfig:              rondConfig,
 		opaModuleConfig:         opaModuleConfig,
@@ -112,7 +134,53 @@ func NewWithConfig(ctx context.Context, opaModuleConfig *core.OPAModuleConfig, r
 
 		evaluatorOptions: evaluatorOptions,
 		policyEvaluationOptions: &core.PolicyEvaluationOptions{
-			Metrics: options.Metrics,
+			Metrics: metrics.WithNoOpDefaults(options.Metrics),
 		},
 	}, nil
 }
+
+// checkPolicies reports the policies of the rond configuration not defined in the
+// rego module, since their evaluation would always deny the requests, and, if
+// reportUnused is set, the defined policies not referenced by the configuration
+// nor by other policies.
+func checkPolicies(logger logging.Logger, opaModuleConfig *core.OPAModuleConfig, policies []string, options *Options, reportUnused bool) error {
+	missingPolicies, unusedPolicies, err := opaModuleConfig.CheckPolicies(policies)
+	if err != nil {
+		// the invalid module is reported by the evaluators creation
+		return nil
+	}
+
+	if len(missingPolicies) > 0 && !options.SkipMissingPoliciesCheck {
+		if options.FailOnMissingPolicies {
+			return fmt.Errorf("%w: %s", core.ErrPolicyNotDefined, strings.Join(missingPolicies, ", "))
+		}
+		logger.WithField("missingPolicies", missingPolicies).Warn("policies not defined in rego module")
+	}
+	if reportUnused && len(unusedPolicies) > 0 {
+		logger.WithField("unusedPolicies", unusedPolicies).Warn("policies not referenced by the rond configuration")
+	}
+	return nil
+}
+
+func oasPolicies(oas *openapi.OpenAPISpec) []string {
+	policies := []string{}
+	for _, pathVerbs := range oas.Paths {
+		for _, verbConfig := range pathVerbs {
+			if verbConfig.PermissionV2 != nil {
+				policies = append(policies, rondConfigPolicies(*verbConfig.PermissionV2)...)
+			}
+		}
+	}
+	return policies
+}
+
+func rondConfigPolicies(rondConfig core.RondConfig) []string {
+	policies := []string{}
+	if rondConfig.RequestFlow.PolicyName != "" {
+		policies = append(policies, rondConfig.RequestFlow.PolicyName)
+	}
+	if rondConfig.ResponseFlow.PolicyName != "" {
+		policies = append(policies, rondConfig.ResponseFlow.PolicyName)
+	}
+	return policies
+}
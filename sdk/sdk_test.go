@@ -24,6 +24,7 @@ import (
 	"github.com/rond-authz/rond/custom_builtins"
 	"github.com/rond-authz/rond/custom_builtins/mocks"
 	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/logging/test"
 	"github.com/rond-authz/rond/metrics"
 	"github.com/rond-authz/rond/openapi"
 
@@ -127,6 +128,84 @@ func TestNewFromOas(t *testing.T) {
 	})
 }
 
+func TestNewFromOasPoliciesCheck(t *testing.T) {
+	ctx := context.Background()
+	opaModule := &core.OPAModuleConfig{
+		Name: "example.rego",
+		Content: `package policies
+		allow { true }
+		unused_policy { true }`,
+	}
+	oas := &openapi.OpenAPISpec{
+		Paths: openapi.OpenAPIPaths{
+			"/users/": openapi.PathVerbs{
+				"get": openapi.VerbConfig{
+					PermissionV2: &core.RondConfig{
+						RequestFlow:  core.RequestFlow{PolicyName: "allow"},
+						ResponseFlow: core.ResponseFlow{PolicyName: "not.existing.policy"},
+					},
+				},
+			},
+		},
+	}
+
+	t.Run("logs missing and unused policies", func(t *testing.T) {
+		logger := test.GetLogger()
+		sdk, err := NewFromOAS(ctx, opaModule, oas, &Options{Logger: logger})
+		require.NoError(t, err)
+		require.NotNil(t, sdk)
+
+		records, err := test.GetRecords(logger)
+		require.NoError(t, err)
+		warnings := []test.Record{}
+		for _, record := range records {
+			if record.Level == "warn" {
+				warnings = append(warnings, record)
+			}
+		}
+		require.Equal(t, []test.Record{
+			{
+				Message: "policies not defined in rego module",
+				Level:   "warn",
+				Fields:  map[string]any{"missingPolicies": []string{"not.existing.policy"}},
+			},
+			{
+				Message: "policies not referenced by the rond configuration",
+				Level:   "warn",
+				Fields:  map[string]any{"unusedPolicies": []string{"unused_policy"}},
+			},
+		}, warnings)
+	})
+
+	t.Run("does not check missing policies if SkipMissingPoliciesCheck is set", func(t *testing.T) {
+		logger := test.GetLogger()
+		sdk, err := NewFromOAS(ctx, opaModule, oas, &Options{
+			Logger:                   logger,
+			FailOnMissingPolicies:    true,
+			SkipMissingPoliciesCheck: true,
+		})
+		require.NoError(t, err)
+		require.NotNil(t, sdk)
+
+		records, err := test.GetRecords(logger)
+		require.NoError(t, err)
+		warnings := []string{}
+		for _, record := range records {
+			if record.Level == "warn" {
+				warnings = append(warnings, record.Message)
+			}
+		}
+		require.Equal(t, []string{"policies not referenced by the rond configuration"}, warnings)
+	})
+
+	t.Run("throws for missing policies if FailOnMissingPolicies is set", func(t *testing.T) {
+		sdk, err := NewFromOAS(ctx, opaModule, oas, &Options{FailOnMissingPolicies: true})
+		require.ErrorIs(t, err, core.ErrPolicyNotDefined)
+		require.EqualError(t, err, "policy not defined in rego module: not.existing.policy")
+		require.Nil(t, sdk)
+	})
+}
+
 func TestNewWithConfig(t *testing.T) {
 	opaModule := &core.OPAModuleConfig{
 		Name: "example.rego",
@@ -159,6 +238,14 @@ func TestNewWithConfig(t *testing.T) {
 		require.Nil(t, sdk)
 	})
 
+	t.Run("throws for missing policies if FailOnMissingPolicies is set", func(t *testing.T) {
+		evaluator, err := NewWithConfig(ctx, opaModule, core.RondConfig{
+			RequestFlow: core.RequestFlow{PolicyName: "not_existing_policy"},
+		}, &Options{FailOnMissingPolicies: true})
+		require.EqualError(t, err, "policy not defined in rego module: not_existing_policy")
+		require.Nil(t, evaluator)
+	})
+
 	t.Run("ok with nil options", func(t *testing.T) {
 		evaluator, err := NewWithConfig(ctx, opaModule, rondConfig, nil)
 		require.NoError(t, err)
@@ -0,0 +1,103 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/sdk"
+	"github.com/rond-authz/rond/sdk/inputuser"
+
+	"github.com/gorilla/mux"
+)
+
+// evaluationHandler evaluates the requests rebuilt from the ones received by the
+// external authorization integrations. Requests are evaluated as in standalone
+// mode, so that allowed requests receive an empty successful response with the
+// row filter header, if any.
+type evaluationHandler struct {
+	sdkBoot *SDKBootState
+	handler http.Handler
+}
+
+func newEvaluationHandler(
+	env config.EnvironmentVariables,
+	opaModuleConfig *core.OPAModuleConfig,
+	sdkBoot *SDKBootState,
+	inputUserClient inputuser.Client,
+) evaluationHandler {
+	// The standalone mode responds instead of proxying the request to the target service.
+	env.Standalone = true
+	handler := OPAMiddleware(opaModuleConfig, sdkBoot, nil, "", nil)(http.HandlerFunc(rbacHandler))
+	if inputUserClient != nil {
+		handler = inputuser.ClientInjectorMiddleware(inputUserClient)(handler)
+	}
+
+	return evaluationHandler{
+		sdkBoot: sdkBoot,
+		handler: config.RequestMiddlewareEnvironments(env)(printStatementsMiddleware(env)(handler)),
+	}
+}
+
+// evaluate returns the response rond would have produced for the request.
+func (h evaluationHandler) evaluate(req *http.Request) *bufferedResponseWriter {
+	// Path params are read from the mux vars, which are not set since the
+	// request is not served by the router.
+	if rondSDK := h.sdkBoot.Get(); rondSDK != nil {
+		if _, route, err := sdk.FindEvaluatorAndRoute(rondSDK, req.Method, req.URL.EscapedPath()); err == nil {
+			req = mux.SetURLVars(req, route.PathParams)
+		}
+	}
+
+	w := newBufferedResponseWriter()
+	h.handler.ServeHTTP(w, req)
+	return w
+}
+
+type bufferedResponseWriter struct {
+	header     http.Header
+	body       *bytes.Buffer
+	statusCode int
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{
+		header:     http.Header{},
+		body:       &bytes.Buffer{},
+		statusCode: http.StatusOK,
+	}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
+
+// allowed reports whether the request must reach the target service. Otherwise
+// rond responds directly, even with a successful response (e.g. with the empty
+// list for the requests with an empty row filter query).
+func (w *bufferedResponseWriter) allowed() bool {
+	return w.statusCode == http.StatusOK && w.body.Len() == 0
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/sdk/inputuser"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+)
+
+// ExtAuthzServer implements the Envoy external authorization gRPC API. Each check
+// request is evaluated as rond does in standalone mode: allowed requests receive
+// the row filter header, if any, while denied requests receive the status code
+// and body rond would have responded with.
+type ExtAuthzServer struct {
+	authv3.UnimplementedAuthorizationServer
+
+	log        logging.Logger
+	evaluation evaluationHandler
+}
+
+func NewExtAuthzServer(
+	log logging.Logger,
+	env config.EnvironmentVariables,
+	opaModuleConfig *core.OPAModuleConfig,
+	sdkBoot *SDKBootState,
+	inputUserClient inputuser.Client,
+) *ExtAuthzServer {
+	return &ExtAuthzServer{
+		log:        log,
+		evaluation: newEvaluationHandler(env, opaModuleConfig, sdkBoot, inputUserClient),
+	}
+}
+
+func (s *ExtAuthzServer) Check(ctx context.Context, checkRequest *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	logger := s.log
+	httpAttributes := checkRequest.GetAttributes().GetRequest().GetHttp()
+	if httpAttributes == nil {
+		logger.Error("check request without http attributes")
+		return deniedCheckResponse(http.StatusBadRequest, http.Header{}, nil), nil
+	}
+	logger = logger.WithFields(map[string]any{
+		"requestId":           httpAttributes.GetId(),
+		"originalRequestPath": utils.SanitizeString(httpAttributes.GetPath()),
+		"method":              utils.SanitizeString(httpAttributes.GetMethod()),
+	})
+
+	body := httpAttributes.GetRawBody()
+	if body == nil {
+		body = []byte(httpAttributes.GetBody())
+	}
+	req, err := http.NewRequestWithContext(logging.WithContext(ctx, logger), httpAttributes.GetMethod(), httpAttributes.GetPath(), bytes.NewReader(body))
+	if err != nil {
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed to create request from check attributes")
+		return deniedCheckResponse(http.StatusBadRequest, http.Header{}, nil), nil
+	}
+	req.Host = httpAttributes.GetHost()
+	for key, value := range httpAttributes.GetHeaders() {
+		// HTTP/2 pseudo-headers are already mapped to the request fields.
+		if strings.HasPrefix(key, ":") {
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+
+	w := s.evaluation.evaluate(req)
+	if w.allowed() {
+		return okCheckResponse(w.header), nil
+	}
+	logger.WithField("statusCode", w.statusCode).Debug("check request denied")
+	return deniedCheckResponse(w.statusCode, w.header, w.body.Bytes()), nil
+}
+
+func okCheckResponse(headers http.Header) *authv3.CheckResponse {
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{
+				Headers: headerValueOptions(headers),
+			},
+		},
+	}
+}
+
+func deniedCheckResponse(statusCode int, headers http.Header, body []byte) *authv3.CheckResponse {
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(codes.PermissionDenied)},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode(statusCode)},
+				Headers: headerValueOptions(headers),
+				Body:    string(body),
+			},
+		},
+	}
+}
+
+// headerValueOptions overwrites the headers, so that clients cannot set the
+// row filter header by themselves.
+func headerValueOptions(headers http.Header) []*corev3.HeaderValueOption {
+	options := make([]*corev3.HeaderValueOption, 0, len(headers))
+	for key := range headers {
+		options = append(options, &corev3.HeaderValueOption{
+			Header:       &corev3.HeaderValue{Key: key, Value: headers.Get(key)},
+			AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+		})
+	}
+	return options
+}
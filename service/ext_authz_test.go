@@ -0,0 +1,225 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/internal/fake"
+	rondlogrus "github.com/rond-authz/rond/logging/logrus"
+	"github.com/rond-authz/rond/openapi"
+	"github.com/rond-authz/rond/sdk"
+	"github.com/rond-authz/rond/sdk/inputuser"
+	"github.com/rond-authz/rond/types"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func startExtAuthzServer(t *testing.T, env config.EnvironmentVariables, sdkBoot *SDKBootState, inputUserClient inputuser.Client) authv3.AuthorizationClient {
+	t.Helper()
+
+	log, _ := test.NewNullLogger()
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(server, NewExtAuthzServer(rondlogrus.NewLogger(log), env, nil, sdkBoot, inputUserClient))
+	go func() {
+		//#nosec G104 -- the server is stopped at test cleanup
+		server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return authv3.NewAuthorizationClient(conn)
+}
+
+func newCheckRequest(method, path string, headers map[string]string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Id:      "request-id",
+					Method:  method,
+					Path:    path,
+					Host:    "example.com",
+					Headers: headers,
+				},
+			},
+		},
+	}
+}
+
+func headerValues(t *testing.T, options []*corev3.HeaderValueOption) map[string]string {
+	headers := map[string]string{}
+	for _, option := range options {
+		require.Equal(t, corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD, option.AppendAction)
+		headers[option.Header.Key] = option.Header.Value
+	}
+	return headers
+}
+
+func TestExtAuthzServer(t *testing.T) {
+	env := config.EnvironmentVariables{
+		UserGroupsHeader:     "miausergroups",
+		UserIdHeader:         "miauserid",
+		UserPropertiesHeader: "miauserproperties",
+		ClientTypeHeader:     "Client-Type",
+	}
+	oas := &openapi.OpenAPISpec{
+		Paths: openapi.OpenAPIPaths{
+			"/projects/{projectId}": openapi.PathVerbs{
+				"get": openapi.VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_project"}},
+				},
+			},
+			"/projects/": openapi.PathVerbs{
+				"get": openapi.VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{
+						PolicyName:    "filter_projects",
+						GenerateQuery: true,
+						QueryOptions:  core.QueryOptions{HeaderName: "x-query"},
+					}},
+				},
+			},
+			"/users/": openapi.PathVerbs{
+				"get": openapi.VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "filter_nothing", GenerateQuery: true}},
+				},
+			},
+		},
+	}
+	opaModule := &core.OPAModuleConfig{
+		Name: "example.rego",
+		Content: `package policies
+allow_project {
+	binding := input.user.bindings[_]
+	binding.resource.resourceType == "project"
+	binding.resource.resourceId == input.request.pathParams.projectId
+}
+filter_projects {
+	project := data.resources[_]
+	project.owner == input.user.id
+}
+filter_nothing {
+	user := data.resources[_]
+	false
+}`,
+	}
+	rondSDK, err := sdk.NewFromOAS(context.Background(), opaModule, oas, nil)
+	require.NoError(t, err)
+	sdkBoot := NewSDKBootState()
+	sdkBoot.Ready(rondSDK)
+
+	inputUserClient := &fake.InputUserClient{
+		UserBindings: []types.Binding{
+			{BindingID: "binding1", Subjects: []string{"piero"}, Resource: &types.Resource{ResourceType: "project", ResourceID: "p1"}},
+		},
+		UserRoles: []types.Role{},
+	}
+	client := startExtAuthzServer(t, env, sdkBoot, inputUserClient)
+
+	t.Run("allows request using path params and user bindings", func(t *testing.T) {
+		res, err := client.Check(context.Background(), newCheckRequest(http.MethodGet, "/projects/p1", map[string]string{
+			":path":     "/projects/p1",
+			"miauserid": "piero",
+		}))
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.OK), res.Status.Code)
+		require.NotNil(t, res.GetOkResponse())
+		require.Empty(t, res.GetOkResponse().Headers)
+	})
+
+	t.Run("adds row filter header", func(t *testing.T) {
+		res, err := client.Check(context.Background(), newCheckRequest(http.MethodGet, "/projects/?limit=10", map[string]string{
+			"miauserid": "piero",
+			"x-query":   "spoofed",
+		}))
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.OK), res.Status.Code)
+		headers := headerValues(t, res.GetOkResponse().Headers)
+		require.Len(t, headers, 1)
+		require.JSONEq(t, `{"$or":[{"$and":[{"owner":{"$eq":"piero"}}]}]}`, headers["X-Query"])
+	})
+
+	t.Run("denies request with rond response", func(t *testing.T) {
+		res, err := client.Check(context.Background(), newCheckRequest(http.MethodGet, "/projects/p2", map[string]string{
+			"miauserid": "piero",
+		}))
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.PermissionDenied), res.Status.Code)
+		denied := res.GetDeniedResponse()
+		require.NotNil(t, denied)
+		require.Equal(t, http.StatusForbidden, int(denied.Status.Code))
+		require.Equal(t, map[string]string{"Content-Type": "application/json"}, headerValues(t, denied.Headers))
+		require.JSONEq(t, `{
+			"error": "RBAC policy evaluation failed",
+			"message": "You do not have permissions to access this feature, contact the administrator for more information.",
+			"statusCode": 403
+		}`, denied.Body)
+	})
+
+	t.Run("denies request not matching any route", func(t *testing.T) {
+		res, err := client.Check(context.Background(), newCheckRequest(http.MethodPost, "/projects/p1", nil))
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.PermissionDenied), res.Status.Code)
+		require.Equal(t, http.StatusNotFound, int(res.GetDeniedResponse().Status.Code))
+	})
+
+	t.Run("responds with empty list for JSON requests with empty row filter", func(t *testing.T) {
+		res, err := client.Check(context.Background(), newCheckRequest(http.MethodGet, "/users/", map[string]string{
+			"content-type": "application/json",
+		}))
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.PermissionDenied), res.Status.Code)
+		denied := res.GetDeniedResponse()
+		require.Equal(t, http.StatusOK, int(denied.Status.Code))
+		require.Equal(t, "[]", denied.Body)
+	})
+
+	t.Run("denies request without http attributes", func(t *testing.T) {
+		res, err := client.Check(context.Background(), &authv3.CheckRequest{})
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.PermissionDenied), res.Status.Code)
+		require.Equal(t, http.StatusBadRequest, int(res.GetDeniedResponse().Status.Code))
+	})
+
+	t.Run("responds service unavailable if sdk is not ready", func(t *testing.T) {
+		client := startExtAuthzServer(t, env, NewSDKBootState(), nil)
+
+		res, err := client.Check(context.Background(), newCheckRequest(http.MethodGet, "/projects/p1", nil))
+		require.NoError(t, err)
+		require.Equal(t, int32(codes.PermissionDenied), res.Status.Code)
+		require.Equal(t, http.StatusServiceUnavailable, int(res.GetDeniedResponse().Status.Code))
+	})
+}
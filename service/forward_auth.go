@@ -0,0 +1,126 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/sdk/inputuser"
+	"github.com/rond-authz/rond/types"
+
+	"github.com/gorilla/mux"
+)
+
+var forwardAuthRoutePath = "/-/rond/forward-auth"
+
+const (
+	forwardedMethodHeaderKey = "X-Forwarded-Method"
+	forwardedURIHeaderKey    = "X-Forwarded-Uri"
+	originalMethodHeaderKey  = "X-Original-Method"
+	originalURIHeaderKey     = "X-Original-URI"
+)
+
+// forwardAuthRoute registers the endpoint used by the reverse proxies supporting
+// the forward authentication (e.g. Traefik ForwardAuth or NGINX auth_request),
+// which call it with the original method and URI in the request headers.
+func forwardAuthRoute(
+	r *mux.Router,
+	env config.EnvironmentVariables,
+	opaModuleConfig *core.OPAModuleConfig,
+	sdkBoot *SDKBootState,
+	inputUserClient inputuser.Client,
+) {
+	if !env.ForwardAuth {
+		return
+	}
+
+	r.Handle(forwardAuthRoutePath, forwardAuthHandler(env, newEvaluationHandler(env, opaModuleConfig, sdkBoot, inputUserClient)))
+}
+
+// forwardAuthHandler responds 200 with the row filter header, if any, to allowed
+// requests. Since reverse proxies accept only 401 and 403 as denial status codes,
+// denied requests receive 401 if the user is not set, 403 otherwise.
+func forwardAuthHandler(env config.EnvironmentVariables, evaluation evaluationHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
+
+		method := firstHeaderValue(r.Header, forwardedMethodHeaderKey, originalMethodHeaderKey)
+		if method == "" {
+			method = r.Method
+		}
+		uri := firstHeaderValue(r.Header, forwardedURIHeaderKey, originalURIHeaderKey)
+		if uri == "" {
+			logger.Error("forward auth request without original URI")
+			utils.FailResponseWithCode(w, http.StatusForbidden, "missing original URI header", utils.NO_PERMISSIONS_ERROR_MESSAGE)
+			return
+		}
+
+		req, err := http.NewRequestWithContext(r.Context(), method, uri, http.NoBody)
+		if err != nil {
+			logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed to create request from forwarded headers")
+			utils.FailResponseWithCode(w, http.StatusForbidden, "invalid original request", utils.NO_PERMISSIONS_ERROR_MESSAGE)
+			return
+		}
+		req.Host = r.Host
+		req.Header = r.Header.Clone()
+
+		response := evaluation.evaluate(req)
+		if response.allowed() {
+			for key := range response.header {
+				w.Header().Set(key, response.header.Get(key))
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		statusCode := http.StatusForbidden
+		switch {
+		case response.statusCode == http.StatusTooManyRequests:
+			statusCode = http.StatusTooManyRequests
+			if retryAfter := response.header.Get("Retry-After"); retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+		case r.Header.Get(env.UserIdHeader) == "":
+			statusCode = http.StatusUnauthorized
+		}
+		logger.WithFields(map[string]any{
+			"originalRequestPath": utils.SanitizeString(req.URL.Path),
+			"method":              utils.SanitizeString(method),
+			"statusCode":          response.statusCode,
+		}).Debug("forward auth request denied")
+
+		requestError := types.RequestError{
+			Error:   "RBAC policy evaluation failed",
+			Message: utils.NO_PERMISSIONS_ERROR_MESSAGE,
+		}
+		//#nosec G104 -- the default error is used if the response is not a rond error
+		json.Unmarshal(response.body.Bytes(), &requestError)
+		utils.FailResponseWithCode(w, statusCode, requestError.Error, requestError.Message)
+	}
+}
+
+func firstHeaderValue(header http.Header, keys ...string) string {
+	for _, key := range keys {
+		if value := header.Get(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,204 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/custom_builtins"
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/internal/fake"
+	"github.com/rond-authz/rond/internal/testutils"
+	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/openapi"
+	"github.com/rond-authz/rond/sdk"
+	"github.com/rond-authz/rond/types"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardAuthRoute(t *testing.T) {
+	env := config.EnvironmentVariables{
+		UserGroupsHeader:     "miausergroups",
+		UserIdHeader:         "miauserid",
+		UserPropertiesHeader: "miauserproperties",
+		ClientTypeHeader:     "Client-Type",
+		ForwardAuth:          true,
+	}
+	oas := &openapi.OpenAPISpec{
+		Paths: openapi.OpenAPIPaths{
+			"/projects/{projectId}": openapi.PathVerbs{
+				"delete": openapi.VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_project"}},
+				},
+			},
+			"/limited": openapi.PathVerbs{
+				"get": openapi.VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_limited"}},
+				},
+			},
+			"/projects/": openapi.PathVerbs{
+				"get": openapi.VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "filter_projects", GenerateQuery: true}},
+				},
+			},
+		},
+	}
+	opaModule := &core.OPAModuleConfig{
+		Name: "example.rego",
+		Content: `package policies
+allow_project {
+	binding := input.user.bindings[_]
+	binding.resource.resourceType == "project"
+	binding.resource.resourceId == input.request.pathParams.projectId
+}
+filter_projects {
+	project := data.resources[_]
+	project.owner == input.user.id
+	project.status == input.request.query.status[0]
+}
+allow_limited {
+	rate_limit(input.user.id, 1, "1m")
+}`,
+	}
+	rondSDK, err := sdk.NewFromOAS(context.Background(), opaModule, oas, &sdk.Options{
+		EvaluatorOptions: &sdk.EvaluatorOptions{
+			RateLimitStore: custom_builtins.NewInMemoryRateLimitStore(),
+		},
+	})
+	require.NoError(t, err)
+	sdkBoot := NewSDKBootState()
+	sdkBoot.Ready(rondSDK)
+
+	inputUserClient := &fake.InputUserClient{
+		UserBindings: []types.Binding{
+			{BindingID: "binding1", Subjects: []string{"piero"}, Resource: &types.Resource{ResourceType: "project", ResourceID: "p1"}},
+		},
+		UserRoles: []types.Role{},
+	}
+
+	forwardAuth := func(t *testing.T, env config.EnvironmentVariables, headers map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		router := mux.NewRouter()
+		forwardAuthRoute(router, env, opaModule, sdkBoot, inputUserClient)
+
+		req := httptest.NewRequest(http.MethodGet, forwardAuthRoutePath, nil)
+		req = req.WithContext(createContext(t, context.Background(), env, nil, nil, nil))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("route is not registered if forward auth is disabled", func(t *testing.T) {
+		router := mux.NewRouter()
+		forwardAuthRoute(router, config.EnvironmentVariables{}, opaModule, sdkBoot, nil)
+
+		req := httptest.NewRequest(http.MethodGet, forwardAuthRoutePath, nil)
+		var match mux.RouteMatch
+		require.False(t, router.Match(req, &match))
+	})
+
+	t.Run("allows request with Traefik headers", func(t *testing.T) {
+		w := forwardAuth(t, env, map[string]string{
+			"X-Forwarded-Method": http.MethodDelete,
+			"X-Forwarded-Uri":    "/projects/p1",
+			"miauserid":          "piero",
+		})
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Empty(t, w.Body.String())
+	})
+
+	t.Run("returns row filter header with NGINX headers", func(t *testing.T) {
+		w := forwardAuth(t, env, map[string]string{
+			"X-Original-URI": "/projects/?status=active",
+			"miauserid":      "piero",
+		})
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.JSONEq(t, `{"$or":[{"$and":[{"owner":{"$eq":"piero"}},{"status":{"$eq":"active"}}]}]}`, w.Result().Header.Get(BASE_ROW_FILTER_HEADER_KEY))
+	})
+
+	t.Run("forbids denied request of known user", func(t *testing.T) {
+		w := forwardAuth(t, env, map[string]string{
+			"X-Forwarded-Method": http.MethodDelete,
+			"X-Forwarded-Uri":    "/projects/p2",
+			"miauserid":          "piero",
+		})
+
+		require.Equal(t, http.StatusForbidden, w.Result().StatusCode)
+		require.JSONEq(t, `{
+			"error": "RBAC policy evaluation failed",
+			"message": "You do not have permissions to access this feature, contact the administrator for more information.",
+			"statusCode": 403
+		}`, w.Body.String())
+	})
+
+	t.Run("unauthorized denied request without user", func(t *testing.T) {
+		w := forwardAuth(t, env, map[string]string{
+			"X-Forwarded-Method": http.MethodDelete,
+			"X-Forwarded-Uri":    "/projects/p1",
+		})
+
+		require.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	})
+
+	t.Run("too many requests with retry after if rate limit is exceeded", func(t *testing.T) {
+		headers := map[string]string{
+			"X-Forwarded-Uri": "/limited",
+			"miauserid":       "piero",
+		}
+		require.Equal(t, http.StatusOK, forwardAuth(t, env, headers).Result().StatusCode)
+
+		w := forwardAuth(t, env, headers)
+		require.Equal(t, http.StatusTooManyRequests, w.Result().StatusCode)
+		require.Equal(t, "60", w.Result().Header.Get("Retry-After"))
+		testutils.AssertResponseFullErrorMessages(t, w, http.StatusTooManyRequests, "rate limit exceeded", utils.RATE_LIMIT_ERROR_MESSAGE)
+	})
+
+	t.Run("forbids request not matching any route", func(t *testing.T) {
+		w := forwardAuth(t, env, map[string]string{
+			"X-Forwarded-Method": http.MethodPost,
+			"X-Forwarded-Uri":    "/projects/p1",
+			"miauserid":          "piero",
+		})
+
+		require.Equal(t, http.StatusForbidden, w.Result().StatusCode)
+		require.JSONEq(t, `{
+			"error": "not found oas definition: POST /projects/p1",
+			"message": "The request doesn't match any known API",
+			"statusCode": 403
+		}`, w.Body.String())
+	})
+
+	t.Run("forbids request without original URI", func(t *testing.T) {
+		w := forwardAuth(t, env, map[string]string{
+			"X-Forwarded-Method": http.MethodDelete,
+			"miauserid":          "piero",
+		})
+
+		require.Equal(t, http.StatusForbidden, w.Result().StatusCode)
+	})
+}
@@ -25,23 +25,27 @@ import (
 	"github.com/rond-authz/rond/core"
 	"github.com/rond-authz/rond/internal/config"
 	"github.com/rond-authz/rond/internal/opatranslator"
+	"github.com/rond-authz/rond/internal/tracing"
 	"github.com/rond-authz/rond/internal/utils"
-	rondlogrus "github.com/rond-authz/rond/logging/logrus"
+	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/metrics"
 	"github.com/rond-authz/rond/sdk"
 	"github.com/rond-authz/rond/sdk/inputuser"
 	rondhttp "github.com/rond-authz/rond/sdk/rondinput/http"
 	"github.com/rond-authz/rond/types"
 
 	"github.com/gorilla/mux"
-	glogrus "github.com/mia-platform/glogger/v4/loggers/logrus"
-	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const URL_SCHEME = "http"
 const BASE_ROW_FILTER_HEADER_KEY = "acl_rows"
 
 func ReverseProxyOrResponse(
-	logger *logrus.Entry,
+	logger logging.Logger,
 	env config.EnvironmentVariables,
 	w http.ResponseWriter,
 	req *http.Request,
@@ -64,7 +68,7 @@ func ReverseProxyOrResponse(
 		}
 		w.WriteHeader(http.StatusOK)
 		if _, err := w.Write(nil); err != nil {
-			logger.WithField("error", logrus.Fields{"message": err.Error()}).Warn("failed response write")
+			logger.WithField("error", map[string]any{"message": err.Error()}).Warn("failed response write")
 		}
 		return
 	}
@@ -72,26 +76,36 @@ func ReverseProxyOrResponse(
 }
 
 func rbacHandler(w http.ResponseWriter, req *http.Request) {
-	requestContext := req.Context()
-	logger := glogrus.FromContext(requestContext)
+	requestContext, span := tracing.Start(
+		otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header)),
+		"rbacHandler",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLPath(req.URL.Path),
+		),
+	)
+	defer span.End()
+	req = req.WithContext(requestContext)
+	logger := logging.FromContext(requestContext)
 
 	env, err := config.GetEnv(requestContext)
 	if err != nil {
-		logger.WithError(err).Error("no env found in context")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("no env found in context")
 		utils.FailResponse(w, "No environment found in context", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
 		return
 	}
 
 	evaluatorSdk, err := sdk.GetEvaluator(requestContext)
 	if err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("no evaluatorSdk found in context")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("no evaluatorSdk found in context")
 		utils.FailResponse(w, "no evaluators sdk found in context", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
 		return
 	}
 
 	rondInputUser, err := getInputUser(logger, env, req)
 	if err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("failed to get input user")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed to get input user")
 		utils.FailResponse(w, "failed to get input user", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
 		return
 	}
@@ -109,23 +123,23 @@ func EvaluateRequest(
 	evaluatorSdk sdk.Evaluator,
 	rondInputUser core.InputUser,
 ) error {
-	logger := glogrus.FromContext(req.Context())
+	logger := logging.FromContext(req.Context())
 
 	evaluationConfig := evaluatorSdk.Config()
 
-	logger.WithFields(logrus.Fields{
+	logger.WithFields(map[string]any{
 		"preventBodyLoad":        evaluationConfig.RequestFlow.PreventBodyLoad,
 		"generateQuery":          evaluationConfig.RequestFlow.GenerateQuery,
 		"resourceOptmizationMap": evaluationConfig.Options.EnableResourcePermissionsMapOptimization,
 	}).Trace("creating rond input")
 	rondInput, err := rondhttp.NewInput(&evaluationConfig, req, env.ClientTypeHeader, mux.Vars(req), rondInputUser, nil)
 	if err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("failed to create rond input")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed to create rond input")
 		utils.FailResponseWithCode(w, http.StatusInternalServerError, "failed to create rond input", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
 		return err
 	}
 	result, err := evaluatorSdk.EvaluateRequestPolicy(req.Context(), rondInput, &sdk.EvaluateOptions{
-		Logger: rondlogrus.NewEntry(logger),
+		Logger: logger,
 	})
 	if err != nil {
 		// opatranslator.ErrEmptyQuery throws when evaluator should return a query. In case
@@ -139,18 +153,24 @@ func EvaluateRequest(
 			w.Header().Set(utils.ContentTypeHeaderKey, utils.JSONContentTypeHeader)
 			w.WriteHeader(http.StatusOK)
 			if _, err := w.Write([]byte("[]")); err != nil {
-				logger.WithField("error", logrus.Fields{"message": err.Error()}).Warn("failed response write")
+				logger.WithField("error", map[string]any{"message": err.Error()}).Warn("failed response write")
 				return err
 			}
 			return err
 		}
 
-		logger.WithField("error", logrus.Fields{
+		logger.WithField("error", map[string]any{
 			"message": err.Error(),
 		}).Error("RBAC policy evaluation failed")
 		utils.FailResponseWithCode(w, http.StatusForbidden, "RBAC policy evaluation failed", utils.NO_PERMISSIONS_ERROR_MESSAGE)
 		return err
 	}
+	if result.RateLimitExceeded {
+		logger.WithField("retryAfter", result.RetryAfter.String()).Warn("rate limit exceeded")
+		utils.SetRetryAfterHeader(w.Header(), result.RetryAfter)
+		utils.FailResponseWithCode(w, http.StatusTooManyRequests, "rate limit exceeded", utils.RATE_LIMIT_ERROR_MESSAGE)
+		return fmt.Errorf("rate limit exceeded")
+	}
 	if !result.Allowed {
 		logger.Error("RBAC policy evaluation failed")
 		utils.FailResponseWithCode(w, http.StatusForbidden, "RBAC policy evaluation failed", utils.NO_PERMISSIONS_ERROR_MESSAGE)
@@ -168,7 +188,7 @@ func EvaluateRequest(
 }
 
 func ReverseProxy(
-	logger *logrus.Entry,
+	logger logging.Logger,
 	env config.EnvironmentVariables,
 	w http.ResponseWriter,
 	req *http.Request,
@@ -176,21 +196,45 @@ func ReverseProxy(
 	evaluatorSdk sdk.Evaluator,
 	inputUser core.InputUser,
 ) {
-	targetHostFromEnv := env.TargetServiceHost
-	u, err := url.Parse(fmt.Sprintf("%s://%s", URL_SCHEME, targetHostFromEnv))
-	if err != nil {
-		// FIXME: maybe better error handling?
-		// targetHostFromEnv should not arrive here if
-		// it's not a valid host to be put in a URL!
-		panic(err)
+	upstreamTarget, hasUpstreamTarget := config.FindUpstreamTarget(getUpstreamTargets(req.Context()), req.URL.Path)
+	targetURL := upstreamTarget.URL
+	if !hasUpstreamTarget {
+		if env.TargetServiceHost == "" {
+			logger.WithField("path", req.URL.Path).Error("no target service configured for the request path")
+			utils.FailResponse(w, "no target service configured for the request path", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+			return
+		}
+
+		scheme := URL_SCHEME
+		if env.TargetServiceScheme != "" {
+			scheme = env.TargetServiceScheme
+		}
+		u, err := url.Parse(fmt.Sprintf("%s://%s", scheme, env.TargetServiceHost))
+		if err != nil {
+			logger.WithField("error", map[string]any{"message": err.Error()}).Error("invalid target service URL")
+			utils.FailResponse(w, "invalid target service URL", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+			return
+		}
+		targetURL = u
 	}
 
 	proxy := httputil.ReverseProxy{
 		FlushInterval: -1,
 		Rewrite: func(r *httputil.ProxyRequest) {
-			r.SetURL(u)
+			if hasUpstreamTarget {
+				r.Out.URL.Path = upstreamTarget.StripPrefix(r.Out.URL.Path)
+				if r.Out.URL.RawPath != "" {
+					r.Out.URL.RawPath = upstreamTarget.StripPrefix(r.Out.URL.RawPath)
+				}
+			}
+			r.SetURL(targetURL)
 			r.SetXForwarded()
 		},
+		Transport: metricsTransport{
+			next:    tracingTransport{next: getTargetTransport(req.Context())},
+			metrics: metrics.FromContext(req.Context()),
+		},
+		ErrorHandler: proxyErrorHandler(logger),
 	}
 
 	// Check on nil is performed to proxy the oas documentation path
@@ -199,7 +243,7 @@ func ReverseProxy(
 		return
 	}
 	proxy.Transport = NewOPATransport(
-		http.DefaultTransport,
+		proxy.Transport,
 		req.Context(),
 		permission,
 		logger,
@@ -214,10 +258,10 @@ func ReverseProxy(
 
 func alwaysProxyHandler(w http.ResponseWriter, req *http.Request) {
 	requestContext := req.Context()
-	logger := glogrus.FromContext(req.Context())
+	logger := logging.FromContext(req.Context())
 	env, err := config.GetEnv(requestContext)
 	if err != nil {
-		logger.WithError(err).Error("no env found in context")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("no env found in context")
 		utils.FailResponse(w, "no environment found in context", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
 		return
 	}
@@ -246,7 +290,7 @@ func getUserFromRequest(req *http.Request, userHeaders userHeadersKeys) (types.U
 	return user, nil
 }
 
-func getInputUser(logger *logrus.Entry, env config.EnvironmentVariables, req *http.Request) (core.InputUser, error) {
+func getInputUser(logger logging.Logger, env config.EnvironmentVariables, req *http.Request) (core.InputUser, error) {
 	user, err := getUserFromRequest(req, userHeadersKeys{
 		IDHeaderKey:         env.UserIdHeader,
 		GroupsHeaderKey:     env.UserGroupsHeader,
@@ -261,7 +305,7 @@ func getInputUser(logger *logrus.Entry, env config.EnvironmentVariables, req *ht
 		return core.InputUser{}, err
 	}
 
-	rondInputUser, err := inputuser.Get(req.Context(), rondlogrus.NewEntry(logger), client, user)
+	rondInputUser, err := inputuser.Get(req.Context(), logger, client, user)
 	if err != nil {
 		return core.InputUser{}, err
 	}
@@ -16,6 +16,7 @@ package service
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -27,18 +28,19 @@ import (
 	"testing"
 
 	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/custom_builtins"
 	cbmocks "github.com/rond-authz/rond/custom_builtins/mocks"
 	"github.com/rond-authz/rond/internal/config"
 	"github.com/rond-authz/rond/internal/fake"
 	"github.com/rond-authz/rond/internal/testutils"
 	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
 	rondlogrus "github.com/rond-authz/rond/logging/logrus"
 	"github.com/rond-authz/rond/openapi"
 	"github.com/rond-authz/rond/sdk/inputuser"
 	"github.com/rond-authz/rond/types"
 
 	"github.com/gorilla/mux"
-	"github.com/mia-platform/glogger/v4"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sirupsen/logrus"
@@ -78,7 +80,7 @@ func TestDirectProxyHandler(t *testing.T) {
 	}
 
 	log, _ := test.NewNullLogger()
-	ctx := glogger.WithLogger(context.Background(), logrus.NewEntry(log))
+	ctx := logging.WithContext(context.Background(), rondlogrus.NewLogger(log))
 
 	t.Run("opens backend server and sends it request using proxy", func(t *testing.T) {
 		invoked := false
@@ -113,6 +115,91 @@ func TestDirectProxyHandler(t *testing.T) {
 		require.Equal(t, http.StatusOK, w.Result().StatusCode, "Unexpected status code.")
 	})
 
+	t.Run("proxies the request to the upstream target matching the path prefix", func(t *testing.T) {
+		invoked := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			invoked = true
+
+			require.Equal(t, "/base/api", r.URL.Path, "Mocked Backend: Unexpected path of request url")
+			require.Equal(t, "mockQuery=iamquery", r.URL.RawQuery, "Mocked Backend: Unexpected rawQuery of request url")
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		oasWithPrefix := &openapi.OpenAPISpec{
+			Paths: openapi.OpenAPIPaths{
+				"/orders/api": oas.Paths["/api"],
+			},
+		}
+		evaluator := getEvaluator(t, ctx, mockOPAModule, nil, oasWithPrefix, http.MethodGet, "/orders/api", nil)
+		env := config.EnvironmentVariables{
+			TargetServiceHost: "not-called",
+			UpstreamTargets:   fmt.Sprintf("/orders=%s/base,/payments=http://not-called", server.URL),
+		}
+		upstreamTargets, err := env.GetUpstreamTargets()
+		require.NoError(t, err)
+		ctx := createContext(t,
+			WithUpstreamTargets(context.Background(), upstreamTargets),
+			env,
+			evaluator,
+			nil,
+			nil,
+		)
+
+		r, err := http.NewRequestWithContext(ctx, "GET", "http://www.example.com:8080/orders/api?mockQuery=iamquery", nil)
+		require.NoError(t, err, "Unexpected error")
+
+		w := httptest.NewRecorder()
+
+		rbacHandler(w, r)
+
+		require.True(t, invoked, "Handler was not invoked.")
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "Unexpected status code.")
+	})
+
+	t.Run("proxies the request over mTLS with the target transport", func(t *testing.T) {
+		certs := testutils.GenerateTLSCertificates(t)
+		invoked := false
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			invoked = true
+
+			require.Equal(t, "/api", r.URL.Path, "Mocked Backend: Unexpected path of request url")
+			require.Equal(t, testutils.TLSClientCommonName, r.TLS.PeerCertificates[0].Subject.CommonName)
+			w.WriteHeader(http.StatusOK)
+		}))
+		server.TLS = &tls.Config{
+			Certificates: []tls.Certificate{certs.ServerCertificate},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    certs.CAPool,
+		}
+		server.StartTLS()
+		defer server.Close()
+
+		serverURL, _ := url.Parse(server.URL)
+		env := config.EnvironmentVariables{
+			TargetServiceHost:           serverURL.Host,
+			TargetServiceScheme:         "https",
+			TargetServiceCAFile:         certs.CAFile,
+			TargetServiceClientCertFile: certs.ClientCertFile,
+			TargetServiceClientKeyFile:  certs.ClientKeyFile,
+		}
+		transport, err := env.NewTargetServiceTransport()
+		require.NoError(t, err)
+
+		evaluator := getEvaluator(t, ctx, mockOPAModule, nil, oas, http.MethodGet, "/api", nil)
+		ctx := createContext(t, context.Background(), env, evaluator, nil, nil)
+
+		r, err := http.NewRequestWithContext(WithTargetTransport(ctx, transport), "GET", "http://www.example.com:8080/api", nil)
+		require.NoError(t, err, "Unexpected error")
+
+		w := httptest.NewRecorder()
+
+		rbacHandler(w, r)
+
+		require.True(t, invoked, "Handler was not invoked.")
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "Unexpected status code.")
+	})
+
 	t.Run("sends request with custom headers", func(t *testing.T) {
 		invoked := false
 		mockHeader := "CustomHeader"
@@ -686,6 +773,47 @@ allow {
 		require.Equal(t, utils.JSONContentTypeHeader, w.Result().Header.Get(utils.ContentTypeHeaderKey), "Unexpected content type.")
 	})
 
+	t.Run("sends too many requests with retry after if rate limit is exceeded", func(t *testing.T) {
+		invoked := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			invoked++
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		serverURL, _ := url.Parse(server.URL)
+
+		opaModule := &core.OPAModuleConfig{Name: "mypolicy.rego", Content: `package policies
+todo { rate_limit(input.user.id, 1, "1m") }`}
+		evaluator := getEvaluator(t, ctx, opaModule, nil, oas, http.MethodGet, "/api", &evaluatorParams{
+			rateLimitStore: custom_builtins.NewInMemoryRateLimitStore(),
+		})
+		ctx := createContext(t,
+			context.Background(),
+			config.EnvironmentVariables{TargetServiceHost: serverURL.Host, UserIdHeader: "miauserid"},
+			evaluator,
+			nil,
+			nil,
+		)
+
+		serve := func() *httptest.ResponseRecorder {
+			r, err := http.NewRequestWithContext(ctx, "GET", "http://www.example.com:8080/api", nil)
+			require.NoError(t, err, "Unexpected error")
+			r.Header.Set("miauserid", "my-user")
+			w := httptest.NewRecorder()
+			rbacHandler(w, r)
+			return w
+		}
+
+		require.Equal(t, http.StatusOK, serve().Result().StatusCode, "Unexpected status code.")
+
+		w := serve()
+		require.Equal(t, http.StatusTooManyRequests, w.Result().StatusCode, "Unexpected status code.")
+		require.Equal(t, "60", w.Result().Header.Get("Retry-After"))
+		testutils.AssertResponseFullErrorMessages(t, w, http.StatusTooManyRequests, "rate limit exceeded", utils.RATE_LIMIT_ERROR_MESSAGE)
+		require.Equal(t, 1, invoked, "Handler has been called")
+	})
+
 	t.Run("data evaluation correctly added - logs and metrics", func(t *testing.T) {
 		t.Run("no query generation", func(t *testing.T) {
 			invoked := false
@@ -702,9 +830,8 @@ allow {
 
 			log, hook := test.NewNullLogger()
 			log.Level = logrus.TraceLevel
-			logEntry := logrus.NewEntry(log)
-			logger := rondlogrus.NewEntry(logEntry)
-			ctx = glogger.WithLogger(ctx, logEntry)
+			logger := rondlogrus.NewLogger(log)
+			ctx = logging.WithContext(ctx, logger)
 
 			registry := prometheus.NewRegistry()
 
@@ -717,7 +844,7 @@ allow {
 				config.EnvironmentVariables{TargetServiceHost: serverURL.Host},
 				evaluator,
 				nil,
-				logEntry,
+				logger,
 			)
 
 			r, err := http.NewRequestWithContext(ctx, "GET", "http://www.example.com:8080/api?mockQuery=iamquery", nil)
@@ -779,9 +906,8 @@ allow {
 
 			log, hook := test.NewNullLogger()
 			log.Level = logrus.TraceLevel
-			logEntry := logrus.NewEntry(log)
-			logger := rondlogrus.NewEntry(logEntry)
-			ctx = glogger.WithLogger(ctx, logEntry)
+			logger := rondlogrus.NewLogger(log)
+			ctx = logging.WithContext(ctx, logger)
 
 			registry := prometheus.NewRegistry()
 
@@ -794,7 +920,7 @@ allow {
 				config.EnvironmentVariables{TargetServiceHost: serverURL.Host},
 				evaluator,
 				nil,
-				logEntry,
+				logger,
 			)
 
 			r, err := http.NewRequestWithContext(ctx, "GET", "http://www.example.com:8080/api?mockQuery=iamquery", nil)
@@ -896,6 +1022,51 @@ todo {
 		require.NoError(t, err, "Unexpected error to read body response")
 		require.Equal(t, "Mocked Backend Body Example", string(buf), "Unexpected body response")
 	})
+
+	t.Run("traces the request and propagates the trace context to the upstream", func(t *testing.T) {
+		exporter := testutils.SetupTracing(t)
+		traceID := "0af7651916cd43dd8448eb211c80319c"
+
+		var upstreamTraceParent string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upstreamTraceParent = r.Header.Get("traceparent")
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		serverURL, _ := url.Parse(server.URL)
+
+		evaluator := getEvaluator(t, ctx, mockOPAModule, nil, oas, http.MethodGet, "/api", nil)
+		ctx := createContext(t,
+			context.Background(),
+			config.EnvironmentVariables{TargetServiceHost: serverURL.Host},
+			evaluator,
+			nil,
+			nil,
+		)
+
+		r, err := http.NewRequestWithContext(ctx, "GET", "http://www.example.com:8080/api", nil)
+		require.NoError(t, err, "Unexpected error")
+		r.Header.Set("traceparent", fmt.Sprintf("00-%s-b7ad6b7169203331-01", traceID))
+		w := httptest.NewRecorder()
+
+		rbacHandler(w, r)
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, "Unexpected status code.")
+
+		spans := exporter.GetSpans()
+		require.Equal(t, []string{
+			"inputuser.Get",
+			"OPAEvaluator.PolicyEvaluation",
+			"upstream round trip",
+			"rbacHandler",
+		}, testutils.SpanNames(spans))
+		for _, span := range spans {
+			require.Equal(t, traceID, span.SpanContext.TraceID().String())
+		}
+		upstreamSpan := spans[2]
+		require.Equal(t, spans[3].SpanContext.SpanID(), upstreamSpan.Parent.SpanID())
+		require.Equal(t, fmt.Sprintf("00-%s-%s-01", traceID, upstreamSpan.SpanContext.SpanID()), upstreamTraceParent)
+	})
 }
 
 func TestStandaloneMode(t *testing.T) {
@@ -931,7 +1102,7 @@ func TestStandaloneMode(t *testing.T) {
 	}
 
 	log, _ := test.NewNullLogger()
-	ctx := glogger.WithLogger(context.Background(), logrus.NewEntry(log))
+	ctx := logging.WithContext(context.Background(), rondlogrus.NewLogger(log))
 
 	t.Run("ok", func(t *testing.T) {
 		evaluator := getEvaluator(t, ctx, mockOPAModule, nil, oas, http.MethodGet, "/api", nil)
@@ -2222,7 +2393,7 @@ func findLogWithMessage(logs []*logrus.Entry, message string) []*logrus.Entry {
 
 func TestGetInputUser(t *testing.T) {
 	log, _ := test.NewNullLogger()
-	logger := logrus.NewEntry(log)
+	logger := rondlogrus.NewLogger(log)
 
 	env := config.EnvironmentVariables{
 		UserIdHeader:         "useridheaderkey",
@@ -24,14 +24,15 @@ import (
 	"strconv"
 
 	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/tracing"
 	"github.com/rond-authz/rond/internal/utils"
-	rondlogrus "github.com/rond-authz/rond/logging/logrus"
+	"github.com/rond-authz/rond/logging"
 	"github.com/rond-authz/rond/sdk"
 	rondhttp "github.com/rond-authz/rond/sdk/rondinput/http"
 	"github.com/rond-authz/rond/types"
 
 	"github.com/gorilla/mux"
-	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -43,7 +44,7 @@ type OPATransport struct {
 	http.RoundTripper
 	// FIXME: this overlaps with the req.Context used during RoundTrip.
 	context context.Context
-	logger  *logrus.Entry
+	logger  logging.Logger
 	config  *core.RondConfig
 	request *http.Request
 
@@ -56,7 +57,7 @@ func NewOPATransport(
 	transport http.RoundTripper,
 	context context.Context,
 	config *core.RondConfig,
-	logger *logrus.Entry,
+	logger logging.Logger,
 	req *http.Request,
 	clientHeaderKey string,
 	user core.InputUser,
@@ -80,7 +81,10 @@ func is2XX(statusCode int) bool {
 }
 
 func (t *OPATransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
-	resp, err = t.RoundTripper.RoundTrip(req)
+	ctx, span := tracing.Start(req.Context(), "OPATransport.RoundTrip")
+	defer func() { tracing.End(span, err) }()
+
+	resp, err = t.RoundTripper.RoundTrip(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -119,8 +123,8 @@ func (t *OPATransport) RoundTrip(req *http.Request) (resp *http.Response, err er
 		return resp, nil
 	}
 
-	responseBody, err := t.evaluatorSDK.EvaluateResponsePolicy(t.context, input, &sdk.EvaluateOptions{
-		Logger: rondlogrus.NewEntry(t.logger),
+	responseBody, err := t.evaluatorSDK.EvaluateResponsePolicy(trace.ContextWithSpan(t.context, span), input, &sdk.EvaluateOptions{
+		Logger: t.logger,
 	})
 	if err != nil {
 		t.responseWithError(resp, err, http.StatusForbidden)
@@ -132,7 +136,7 @@ func (t *OPATransport) RoundTrip(req *http.Request) (resp *http.Response, err er
 }
 
 func (t *OPATransport) responseWithError(resp *http.Response, err error, statusCode int) {
-	t.logger.WithField("error", logrus.Fields{"message": err.Error()}).Error(core.ErrResponsePolicyEvalFailed)
+	t.logger.WithField("error", map[string]any{"message": err.Error()}).Error(core.ErrResponsePolicyEvalFailed)
 	message := utils.NO_PERMISSIONS_ERROR_MESSAGE
 	if statusCode != http.StatusForbidden {
 		message = utils.GENERIC_BUSINESS_ERROR_MESSAGE
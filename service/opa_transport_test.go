@@ -60,7 +60,7 @@ func TestRoundTripErrors(t *testing.T) {
 			http.DefaultTransport,
 			req.Context(),
 			config,
-			logrus.NewEntry(logger),
+			rondlogrus.NewLogger(logger),
 			req,
 			"",
 			core.InputUser{},
@@ -99,7 +99,7 @@ func TestOPATransportResponseWithError(t *testing.T) {
 		http.DefaultTransport,
 		req.Context(),
 		config,
-		logrus.NewEntry(logger),
+		rondlogrus.NewLogger(logger),
 		req,
 		"",
 		core.InputUser{},
@@ -161,7 +161,7 @@ func TestOPATransportRoundTrip(t *testing.T) {
 			&MockRoundTrip{Error: fmt.Errorf("some error")},
 			req.Context(),
 			config,
-			logrus.NewEntry(logger),
+			rondlogrus.NewLogger(logger),
 			req,
 			"",
 			core.InputUser{},
@@ -182,7 +182,7 @@ func TestOPATransportRoundTrip(t *testing.T) {
 		transport := &OPATransport{
 			RoundTripper: &MockRoundTrip{Response: resp},
 			context:      req.Context(),
-			logger:       logrus.NewEntry(logger),
+			logger:       rondlogrus.NewLogger(logger),
 			request:      req,
 			user:         core.InputUser{},
 		}
@@ -206,7 +206,7 @@ func TestOPATransportRoundTrip(t *testing.T) {
 		transport := &OPATransport{
 			RoundTripper: &MockRoundTrip{Response: resp},
 			context:      req.Context(),
-			logger:       logrus.NewEntry(logger),
+			logger:       rondlogrus.NewLogger(logger),
 			request:      req,
 			user:         core.InputUser{},
 		}
@@ -229,7 +229,7 @@ func TestOPATransportRoundTrip(t *testing.T) {
 		transport := &OPATransport{
 			RoundTripper: &MockRoundTrip{Response: resp},
 			context:      req.Context(),
-			logger:       logrus.NewEntry(logger),
+			logger:       rondlogrus.NewLogger(logger),
 			request:      req,
 			user:         core.InputUser{},
 		}
@@ -251,7 +251,7 @@ func TestOPATransportRoundTrip(t *testing.T) {
 		transport := &OPATransport{
 			RoundTripper: &MockRoundTrip{Response: resp},
 			context:      req.Context(),
-			logger:       logrus.NewEntry(logger),
+			logger:       rondlogrus.NewLogger(logger),
 			request:      req,
 			user:         core.InputUser{},
 		}
@@ -282,7 +282,7 @@ func TestOPATransportRoundTrip(t *testing.T) {
 			&MockRoundTrip{Response: resp},
 			req.Context(),
 			config,
-			logrus.NewEntry(logger),
+			rondlogrus.NewLogger(logger),
 			req,
 			"",
 			core.InputUser{},
@@ -315,7 +315,7 @@ func TestOPATransportRoundTrip(t *testing.T) {
 		transport := &OPATransport{
 			RoundTripper: &MockRoundTrip{Response: resp},
 			context:      req.Context(),
-			logger:       logrus.NewEntry(logger),
+			logger:       rondlogrus.NewLogger(logger),
 			request:      req,
 		}
 
@@ -337,7 +337,7 @@ func TestOPATransportRoundTrip(t *testing.T) {
 		transport := &OPATransport{
 			RoundTripper: &MockRoundTrip{Response: resp},
 			context:      req.Context(),
-			logger:       logrus.NewEntry(logger),
+			logger:       rondlogrus.NewLogger(logger),
 			request:      req,
 		}
 
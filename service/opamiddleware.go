@@ -19,14 +19,13 @@ import (
 	"net/http"
 	"strings"
 
-	glogrus "github.com/mia-platform/glogger/v4/loggers/logrus"
 	"github.com/rond-authz/rond/core"
 	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
 	"github.com/rond-authz/rond/openapi"
 	"github.com/rond-authz/rond/sdk"
 
 	"github.com/gorilla/mux"
-	"github.com/sirupsen/logrus"
 )
 
 var (
@@ -64,7 +63,7 @@ func OPAMiddleware(
 				path = strings.Replace(r.URL.EscapedPath(), options.PathPrefixStandalone, "", 1)
 			}
 
-			logger := glogrus.FromContext(r.Context())
+			logger := logging.FromContext(r.Context())
 
 			evaluator, err := rondSDK.FindEvaluator(r.Method, path)
 			rondConfig := core.RondConfig{}
@@ -73,9 +72,9 @@ func OPAMiddleware(
 			}
 
 			if r.Method == http.MethodGet && r.URL.Path == targetServiceOASPath && rondConfig.RequestFlow.PolicyName == "" {
-				fields := logrus.Fields{}
+				fields := map[string]any{}
 				if err != nil {
-					fields["error"] = logrus.Fields{"message": err.Error()}
+					fields["error"] = map[string]any{"message": err.Error()}
 				}
 				logger.WithFields(fields).Info("Proxying call to OAS Path even with no permission")
 				next.ServeHTTP(w, r)
@@ -85,7 +84,7 @@ func OPAMiddleware(
 			if err != nil || rondConfig.RequestFlow.PolicyName == "" {
 				errorMessage := "User is not allowed to request the API"
 				statusCode := http.StatusForbidden
-				fields := logrus.Fields{
+				fields := map[string]any{
 					"originalRequestPath": utils.SanitizeString(r.URL.Path),
 					"method":              utils.SanitizeString(r.Method),
 					"allowPermission":     utils.SanitizeString(rondConfig.RequestFlow.PolicyName),
@@ -93,13 +92,13 @@ func OPAMiddleware(
 				technicalError := ""
 				if err != nil {
 					technicalError = err.Error()
-					fields["error"] = logrus.Fields{"message": err.Error()}
+					fields["error"] = map[string]any{"message": err.Error()}
 					errorMessage = "The request doesn't match any known API"
 				}
 				if errors.Is(err, openapi.ErrNotFoundOASDefinition) {
 					statusCode = http.StatusNotFound
 				}
-				logger.WithFields(fields).Errorf(errorMessage)
+				logger.WithFields(fields).Error(errorMessage)
 				utils.FailResponseWithCode(w, statusCode, technicalError, errorMessage)
 				return
 			}
@@ -0,0 +1,214 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+const (
+	UpstreamCircuitOpenMessage = "upstream circuit breaker open"
+	UpstreamTimeoutMessage     = "upstream request timed out"
+	UpstreamFailedMessage      = "upstream request failed"
+
+	retryBackoff = 50 * time.Millisecond
+)
+
+// newTargetTransport returns the transport used to proxy the requests to the target
+// services, with the retries and the circuit breaker configured by the environment.
+func newTargetTransport(env config.EnvironmentVariables) (http.RoundTripper, error) {
+	transport, err := env.NewTargetServiceTransport()
+	if err != nil {
+		return nil, err
+	}
+	if transport == nil {
+		transport = defaultTransport{}
+	}
+	if env.CircuitBreakerFailureThreshold > 0 {
+		transport = newCircuitBreakerTransport(transport, env.CircuitBreakerFailureThreshold, time.Duration(env.CircuitBreakerOpenTimeoutMs)*time.Millisecond)
+	}
+	if env.TargetServiceMaxRetries > 0 {
+		transport = &retryTransport{next: transport, maxRetries: env.TargetServiceMaxRetries}
+	}
+	return transport, nil
+}
+
+// defaultTransport round trips with the http.DefaultTransport set at request time,
+// instead of the one set when the router is created.
+type defaultTransport struct{}
+
+func (defaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// isUpstreamFailure reports whether the round trip failed because the upstream
+// is not reachable or not available.
+func isUpstreamFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, ErrCircuitOpen)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryTransport retries the idempotent requests without body on upstream failures.
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isRetriable(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.maxRetries || !isUpstreamFailure(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			//#nosec G104 -- the response is discarded
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(time.Duration(attempt+1) * retryBackoff):
+		}
+	}
+}
+
+func isRetriable(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		(req.Body == nil || req.Body == http.NoBody)
+}
+
+// circuitBreakerTransport stops sending requests to an upstream host for the open
+// timeout once failureThreshold consecutive requests failed. After the timeout a
+// single request is let through: the circuit closes if it succeeds, otherwise it
+// opens again.
+type circuitBreakerTransport struct {
+	next             http.RoundTripper
+	failureThreshold int
+	openTimeout      time.Duration
+	now              func() time.Time
+
+	mtx      sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreakerTransport(next http.RoundTripper, failureThreshold int, openTimeout time.Duration) *circuitBreakerTransport {
+	return &circuitBreakerTransport{
+		next:             next,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		now:              time.Now,
+		circuits:         map[string]*circuit{},
+	}
+}
+
+func (t *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if !t.allow(host) {
+		return nil, ErrCircuitOpen
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	t.record(host, isUpstreamFailure(resp, err))
+	return resp, err
+}
+
+func (t *circuitBreakerTransport) allow(host string) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	c, ok := t.circuits[host]
+	if !ok || c.openUntil.IsZero() {
+		return true
+	}
+	if c.probing || t.now().Before(c.openUntil) {
+		return false
+	}
+	c.probing = true
+	return true
+}
+
+func (t *circuitBreakerTransport) record(host string, failed bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	c, ok := t.circuits[host]
+	if !ok {
+		c = &circuit{}
+		t.circuits[host] = c
+	}
+	if !failed {
+		*c = circuit{}
+		return
+	}
+
+	c.failures++
+	if c.probing || c.failures >= t.failureThreshold {
+		*c = circuit{openUntil: t.now().Add(t.openTimeout)}
+	}
+}
+
+// proxyErrorHandler writes the standard error body for the failed proxied requests,
+// with a technical error telling apart open circuits, timeouts and other failures.
+func proxyErrorHandler(logger logging.Logger) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, req *http.Request, err error) {
+		statusCode := http.StatusBadGateway
+		technicalError := UpstreamFailedMessage
+		var netErr net.Error
+		switch {
+		case errors.Is(err, ErrCircuitOpen):
+			statusCode = http.StatusServiceUnavailable
+			technicalError = UpstreamCircuitOpenMessage
+		case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+			statusCode = http.StatusGatewayTimeout
+			technicalError = UpstreamTimeoutMessage
+		}
+
+		logger.WithFields(map[string]any{
+			"error":      map[string]any{"message": err.Error()},
+			"statusCode": statusCode,
+		}).Error(technicalError)
+		utils.FailResponseWithCode(w, statusCode, technicalError, utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+	}
+}
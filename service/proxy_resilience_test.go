@@ -0,0 +1,321 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/config"
+	rondlogrus "github.com/rond-authz/rond/logging/logrus"
+	"github.com/rond-authz/rond/metrics"
+	metricstest "github.com/rond-authz/rond/metrics/test"
+	"github.com/rond-authz/rond/types"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func newFlakyServer(t *testing.T, failures int32) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestRetryTransport(t *testing.T) {
+	transport := &retryTransport{next: http.DefaultTransport, maxRetries: 2}
+
+	t.Run("retries GET requests on upstream failures", func(t *testing.T) {
+		server, calls := newFlakyServer(t, 2)
+
+		req := httptest.NewRequest(http.MethodGet, server.URL, nil)
+		req.RequestURI = ""
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, int32(3), atomic.LoadInt32(calls))
+	})
+
+	t.Run("returns the last failure when retries are exhausted", func(t *testing.T) {
+		server, calls := newFlakyServer(t, 5)
+
+		req := httptest.NewRequest(http.MethodHead, server.URL, nil)
+		req.RequestURI = ""
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Equal(t, int32(3), atomic.LoadInt32(calls))
+	})
+
+	t.Run("does not retry non idempotent requests", func(t *testing.T) {
+		server, calls := newFlakyServer(t, 2)
+
+		req := httptest.NewRequest(http.MethodPost, server.URL, strings.NewReader("{}"))
+		req.RequestURI = ""
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	doRequest := func(t *testing.T, transport http.RoundTripper, serverURL string) (int, error) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, serverURL, nil)
+		req.RequestURI = ""
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	t.Run("opens after consecutive failures and closes after a successful probe", func(t *testing.T) {
+		server, calls := newFlakyServer(t, 2)
+		now := time.Now()
+		transport := newCircuitBreakerTransport(http.DefaultTransport, 2, time.Minute)
+		transport.now = func() time.Time { return now }
+
+		for i := 0; i < 2; i++ {
+			statusCode, err := doRequest(t, transport, server.URL)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusServiceUnavailable, statusCode)
+		}
+
+		_, err := doRequest(t, transport, server.URL)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+		require.Equal(t, int32(2), atomic.LoadInt32(calls))
+
+		now = now.Add(time.Minute)
+		statusCode, err := doRequest(t, transport, server.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+
+		statusCode, err = doRequest(t, transport, server.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+	})
+
+	t.Run("opens again if the probe fails", func(t *testing.T) {
+		server, calls := newFlakyServer(t, 10)
+		now := time.Now()
+		transport := newCircuitBreakerTransport(http.DefaultTransport, 1, time.Minute)
+		transport.now = func() time.Time { return now }
+
+		_, err := doRequest(t, transport, server.URL)
+		require.NoError(t, err)
+
+		now = now.Add(time.Minute)
+		statusCode, err := doRequest(t, transport, server.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, statusCode)
+
+		_, err = doRequest(t, transport, server.URL)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+		require.Equal(t, int32(2), atomic.LoadInt32(calls))
+	})
+
+	t.Run("keeps a circuit per upstream host", func(t *testing.T) {
+		failingServer, _ := newFlakyServer(t, 10)
+		healthyServer, _ := newFlakyServer(t, 0)
+		transport := newCircuitBreakerTransport(http.DefaultTransport, 1, time.Minute)
+
+		_, err := doRequest(t, transport, failingServer.URL)
+		require.NoError(t, err)
+		_, err = doRequest(t, transport, failingServer.URL)
+		require.ErrorIs(t, err, ErrCircuitOpen)
+
+		statusCode, err := doRequest(t, transport, healthyServer.URL)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, statusCode)
+	})
+}
+
+func TestReverseProxyErrorHandler(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	logger := rondlogrus.NewLogger(log)
+
+	proxyRequest := func(t *testing.T, env config.EnvironmentVariables, transport http.RoundTripper) (*http.Response, types.RequestError) {
+		t.Helper()
+		ctx := WithTargetTransport(context.Background(), transport)
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.com:8080/api", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+
+		ReverseProxy(logger, env, w, req, nil, nil, core.InputUser{})
+
+		var body types.RequestError
+		require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&body))
+		return w.Result(), body
+	}
+
+	t.Run("returns 502 with JSON body if the upstream is not reachable", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		serverURL, _ := url.Parse(server.URL)
+		server.Close()
+
+		resp, body := proxyRequest(t, config.EnvironmentVariables{TargetServiceHost: serverURL.Host}, http.DefaultTransport)
+		require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		require.Equal(t, "application/json", resp.Header.Get("content-type"))
+		require.Equal(t, UpstreamFailedMessage, body.Error)
+		require.Equal(t, http.StatusBadGateway, body.StatusCode)
+	})
+
+	t.Run("returns 500 with JSON body if no target service matches the request", func(t *testing.T) {
+		upstreamTargets, err := config.ParseUpstreamTargets("/orders=http://orders")
+		require.NoError(t, err)
+		ctx := WithUpstreamTargets(context.Background(), upstreamTargets)
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.com:8080/api", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+
+		ReverseProxy(logger, config.EnvironmentVariables{}, w, req, nil, nil, core.InputUser{})
+
+		var body types.RequestError
+		require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&body))
+		require.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+		require.Equal(t, "no target service configured for the request path", body.Error)
+	})
+
+	t.Run("returns 500 with JSON body if the target service URL is invalid", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.com:8080/api", nil)
+		w := httptest.NewRecorder()
+
+		ReverseProxy(logger, config.EnvironmentVariables{TargetServiceHost: "invalid host:port"}, w, req, nil, nil, core.InputUser{})
+
+		var body types.RequestError
+		require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&body))
+		require.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+		require.Equal(t, "invalid target service URL", body.Error)
+	})
+
+	t.Run("proxies to the matching upstream target with an invalid target service URL", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/api", r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		upstreamTargets, err := config.ParseUpstreamTargets("/orders=" + server.URL)
+		require.NoError(t, err)
+		ctx := WithUpstreamTargets(context.Background(), upstreamTargets)
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.com:8080/orders/api", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+
+		ReverseProxy(logger, config.EnvironmentVariables{TargetServiceHost: "invalid host:port"}, w, req, nil, nil, core.InputUser{})
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	})
+
+	t.Run("returns 504 if the upstream response headers timeout", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer server.Close()
+		serverURL, _ := url.Parse(server.URL)
+
+		env := config.EnvironmentVariables{
+			TargetServiceHost:                    serverURL.Host,
+			TargetServiceResponseHeaderTimeoutMs: 20,
+		}
+		transport, err := newTargetTransport(env)
+		require.NoError(t, err)
+
+		resp, body := proxyRequest(t, env, transport)
+		require.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+		require.Equal(t, UpstreamTimeoutMessage, body.Error)
+	})
+
+	t.Run("returns 503 if the upstream circuit is open", func(t *testing.T) {
+		server, calls := newFlakyServer(t, 10)
+		serverURL, _ := url.Parse(server.URL)
+
+		env := config.EnvironmentVariables{
+			TargetServiceHost:              serverURL.Host,
+			CircuitBreakerFailureThreshold: 1,
+			CircuitBreakerOpenTimeoutMs:    60000,
+		}
+		transport, err := newTargetTransport(env)
+		require.NoError(t, err)
+
+		ctx := WithTargetTransport(context.Background(), transport)
+		w := httptest.NewRecorder()
+		ReverseProxy(logger, env, w, httptest.NewRequest(http.MethodGet, "/api", nil).WithContext(ctx), nil, nil, core.InputUser{})
+		require.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode)
+
+		resp, body := proxyRequest(t, env, transport)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Equal(t, UpstreamCircuitOpenMessage, body.Error)
+		require.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+}
+
+func TestReverseProxyMetrics(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	logger := rondlogrus.NewLogger(log)
+
+	t.Run("records upstream latency by host and status code", func(t *testing.T) {
+		server, _ := newFlakyServer(t, 1)
+		serverURL, _ := url.Parse(server.URL)
+		env := config.EnvironmentVariables{TargetServiceHost: serverURL.Host}
+		testMetrics, hook := metricstest.New()
+		ctx := metrics.WithContext(context.Background(), testMetrics)
+
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			ReverseProxy(logger, env, w, httptest.NewRequest(http.MethodGet, "/api", nil).WithContext(ctx), nil, nil, core.InputUser{})
+		}
+
+		entries := hook.EntriesByName(metrics.ProxyRequestDurationMetricName)
+		require.Len(t, entries, 2)
+		require.Equal(t, metrics.Labels{"upstream": serverURL.Host, "status_code": "503"}, entries[0].Labels)
+		require.Equal(t, metrics.Labels{"upstream": serverURL.Host, "status_code": "200"}, entries[1].Labels)
+	})
+
+	t.Run("records failed round trips", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		serverURL, _ := url.Parse(server.URL)
+		server.Close()
+		env := config.EnvironmentVariables{TargetServiceHost: serverURL.Host}
+		testMetrics, hook := metricstest.New()
+		ctx := metrics.WithContext(context.Background(), testMetrics)
+
+		w := httptest.NewRecorder()
+		ReverseProxy(logger, env, w, httptest.NewRequest(http.MethodGet, "/api", nil).WithContext(ctx), nil, nil, core.InputUser{})
+
+		entries := hook.EntriesByName(metrics.ProxyRequestDurationMetricName)
+		require.Len(t, entries, 1)
+		require.Equal(t, metrics.Labels{"upstream": serverURL.Host, "status_code": "error"}, entries[0].Labels)
+	})
+}
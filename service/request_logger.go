@@ -0,0 +1,85 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/logging"
+
+	"github.com/gorilla/mux"
+	"github.com/mia-platform/glogger/v4"
+	gloggercore "github.com/mia-platform/glogger/v4/loggers/core"
+	gmux "github.com/mia-platform/glogger/v4/middleware/mux"
+)
+
+// gloggerAdapter lets the glogger request middleware write the incoming and
+// completed request logs with a logging.Logger, whatever its backend is.
+type gloggerAdapter struct {
+	logger logging.Logger
+}
+
+func (a gloggerAdapter) WithFields(fields map[string]any) gloggercore.Logger[logging.Logger] {
+	return gloggerAdapter{logger: a.logger.WithFields(fields)}
+}
+
+func (a gloggerAdapter) WithContext(context.Context) gloggercore.Logger[logging.Logger] {
+	return a
+}
+
+func (a gloggerAdapter) Trace(msg string) {
+	a.logger.Trace(msg)
+}
+
+func (a gloggerAdapter) Info(msg string) {
+	a.logger.Info(msg)
+}
+
+func (a gloggerAdapter) OriginalLogger() logging.Logger {
+	return a.logger
+}
+
+// requestLoggerMiddleware logs the requests, except the ones with the excluded
+// prefixes, and injects the logger with the request id in the request context,
+// so that handlers can get it with logging.FromContext.
+func requestLoggerMiddleware(logger logging.Logger, excludedPrefixes []string) mux.MiddlewareFunc {
+	gloggerMiddleware := gmux.RequestMiddlewareLogger[logging.Logger](gloggerAdapter{logger: logger}, excludedPrefixes)
+	return func(next http.Handler) http.Handler {
+		return gloggerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestLogger, err := glogger.Get[logging.Logger](r.Context())
+			if err != nil {
+				requestLogger = logger
+			}
+			next.ServeHTTP(w, r.WithContext(logging.WithContext(r.Context(), requestLogger)))
+		}))
+	}
+}
+
+// printStatementsMiddleware enables the output of the policies print statements for
+// the requests asking for it with the header configured with PRINT_STATEMENTS_HEADER,
+// made by the users of the PRINT_STATEMENTS_GROUP group.
+func printStatementsMiddleware(env config.EnvironmentVariables) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if env.PrintStatementsRequested(r) {
+				r = r.WithContext(core.WithPrintStatements(r.Context()))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/logging/test"
+
+	"github.com/gorilla/mux"
+	"github.com/open-policy-agent/opa/topdown/print"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLoggerMiddleware(t *testing.T) {
+	setupRouter := func(logger logging.Logger) *mux.Router {
+		router := mux.NewRouter()
+		router.Use(requestLoggerMiddleware(logger, []string{"/-/"}))
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			logging.FromContext(r.Context()).Info("from handler")
+			w.WriteHeader(http.StatusAccepted)
+		}
+		router.HandleFunc("/api", handler)
+		router.HandleFunc("/-/healthz", handler)
+		return router
+	}
+
+	t.Run("logs the request and injects the logger with the request id", func(t *testing.T) {
+		logger := test.GetLogger()
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		req.Header.Set("x-request-id", "my-request-id")
+		setupRouter(logger).ServeHTTP(httptest.NewRecorder(), req)
+
+		records, err := test.GetRecords(logger)
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		require.Equal(t, "incoming request", records[0].Message)
+		require.Equal(t, "trace", records[0].Level)
+		require.Equal(t, "from handler", records[1].Message)
+		require.Equal(t, "my-request-id", records[1].Fields["reqId"])
+		require.Equal(t, "request completed", records[2].Message)
+		require.Equal(t, "info", records[2].Level)
+	})
+
+	t.Run("does not log requests with excluded prefixes", func(t *testing.T) {
+		logger := test.GetLogger()
+		req := httptest.NewRequest(http.MethodGet, "/-/healthz", nil)
+		setupRouter(logger).ServeHTTP(httptest.NewRecorder(), req)
+
+		records, err := test.GetRecords(logger)
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, "from handler", records[0].Message)
+		require.NotEmpty(t, records[0].Fields["reqId"])
+	})
+}
+
+func TestPrintStatementsMiddleware(t *testing.T) {
+	env := config.EnvironmentVariables{
+		PrintStatementsHeader: "x-rond-print",
+		PrintStatementsGroup:  "rond-debug",
+		UserGroupsHeader:      "miausergroups",
+	}
+
+	serve := func(t *testing.T, env config.EnvironmentVariables, headers map[string]string) []test.Record {
+		t.Helper()
+		logger := test.GetLogger()
+		handler := printStatementsMiddleware(env)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := logging.WithContext(r.Context(), logger)
+			require.NoError(t, core.NewPrintHook("allow", false).Print(print.Context{Context: ctx}, "from policy"))
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		records, err := test.GetRecords(logger)
+		require.NoError(t, err)
+		return records
+	}
+
+	t.Run("enables print statements for the request with the header of a user of the group", func(t *testing.T) {
+		records := serve(t, env, map[string]string{"x-rond-print": "true", "miausergroups": "rond-debug"})
+		require.Len(t, records, 1)
+		require.Equal(t, "from policy", records[0].Message)
+	})
+
+	t.Run("does not enable print statements for a user not in the group", func(t *testing.T) {
+		records := serve(t, env, map[string]string{"x-rond-print": "true", "miausergroups": "developers"})
+		require.Empty(t, records)
+	})
+
+	t.Run("does not enable print statements without the header", func(t *testing.T) {
+		records := serve(t, env, map[string]string{"miausergroups": "rond-debug"})
+		require.Empty(t, records)
+	})
+
+	t.Run("does not enable print statements if header is not configured", func(t *testing.T) {
+		records := serve(t, config.EnvironmentVariables{}, map[string]string{"x-rond-print": "true", "miausergroups": "rond-debug"})
+		require.Empty(t, records)
+	})
+}
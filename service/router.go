@@ -25,6 +25,8 @@ import (
 	"github.com/rond-authz/rond/core"
 	"github.com/rond-authz/rond/internal/config"
 	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/metrics"
 	"github.com/rond-authz/rond/openapi"
 	"github.com/rond-authz/rond/sdk/inputuser"
 	"github.com/rond-authz/rond/types"
@@ -33,16 +35,26 @@ import (
 	"github.com/davidebianchi/gswagger/support/gorilla"
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gorilla/mux"
-	glogrus "github.com/mia-platform/glogger/v4/loggers/logrus"
-	gmux "github.com/mia-platform/glogger/v4/middleware/mux"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/sirupsen/logrus"
 )
 
 const serviceName = "rönd"
 
 var routesToNotProxy = utils.Union(statusRoutes, []string{metricsRoutePath})
 
+// getRoutesToNotProxy returns the routes served by rond itself, including the ones
+// of the enabled features.
+func getRoutesToNotProxy(env config.EnvironmentVariables) []string {
+	routes := append([]string{}, routesToNotProxy...)
+	if env.SimulationAdminGroup != "" {
+		routes = append(routes, simulationRoutePath)
+	}
+	if env.ForwardAuth {
+		routes = append(routes, forwardAuthRoutePath)
+	}
+	return routes
+}
+
 var revokeDefinitions = swagger.Definitions{
 	RequestBody: &swagger.ContentValue{
 		Content: swagger.Content{
@@ -57,6 +69,11 @@ var revokeDefinitions = swagger.Definitions{
 				"application/json": {Value: RevokeResponseBody{}},
 			},
 		},
+		http.StatusMultiStatus: {
+			Content: swagger.Content{
+				"application/json": {Value: RevokeResponseBody{}},
+			},
+		},
 		http.StatusInternalServerError: {
 			Content: swagger.Content{
 				"application/json": {Value: types.RequestError{}},
@@ -71,6 +88,18 @@ var revokeDefinitions = swagger.Definitions{
 }
 
 var grantDefinitions = swagger.Definitions{
+	Headers: swagger.ParameterValue{
+		IdempotencyKeyHeader: {
+			Schema:      &swagger.Schema{Value: ""},
+			Description: "retries with the same key return the binding created by the first request",
+		},
+	},
+	Querystring: swagger.ParameterValue{
+		deduplicateQueryParam: {
+			Schema:      &swagger.Schema{Value: false},
+			Description: "if true, the id of an existing equivalent binding is returned instead of creating a new one",
+		},
+	},
 	RequestBody: &swagger.ContentValue{
 		Content: swagger.Content{
 			"application/json": {
@@ -94,31 +123,166 @@ var grantDefinitions = swagger.Definitions{
 				"application/json": {Value: types.RequestError{}},
 			},
 		},
+		http.StatusConflict: {
+			Content: swagger.Content{
+				"application/json": {Value: types.RequestError{}},
+			},
+		},
+	},
+}
+
+func jsonContentValue(value interface{}) swagger.ContentValue {
+	return swagger.ContentValue{
+		Content: swagger.Content{
+			"application/json": {Value: value},
+		},
+	}
+}
+
+var listSubjectBindingsDefinitions = swagger.Definitions{
+	PathParams: swagger.ParameterValue{
+		"subjectId": {Schema: &swagger.Schema{Value: ""}, Description: "the subject whose effective bindings are listed"},
+	},
+	Querystring: swagger.ParameterValue{
+		"groups": {Schema: &swagger.Schema{Value: ""}, Description: "comma separated list of the subject groups"},
+	},
+	Responses: map[int]swagger.ContentValue{
+		http.StatusOK:                  jsonContentValue([]types.Binding{}),
+		http.StatusInternalServerError: jsonContentValue(types.RequestError{}),
+		http.StatusBadRequest:          jsonContentValue(types.RequestError{}),
+	},
+}
+
+var listResourceBindingsDefinitions = swagger.Definitions{
+	PathParams: swagger.ParameterValue{
+		"resourceType": {Schema: &swagger.Schema{Value: ""}},
+		"resourceId":   {Schema: &swagger.Schema{Value: ""}},
+	},
+	Responses: map[int]swagger.ContentValue{
+		http.StatusOK:                  jsonContentValue([]types.Binding{}),
+		http.StatusInternalServerError: jsonContentValue(types.RequestError{}),
+		http.StatusBadRequest:          jsonContentValue(types.RequestError{}),
+	},
+}
+
+var updateBindingDefinitions = swagger.Definitions{
+	PathParams: swagger.ParameterValue{
+		"bindingId": {Schema: &swagger.Schema{Value: ""}},
+	},
+	RequestBody: &swagger.ContentValue{
+		Content: swagger.Content{
+			"application/json": {Value: UpdateBindingRequestBody{}},
+		},
+	},
+	Responses: map[int]swagger.ContentValue{
+		http.StatusOK:                  jsonContentValue(types.Binding{}),
+		http.StatusInternalServerError: jsonContentValue(types.RequestError{}),
+		http.StatusBadRequest:          jsonContentValue(types.RequestError{}),
+		http.StatusNotFound:            jsonContentValue(types.RequestError{}),
+	},
+}
+
+var accessReviewDefinitions = swagger.Definitions{
+	PathParams: swagger.ParameterValue{
+		"resourceType": {Schema: &swagger.Schema{Value: ""}},
+		"resourceId":   {Schema: &swagger.Schema{Value: ""}},
+	},
+	Querystring: swagger.ParameterValue{
+		accessReviewPermissionQueryParam: {Schema: &swagger.Schema{Value: ""}, Description: "if set, only the bindings granting this permission are returned"},
+	},
+	Responses: map[int]swagger.ContentValue{
+		http.StatusOK:                  jsonContentValue(AccessReviewResponseBody{}),
+		http.StatusInternalServerError: jsonContentValue(types.RequestError{}),
+		http.StatusBadRequest:          jsonContentValue(types.RequestError{}),
+	},
+}
+
+var listRolesDefinitions = swagger.Definitions{
+	Querystring: swagger.ParameterValue{
+		"roleIds": {Schema: &swagger.Schema{Value: ""}, Description: "comma separated list of role ids to retrieve"},
+	},
+	Responses: map[int]swagger.ContentValue{
+		http.StatusOK:                  jsonContentValue([]types.Role{}),
+		http.StatusInternalServerError: jsonContentValue(types.RequestError{}),
+	},
+}
+
+var getRoleDefinitions = swagger.Definitions{
+	PathParams: swagger.ParameterValue{
+		"roleId": {Schema: &swagger.Schema{Value: ""}},
+	},
+	Responses: map[int]swagger.ContentValue{
+		http.StatusOK:                  jsonContentValue(types.Role{}),
+		http.StatusInternalServerError: jsonContentValue(types.RequestError{}),
+		http.StatusNotFound:            jsonContentValue(types.RequestError{}),
+	},
+}
+
+var createRoleDefinitions = swagger.Definitions{
+	RequestBody: &swagger.ContentValue{
+		Content: swagger.Content{
+			"application/json": {Value: CreateRoleRequestBody{}},
+		},
+	},
+	Responses: map[int]swagger.ContentValue{
+		http.StatusCreated:             jsonContentValue(CreateRoleResponseBody{}),
+		http.StatusInternalServerError: jsonContentValue(types.RequestError{}),
+		http.StatusBadRequest:          jsonContentValue(types.RequestError{}),
+		http.StatusConflict:            jsonContentValue(types.RequestError{}),
+	},
+}
+
+var updateRoleDefinitions = swagger.Definitions{
+	PathParams: swagger.ParameterValue{
+		"roleId": {Schema: &swagger.Schema{Value: ""}},
+	},
+	RequestBody: &swagger.ContentValue{
+		Content: swagger.Content{
+			"application/json": {Value: UpdateRoleRequestBody{}},
+		},
+	},
+	Responses: map[int]swagger.ContentValue{
+		http.StatusOK:                  jsonContentValue(types.Role{}),
+		http.StatusInternalServerError: jsonContentValue(types.RequestError{}),
+		http.StatusBadRequest:          jsonContentValue(types.RequestError{}),
+		http.StatusNotFound:            jsonContentValue(types.RequestError{}),
+	},
+}
+
+var deleteRoleDefinitions = swagger.Definitions{
+	PathParams: swagger.ParameterValue{
+		"roleId": {Schema: &swagger.Schema{Value: ""}},
+	},
+	Responses: map[int]swagger.ContentValue{
+		http.StatusNoContent:           {},
+		http.StatusInternalServerError: jsonContentValue(types.RequestError{}),
+		http.StatusNotFound:            jsonContentValue(types.RequestError{}),
 	},
 }
 
 func SetupRouter(
-	log *logrus.Logger,
+	log logging.Logger,
 	env config.EnvironmentVariables,
 	opaModuleConfig *core.OPAModuleConfig,
 	oas *openapi.OpenAPISpec,
 	sdkBoot *SDKBootState,
 	inputUserClient inputuser.Client,
 	registry *prometheus.Registry,
+	m *metrics.Metrics,
 ) (*mux.Router, error) {
 	router := mux.NewRouter().UseEncodedPath()
-	router.Use(gmux.RequestMiddlewareLogger(glogrus.GetLogger(logrus.NewEntry(log)), []string{"/-/"}))
+	router.Use(requestLoggerMiddleware(log, []string{"/-/"}))
 
 	StatusRoutes(router, sdkBoot, serviceName, env.ServiceVersion)
 
-	if err := setupServiceRouter(env, log, router, opaModuleConfig, oas, sdkBoot, registry, inputUserClient); err != nil {
+	if err := setupServiceRouter(env, log, router, opaModuleConfig, oas, sdkBoot, registry, m, inputUserClient); err != nil {
 		return nil, err
 	}
 
 	//#nosec G104 -- Produces a false positive
 	router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 		path, _ := route.GetPathTemplate()
-		log.Tracef("Registered path: %s", path)
+		log.Trace(fmt.Sprintf("Registered path: %s", path))
 		return nil
 	})
 	log.Trace("router setup completed")
@@ -135,6 +299,7 @@ func setupEvalRoutes(router *mux.Router, oas *openapi.OpenAPISpec, env config.En
 	}
 
 	paths, methodsMap, ignoreTrailingSlashMap := oas.UnwrapConfiguration()
+	envRoutesToNotProxy := getRoutesToNotProxy(env)
 
 	// NOTE: The following sort is required by mux router because it expects
 	// routes to be registered in the proper order
@@ -145,7 +310,7 @@ func setupEvalRoutes(router *mux.Router, oas *openapi.OpenAPISpec, env config.En
 		if env.Standalone {
 			pathToRegister = fmt.Sprintf("%s%s", env.PathPrefixStandalone, path)
 		}
-		if utils.Contains(routesToNotProxy, pathToRegister) {
+		if utils.Contains(envRoutesToNotProxy, pathToRegister) {
 			continue
 		}
 		if strings.Contains(pathToRegister, "*") {
@@ -189,14 +354,34 @@ func setupEvalRoutes(router *mux.Router, oas *openapi.OpenAPISpec, env config.En
 	router.PathPrefix(fallbackRoute).HandlerFunc(rbacHandler)
 }
 
+func addRolesRoutes(swaggerRouter *swagger.Router[gorilla.HandlerFunc, gorilla.Route]) error {
+	if _, err := swaggerRouter.AddRoute(http.MethodGet, "/roles", listRolesHandler, listRolesDefinitions); err != nil {
+		return err
+	}
+	if _, err := swaggerRouter.AddRoute(http.MethodPost, "/roles", createRoleHandler, createRoleDefinitions); err != nil {
+		return err
+	}
+	if _, err := swaggerRouter.AddRoute(http.MethodGet, "/roles/{roleId}", getRoleHandler, getRoleDefinitions); err != nil {
+		return err
+	}
+	if _, err := swaggerRouter.AddRoute(http.MethodPatch, "/roles/{roleId}", updateRoleHandler, updateRoleDefinitions); err != nil {
+		return err
+	}
+	if _, err := swaggerRouter.AddRoute(http.MethodDelete, "/roles/{roleId}", deleteRoleHandler, deleteRoleDefinitions); err != nil {
+		return err
+	}
+	return nil
+}
+
 func setupServiceRouter(
 	env config.EnvironmentVariables,
-	log *logrus.Logger,
+	log logging.Logger,
 	router *mux.Router,
 	opaModuleConfig *core.OPAModuleConfig,
 	oas *openapi.OpenAPISpec,
 	sdkBootState *SDKBootState,
 	registry *prometheus.Registry,
+	m *metrics.Metrics,
 	inputUserClient inputuser.Client,
 ) error {
 	if env.ExposeMetrics {
@@ -205,6 +390,23 @@ func setupServiceRouter(
 
 	log.Trace("register env variables middleware")
 	router.Use(config.RequestMiddlewareEnvironments(env))
+	router.Use(printStatementsMiddleware(env))
+	router.Use(metricsMiddleware(m))
+
+	targetTransport, err := newTargetTransport(env)
+	if err != nil {
+		return err
+	}
+	router.Use(targetTransportMiddleware(targetTransport))
+
+	upstreamTargets, err := env.GetUpstreamTargets()
+	if err != nil {
+		return err
+	}
+	router.Use(upstreamTargetsMiddleware(upstreamTargets))
+
+	simulationRoute(router, env, sdkBootState, inputUserClient)
+	forwardAuthRoute(router, env, opaModuleConfig, sdkBootState, inputUserClient)
 
 	evalRouter := router.NewRoute().Subrouter()
 	if env.Standalone {
@@ -237,13 +439,39 @@ func setupServiceRouter(
 			return err
 		}
 
+		// bindings and roles management routes
+		if _, err := swaggerRouter.AddRoute(http.MethodGet, "/bindings/subject/{subjectId}", listSubjectBindingsHandler, listSubjectBindingsDefinitions); err != nil {
+			return err
+		}
+		if _, err := swaggerRouter.AddRoute(http.MethodGet, "/bindings/resource/{resourceType}/{resourceId}", listResourceBindingsHandler, listResourceBindingsDefinitions); err != nil {
+			return err
+		}
+		if _, err := swaggerRouter.AddRoute(http.MethodPatch, "/bindings/{bindingId}", updateBindingHandler, updateBindingDefinitions); err != nil {
+			return err
+		}
+		if _, err := swaggerRouter.AddRoute(http.MethodGet, "/access-review/resource/{resourceType}/{resourceId}", withInputUserClient(inputUserClient, accessReviewHandler).ServeHTTP, accessReviewDefinitions); err != nil {
+			return err
+		}
+		if env.RolesCrudServiceURL != "" {
+			if err := addRolesRoutes(swaggerRouter); err != nil {
+				return err
+			}
+		}
+
 		if err = swaggerRouter.GenerateAndExposeOpenapi(); err != nil {
 			return err
 		}
 	}
 
+	// without a target the requests are only authorized, by the ext_authz server
+	// or the forward auth route
+	if !env.Standalone && !env.HasProxyTarget() {
+		log.Debug("no target service configured, evaluation routes not registered")
+		return nil
+	}
+
 	log.Trace("register OPA middleware")
-	evalRouter.Use(OPAMiddleware(opaModuleConfig, sdkBootState, routesToNotProxy, env.TargetServiceOASPath, &OPAMiddlewareOptions{
+	evalRouter.Use(OPAMiddleware(opaModuleConfig, sdkBootState, getRoutesToNotProxy(env), env.TargetServiceOASPath, &OPAMiddlewareOptions{
 		IsStandalone:         env.Standalone,
 		PathPrefixStandalone: env.PathPrefixStandalone,
 	}))
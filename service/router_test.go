@@ -35,7 +35,6 @@ import (
 	"github.com/rond-authz/rond/sdk"
 	"github.com/rond-authz/rond/sdk/inputuser"
 
-	"github.com/mia-platform/glogger/v4"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
@@ -60,6 +59,7 @@ func TestSetupRoutes(t *testing.T) {
 				"/-/check-up":      openapi.PathVerbs{"get": openapi.VerbConfig{}},
 				"/-/metrics":       openapi.PathVerbs{"get": openapi.VerbConfig{}},
 				"/-/rond/metrics":  openapi.PathVerbs{"get": openapi.VerbConfig{}},
+				"/-/rond/simulate": openapi.PathVerbs{"post": openapi.VerbConfig{}},
 				"/-/rbac-healthz":  openapi.PathVerbs{"get": openapi.VerbConfig{}},
 				"/-/rbac-ready":    openapi.PathVerbs{"get": openapi.VerbConfig{}},
 				"/-/rbac-check-up": openapi.PathVerbs{"get": openapi.VerbConfig{}},
@@ -81,6 +81,7 @@ func TestSetupRoutes(t *testing.T) {
 			"/-/healthz",
 			"/-/metrics",
 			"/-/ready",
+			"/-/rond/simulate",
 			"/bar",
 			"/documentation/json",
 			"/foo",
@@ -239,7 +240,7 @@ func createContext(
 	env config.EnvironmentVariables,
 	evaluator sdk.Evaluator,
 	inputUserClient *fake.InputUserClient,
-	logEntry *logrus.Entry,
+	logger logging.Logger,
 ) context.Context {
 	t.Helper()
 
@@ -252,11 +253,10 @@ func createContext(
 		partialContext = inputuser.AddClientInContext(partialContext, inputUserClient)
 	}
 
-	logger := logEntry
 	if logger == nil {
-		logger = logrus.NewEntry(logrus.New())
+		logger = rondlogrus.NewLogger(logrus.New())
 	}
-	partialContext = glogger.WithLogger(partialContext, logger)
+	partialContext = logging.WithContext(partialContext, logger)
 
 	return partialContext
 }
@@ -269,8 +269,9 @@ todo { true }`,
 var mockXPermission = core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "todo"}}
 
 type evaluatorParams struct {
-	logger   logging.Logger
-	registry *prometheus.Registry
+	logger         logging.Logger
+	registry       *prometheus.Registry
+	rateLimitStore custom_builtins.RateLimitStore
 }
 
 func getEvaluator(
@@ -301,7 +302,8 @@ func getEvaluator(
 
 	sdk, err := sdk.NewFromOAS(context.Background(), opaModule, oas, &sdk.Options{
 		EvaluatorOptions: &sdk.EvaluatorOptions{
-			MongoClient: mongoClient,
+			MongoClient:    mongoClient,
+			RateLimitStore: options.rateLimitStore,
 		},
 		Logger:  logger,
 		Metrics: m,
@@ -320,7 +322,7 @@ func TestSetupRoutesIntegration(t *testing.T) {
 
 	log, _ := test.NewNullLogger()
 	logger := rondlogrus.NewLogger(log)
-	ctx := glogger.WithLogger(context.Background(), logrus.NewEntry(log))
+	ctx := logging.WithContext(context.Background(), logger)
 
 	t.Run("invokes known API", func(t *testing.T) {
 		var invoked bool
@@ -553,8 +555,68 @@ func TestSetupRoutesIntegration(t *testing.T) {
 	})
 }
 
+func TestSetupRouterWithoutProxyTarget(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	oas := &openapi.OpenAPISpec{
+		Paths: openapi.OpenAPIPaths{
+			"/evalapi": openapi.PathVerbs{
+				"get": openapi.VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "test_policy"}},
+				},
+			},
+		},
+	}
+	rondSDK, err := sdk.NewFromOAS(context.Background(), opa, oas, &sdk.Options{})
+	require.NoError(t, err)
+
+	setupRouter := func(t *testing.T, env config.EnvironmentVariables) *mux.Router {
+		t.Helper()
+		sdkState := NewSDKBootState()
+		sdkState.Ready(rondSDK)
+		router, err := SetupRouter(rondlogrus.NewLogger(log), env, opa, oas, sdkState, nil, nil, nil)
+		require.NoError(t, err)
+		return router
+	}
+
+	t.Run("does not register the evaluation routes with only the ext_authz server", func(t *testing.T) {
+		router := setupRouter(t, config.EnvironmentVariables{ExtAuthzGRPCPort: "9000"})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/evalapi", nil))
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/-/rbac-ready", nil))
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	})
+
+	t.Run("does not register the evaluation routes in forward auth mode", func(t *testing.T) {
+		router := setupRouter(t, config.EnvironmentVariables{ForwardAuth: true})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/evalapi", nil))
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, forwardAuthRoutePath, nil)
+		req.Header.Set(forwardedMethodHeaderKey, http.MethodGet)
+		req.Header.Set(forwardedURIHeaderKey, "/evalapi")
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	})
+}
+
 func TestRoutesToNotProxy(t *testing.T) {
 	require.Equal(t, routesToNotProxy, []string{"/-/rbac-healthz", "/-/rbac-ready", "/-/rbac-check-up", "/-/rond/metrics"})
+
+	t.Run("without optional features", func(t *testing.T) {
+		require.Equal(t, routesToNotProxy, getRoutesToNotProxy(config.EnvironmentVariables{}))
+	})
+
+	t.Run("with simulation and forward auth enabled", func(t *testing.T) {
+		routes := getRoutesToNotProxy(config.EnvironmentVariables{SimulationAdminGroup: "admin", ForwardAuth: true})
+		require.Equal(t, []string{"/-/rbac-healthz", "/-/rbac-ready", "/-/rbac-check-up", "/-/rond/metrics", "/-/rond/simulate", "/-/rond/forward-auth"}, routes)
+	})
 }
 
 func prepareOASFromFile(t *testing.T, filePath string) *openapi.OpenAPISpec {
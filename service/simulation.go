@@ -0,0 +1,174 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/openapi"
+	"github.com/rond-authz/rond/sdk"
+	"github.com/rond-authz/rond/sdk/inputuser"
+	"github.com/rond-authz/rond/types"
+
+	"github.com/gorilla/mux"
+)
+
+var simulationRoutePath = "/-/rond/simulate"
+
+type SimulationRequestBody struct {
+	// Input is the input the policy is evaluated with. The evaluator is selected
+	// using the request method and path.
+	Input core.Input `json:"input"`
+	// LoadBindings replaces the input user bindings and roles with the ones
+	// retrieved for the user id and groups.
+	LoadBindings bool `json:"loadBindings,omitempty"`
+}
+
+type SimulationMatchedRoute struct {
+	MatchedPath   string `json:"matchedPath"`
+	RequestedPath string `json:"requestedPath"`
+	Method        string `json:"method"`
+}
+
+type SimulationResponseBody struct {
+	Allowed      bool                   `json:"allowed"`
+	PolicyName   string                 `json:"policyName"`
+	RowFilter    json.RawMessage        `json:"rowFilter,omitempty"`
+	MatchedRoute SimulationMatchedRoute `json:"matchedRoute"`
+	// Error is the policy evaluation error, if any. The simulated request is denied.
+	Error string `json:"error,omitempty"`
+}
+
+// simulationRoute registers the what-if endpoint, which evaluates the request policy
+// for a hypothetical input. It is reserved to users of the configured admin group.
+func simulationRoute(r *mux.Router, env config.EnvironmentVariables, sdkBoot *SDKBootState, inputUserClient inputuser.Client) {
+	if env.SimulationAdminGroup == "" {
+		return
+	}
+
+	handler := withInputUserClient(inputUserClient, simulationHandler(sdkBoot))
+	r.HandleFunc(simulationRoutePath, handler).Methods(http.MethodPost)
+}
+
+func simulationHandler(sdkBoot *SDKBootState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
+		env, err := config.GetEnv(r.Context())
+		if err != nil {
+			utils.FailResponseWithCode(w, http.StatusInternalServerError, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+			return
+		}
+
+		callerGroups := split(r.Header.Get(env.UserGroupsHeader), ",")
+		if !utils.Contains(callerGroups, env.SimulationAdminGroup) {
+			logger.WithField("userId", utils.SanitizeString(r.Header.Get(env.UserIdHeader))).Warn("simulation requested by non admin user")
+			utils.FailResponseWithCode(w, http.StatusForbidden, "simulation is reserved to admin users", utils.NO_PERMISSIONS_ERROR_MESSAGE)
+			return
+		}
+
+		rondSDK := sdkBoot.Get()
+		if rondSDK == nil {
+			utils.FailResponseWithCode(w, http.StatusServiceUnavailable, ErrSDKNotReadyMessage, ErrSDKNotReadyBusinessMessage)
+			return
+		}
+
+		reqBody := SimulationRequestBody{}
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			utils.FailResponseWithCode(w, http.StatusBadRequest, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+			return
+		}
+		input := reqBody.Input
+		if input.Request.Method == "" || input.Request.Path == "" {
+			utils.FailResponseWithCode(w, http.StatusBadRequest, "missing input request method or path", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+			return
+		}
+
+		evaluator, route, err := sdk.FindEvaluatorAndRoute(rondSDK, input.Request.Method, input.Request.Path)
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			if errors.Is(err, openapi.ErrNotFoundOASDefinition) {
+				statusCode = http.StatusNotFound
+			}
+			utils.FailResponseWithCode(w, statusCode, err.Error(), "The request doesn't match any known API")
+			return
+		}
+		matchedRoute := SimulationMatchedRoute{
+			MatchedPath:   route.PathTemplate,
+			RequestedPath: input.Request.Path,
+			Method:        input.Request.Method,
+		}
+		if len(input.Request.PathParams) == 0 {
+			input.Request.PathParams = route.PathParams
+		}
+
+		rondConfig := evaluator.Config()
+
+		if reqBody.LoadBindings {
+			client, err := inputuser.GetClientFromContext(r.Context())
+			if err != nil {
+				utils.FailResponseWithCode(w, http.StatusInternalServerError, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+				return
+			}
+			if client == nil {
+				utils.FailResponseWithCode(w, http.StatusBadRequest, "bindings cannot be loaded without a configured input user client", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+				return
+			}
+			input.User, err = inputuser.Get(r.Context(), logger, client, types.User{
+				ID:         input.User.ID,
+				Groups:     input.User.Groups,
+				Properties: input.User.Properties,
+			})
+			if err != nil {
+				logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed to get input user")
+				utils.FailResponse(w, "failed to get input user", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+				return
+			}
+		}
+
+		response := SimulationResponseBody{
+			PolicyName:   rondConfig.RequestFlow.PolicyName,
+			MatchedRoute: matchedRoute,
+		}
+		if rondConfig.RequestFlow.PolicyName == "" {
+			response.Error = "no policy configured for the matched route"
+			writeJSONResponse(w, r, http.StatusOK, response)
+			return
+		}
+
+		result, err := evaluator.EvaluateRequestPolicy(r.Context(), input, &sdk.EvaluateOptions{
+			Logger: logger,
+		})
+		if err != nil {
+			response.Error = err.Error()
+		}
+		response.Allowed = result.Allowed
+		if result.QueryToProxy != nil {
+			response.RowFilter = result.QueryToProxy
+		}
+
+		logger.WithFields(map[string]any{
+			"policyName":  rondConfig.RequestFlow.PolicyName,
+			"matchedPath": matchedRoute.MatchedPath,
+			"allowed":     response.Allowed,
+		}).Info("policy simulation completed")
+		writeJSONResponse(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rond-authz/rond/core"
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/internal/fake"
+	"github.com/rond-authz/rond/openapi"
+	"github.com/rond-authz/rond/sdk"
+	"github.com/rond-authz/rond/sdk/inputuser"
+	"github.com/rond-authz/rond/types"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulationRoute(t *testing.T) {
+	env := config.EnvironmentVariables{
+		UserGroupsHeader:     "miausergroups",
+		UserIdHeader:         "miauserid",
+		SimulationAdminGroup: "rond-admin",
+	}
+	oas := &openapi.OpenAPISpec{
+		Paths: openapi.OpenAPIPaths{
+			"/projects/{projectId}": openapi.PathVerbs{
+				"get": openapi.VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "allow_project"}},
+				},
+			},
+			"/projects/": openapi.PathVerbs{
+				"get": openapi.VerbConfig{
+					PermissionV2: &core.RondConfig{RequestFlow: core.RequestFlow{PolicyName: "filter_projects", GenerateQuery: true}},
+				},
+			},
+		},
+	}
+	opaModule := &core.OPAModuleConfig{
+		Name: "example.rego",
+		Content: `package policies
+allow_project {
+	binding := input.user.bindings[_]
+	binding.resource.resourceType == "project"
+	binding.resource.resourceId == input.request.pathParams.projectId
+}
+filter_projects {
+	project := data.resources[_]
+	project.owner == input.user.id
+}`,
+	}
+	rondSDK, err := sdk.NewFromOAS(context.Background(), opaModule, oas, nil)
+	require.NoError(t, err)
+	sdkBoot := NewSDKBootState()
+	sdkBoot.Ready(rondSDK)
+
+	projectBinding := types.Binding{
+		BindingID: "binding1",
+		Subjects:  []string{"piero"},
+		Resource:  &types.Resource{ResourceType: "project", ResourceID: "p1"},
+	}
+
+	simulate := func(t *testing.T, inputUserClient inputuser.Client, groups string, body SimulationRequestBody) *httptest.ResponseRecorder {
+		t.Helper()
+
+		router := mux.NewRouter()
+		simulationRoute(router, env, sdkBoot, inputUserClient)
+
+		bodyBytes, err := json.Marshal(body)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, simulationRoutePath, bytes.NewReader(bodyBytes))
+		req = req.WithContext(createContext(t, context.Background(), env, nil, nil, nil))
+		req.Header.Set("miausergroups", groups)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	decodeResponse := func(t *testing.T, w *httptest.ResponseRecorder) SimulationResponseBody {
+		t.Helper()
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+		var response SimulationResponseBody
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return response
+	}
+
+	t.Run("route is not registered without admin group", func(t *testing.T) {
+		router := mux.NewRouter()
+		simulationRoute(router, config.EnvironmentVariables{}, sdkBoot, nil)
+
+		req := httptest.NewRequest(http.MethodPost, simulationRoutePath, nil)
+		var match mux.RouteMatch
+		require.False(t, router.Match(req, &match))
+	})
+
+	t.Run("rejects non admin users", func(t *testing.T) {
+		w := simulate(t, nil, "developers", SimulationRequestBody{})
+		require.Equal(t, http.StatusForbidden, w.Result().StatusCode)
+	})
+
+	t.Run("rejects input without request", func(t *testing.T) {
+		w := simulate(t, nil, "developers,rond-admin", SimulationRequestBody{})
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("returns 404 for unknown routes", func(t *testing.T) {
+		w := simulate(t, nil, "rond-admin", SimulationRequestBody{
+			Input: core.Input{Request: core.InputRequest{Method: http.MethodDelete, Path: "/projects/p1"}},
+		})
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	})
+
+	t.Run("evaluates the provided input", func(t *testing.T) {
+		w := simulate(t, nil, "rond-admin", SimulationRequestBody{
+			Input: core.Input{
+				Request: core.InputRequest{
+					Method:     http.MethodGet,
+					Path:       "/projects/p1",
+					PathParams: map[string]string{"projectId": "p1"},
+				},
+				User: core.InputUser{ID: "piero", Bindings: []types.Binding{projectBinding}},
+			},
+		})
+
+		require.Equal(t, SimulationResponseBody{
+			Allowed:    true,
+			PolicyName: "allow_project",
+			MatchedRoute: SimulationMatchedRoute{
+				MatchedPath:   "/projects/:projectId",
+				RequestedPath: "/projects/p1",
+				Method:        http.MethodGet,
+			},
+		}, decodeResponse(t, w))
+	})
+
+	t.Run("denies the provided input", func(t *testing.T) {
+		w := simulate(t, nil, "rond-admin", SimulationRequestBody{
+			Input: core.Input{
+				Request: core.InputRequest{
+					Method:     http.MethodGet,
+					Path:       "/projects/p2",
+					PathParams: map[string]string{"projectId": "p2"},
+				},
+				User: core.InputUser{ID: "piero", Bindings: []types.Binding{projectBinding}},
+			},
+		})
+
+		response := decodeResponse(t, w)
+		require.False(t, response.Allowed)
+		require.Equal(t, "allow_project", response.PolicyName)
+	})
+
+	t.Run("loads user bindings and path params from the matched route", func(t *testing.T) {
+		w := simulate(t, &fake.InputUserClient{
+			UserBindings: []types.Binding{projectBinding},
+			UserRoles:    []types.Role{},
+		}, "rond-admin", SimulationRequestBody{
+			Input: core.Input{
+				Request: core.InputRequest{Method: http.MethodGet, Path: "/projects/p1"},
+				User:    core.InputUser{ID: "piero"},
+			},
+			LoadBindings: true,
+		})
+
+		require.True(t, decodeResponse(t, w).Allowed)
+	})
+
+	t.Run("load bindings fails without input user client", func(t *testing.T) {
+		w := simulate(t, nil, "rond-admin", SimulationRequestBody{
+			Input: core.Input{
+				Request: core.InputRequest{Method: http.MethodGet, Path: "/projects/p1"},
+				User:    core.InputUser{ID: "piero"},
+			},
+			LoadBindings: true,
+		})
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("returns the generated row filter", func(t *testing.T) {
+		w := simulate(t, nil, "rond-admin", SimulationRequestBody{
+			Input: core.Input{
+				Request: core.InputRequest{Method: http.MethodGet, Path: "/projects/"},
+				User:    core.InputUser{ID: "piero"},
+			},
+		})
+
+		response := decodeResponse(t, w)
+		require.True(t, response.Allowed)
+		require.Equal(t, "/projects/", response.MatchedRoute.MatchedPath)
+		require.JSONEq(t, `{"$or":[{"$and":[{"owner":{"$eq":"piero"}}]}]}`, string(response.RowFilter))
+	})
+}
@@ -0,0 +1,207 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/sdk/inputuser"
+	"github.com/rond-authz/rond/types"
+
+	"github.com/gorilla/mux"
+	"github.com/samber/lo"
+)
+
+const accessReviewPermissionQueryParam = "permission"
+
+type AccessReviewBinding struct {
+	BindingID string   `json:"bindingId"`
+	Subjects  []string `json:"subjects,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+	// Roles contains the roles assigned by the binding, expanded with their permissions.
+	// A role that cannot be found is reported with no permissions.
+	Roles []types.Role `json:"roles"`
+	// Permissions contains the permissions directly assigned by the binding.
+	Permissions []string `json:"permissions"`
+	// EffectivePermissions is the union of the direct and the role permissions.
+	EffectivePermissions []string `json:"effectivePermissions"`
+	// Global is true for the bindings without a resource, which grant their
+	// permissions on every resource.
+	Global bool `json:"global,omitempty"`
+}
+
+type AccessReviewResponseBody struct {
+	Resource   types.Resource        `json:"resource"`
+	Permission string                `json:"permission,omitempty"`
+	Subjects   []string              `json:"subjects"`
+	Groups     []string              `json:"groups"`
+	Bindings   []AccessReviewBinding `json:"bindings"`
+}
+
+// accessReviewHandler reports which subjects and groups have access to a resource,
+// with the bindings granting it, including the global bindings without a resource.
+// When the permission query parameter is set, only the bindings granting that
+// permission, either directly or through a role, are returned.
+func accessReviewHandler(w http.ResponseWriter, r *http.Request) {
+	resourceType := mux.Vars(r)["resourceType"]
+	resourceID := mux.Vars(r)["resourceId"]
+	if resourceType == "" || resourceID == "" {
+		utils.FailResponseWithCode(w, http.StatusBadRequest, "missing resource type or resource id", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+	permission := r.URL.Query().Get(accessReviewPermissionQueryParam)
+
+	client, ok := bindingsCrudClient(w, r)
+	if !ok {
+		return
+	}
+
+	bindings, err := listAll(r.Context(), client, map[string]any{
+		"$or": []map[string]any{
+			buildQuery(resourceType, []string{resourceID}, nil, nil),
+			{"resource": nil},
+		},
+	})
+	if err != nil {
+		failCrudResponse(w, r, err, "failed crud request for finding bindings")
+		return
+	}
+
+	roleIDs := lo.Uniq(lo.FlatMap(bindings, func(binding types.Binding, _ int) []string {
+		return binding.Roles
+	}))
+	roles, ok := retrieveRolesForAccessReview(w, r, roleIDs)
+	if !ok {
+		return
+	}
+
+	response := buildAccessReview(bindings, roles, permission)
+	response.Resource = types.Resource{ResourceType: resourceType, ResourceID: resourceID}
+
+	logging.FromContext(r.Context()).WithFields(map[string]any{
+		"resourceType": utils.SanitizeString(resourceType),
+		"resourceId":   utils.SanitizeString(resourceID),
+		"permission":   utils.SanitizeString(permission),
+		"bindings":     len(response.Bindings),
+	}).Debug("access review completed")
+	writeJSONResponse(w, r, http.StatusOK, response)
+}
+
+// retrieveRolesForAccessReview fetches the roles from the roles CRUD, if configured,
+// falling back to the input user client. Without any of them, roles are not expanded.
+func retrieveRolesForAccessReview(w http.ResponseWriter, r *http.Request, roleIDs []string) ([]types.Role, bool) {
+	if len(roleIDs) == 0 {
+		return nil, true
+	}
+
+	env, err := config.GetEnv(r.Context())
+	if err != nil {
+		utils.FailResponseWithCode(w, http.StatusInternalServerError, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return nil, false
+	}
+	if env.RolesCrudServiceURL != "" {
+		client, ok := rolesCrudClient(w, r)
+		if !ok {
+			return nil, false
+		}
+		roles, err := listAll(r.Context(), client, map[string]interface{}{"roleId": map[string]interface{}{"$in": roleIDs}})
+		if err != nil {
+			failCrudResponse(w, r, err, "failed crud request for finding roles")
+			return nil, false
+		}
+		return roles, true
+	}
+
+	inputUserClient, err := inputuser.GetClientFromContext(r.Context())
+	if err != nil {
+		utils.FailResponseWithCode(w, http.StatusInternalServerError, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return nil, false
+	}
+	if inputUserClient == nil {
+		logging.FromContext(r.Context()).Warn("no roles source configured, access review roles are not expanded")
+		return nil, true
+	}
+	roles, err := inputUserClient.RetrieveUserRolesByRolesID(r.Context(), roleIDs)
+	if err != nil {
+		logging.FromContext(r.Context()).WithField("error", map[string]any{"message": err.Error()}).Error("failed roles retrieval")
+		utils.FailResponseWithCode(w, http.StatusInternalServerError, "failed roles retrieval", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return nil, false
+	}
+	return roles, true
+}
+
+func buildAccessReview(bindings []types.Binding, roles []types.Role, permission string) AccessReviewResponseBody {
+	rolesByID := lo.KeyBy(roles, func(role types.Role) string { return role.RoleID })
+
+	response := AccessReviewResponseBody{
+		Permission: permission,
+		Subjects:   []string{},
+		Groups:     []string{},
+		Bindings:   []AccessReviewBinding{},
+	}
+	for _, binding := range bindings {
+		reviewed := AccessReviewBinding{
+			BindingID:   binding.BindingID,
+			Subjects:    binding.Subjects,
+			Groups:      binding.Groups,
+			Roles:       []types.Role{},
+			Permissions: nonNilStrings(binding.Permissions),
+			Global:      binding.Resource == nil,
+		}
+		effectivePermissions := append([]string{}, binding.Permissions...)
+		for _, roleID := range binding.Roles {
+			role, found := rolesByID[roleID]
+			if !found {
+				role = types.Role{RoleID: roleID}
+			}
+			role.Permissions = nonNilStrings(role.Permissions)
+			reviewed.Roles = append(reviewed.Roles, role)
+			effectivePermissions = append(effectivePermissions, role.Permissions...)
+		}
+		reviewed.EffectivePermissions = lo.Uniq(effectivePermissions)
+		sort.Strings(reviewed.EffectivePermissions)
+
+		if permission != "" && !lo.Contains(reviewed.EffectivePermissions, permission) {
+			continue
+		}
+		response.Bindings = append(response.Bindings, reviewed)
+		response.Subjects = append(response.Subjects, binding.Subjects...)
+		response.Groups = append(response.Groups, binding.Groups...)
+	}
+	response.Subjects = lo.Uniq(response.Subjects)
+	response.Groups = lo.Uniq(response.Groups)
+	sort.Strings(response.Subjects)
+	sort.Strings(response.Groups)
+	return response
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// withInputUserClient injects the input user client, if any, in the handler request context.
+func withInputUserClient(client inputuser.Client, handler http.HandlerFunc) http.HandlerFunc {
+	if client == nil {
+		return handler
+	}
+	return inputuser.ClientInjectorMiddleware(client)(handler).ServeHTTP
+}
@@ -0,0 +1,189 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/internal/fake"
+	"github.com/rond-authz/rond/types"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestAccessReviewHandler(t *testing.T) {
+	resource := &types.Resource{ResourceType: "project", ResourceID: "mike"}
+	bindingsFromCrud := []types.Binding{
+		{BindingID: "binding1", Subjects: []string{"piero", "ghigo"}, Roles: []string{"editor"}, Resource: resource},
+		{BindingID: "binding2", Groups: []string{"litfiba"}, Permissions: []string{"project.view"}, Resource: resource},
+		{BindingID: "binding3", Subjects: []string{"pelù"}, Roles: []string{"unknown"}, Resource: resource},
+		{BindingID: "binding4", Subjects: []string{"admin"}, Permissions: []string{"project.delete"}},
+	}
+	rolesFromCrud := []types.Role{
+		{RoleID: "editor", RoleName: "Editor", Permissions: []string{"project.view", "project.edit"}},
+	}
+	resourceQuery := `^\{"\$or":\[\{"resource.resourceId":\{"\$in":\["mike"\]\},"resource.resourceType":"project"\},\{"resource":null\}\]\}$`
+
+	doRequest := func(t *testing.T, ctx context.Context, path string) (*httptest.ResponseRecorder, AccessReviewResponseBody) {
+		t.Helper()
+		req := requestWithParams(t, ctx, http.MethodGet, path, bytes.NewBuffer(nil), map[string]string{
+			"resourceType": "project",
+			"resourceId":   "mike",
+		})
+		w := httptest.NewRecorder()
+		accessReviewHandler(w, req)
+
+		var response AccessReviewResponseBody
+		if w.Result().StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		}
+		return w, response
+	}
+
+	t.Run("returns bindings with roles expanded from roles crud", func(t *testing.T) {
+		ctx := createContext(t, context.Background(), config.EnvironmentVariables{
+			BindingsCrudServiceURL: "http://crud-service/bindings/",
+			RolesCrudServiceURL:    "http://crud-service/roles/",
+		}, nil, nil, nil)
+
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			MatchParam("_q", resourceQuery).
+			Reply(http.StatusOK).
+			JSON(bindingsFromCrud)
+		newGockScope(t, "http://crud-service", http.MethodGet, "/roles/").
+			MatchParam("_q", `^\{"roleId":\{"\$in":\["editor","unknown"\]\}\}$`).
+			Reply(http.StatusOK).
+			JSON(rolesFromCrud)
+
+		w, response := doRequest(t, ctx, "/")
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Equal(t, AccessReviewResponseBody{
+			Resource: types.Resource{ResourceType: "project", ResourceID: "mike"},
+			Subjects: []string{"admin", "ghigo", "pelù", "piero"},
+			Groups:   []string{"litfiba"},
+			Bindings: []AccessReviewBinding{
+				{
+					BindingID:            "binding1",
+					Subjects:             []string{"piero", "ghigo"},
+					Roles:                rolesFromCrud,
+					Permissions:          []string{},
+					EffectivePermissions: []string{"project.edit", "project.view"},
+				},
+				{
+					BindingID:            "binding2",
+					Groups:               []string{"litfiba"},
+					Roles:                []types.Role{},
+					Permissions:          []string{"project.view"},
+					EffectivePermissions: []string{"project.view"},
+				},
+				{
+					BindingID:            "binding3",
+					Subjects:             []string{"pelù"},
+					Roles:                []types.Role{{RoleID: "unknown", Permissions: []string{}}},
+					Permissions:          []string{},
+					EffectivePermissions: []string{},
+				},
+				{
+					BindingID:            "binding4",
+					Subjects:             []string{"admin"},
+					Roles:                []types.Role{},
+					Permissions:          []string{"project.delete"},
+					EffectivePermissions: []string{"project.delete"},
+					Global:               true,
+				},
+			},
+		}, response)
+	})
+
+	t.Run("filters bindings by permission using input user client roles", func(t *testing.T) {
+		ctx := createContext(t, context.Background(), config.EnvironmentVariables{
+			BindingsCrudServiceURL: "http://crud-service/bindings/",
+		}, nil, &fake.InputUserClient{UserRoles: rolesFromCrud}, nil)
+
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			MatchParam("_q", resourceQuery).
+			Reply(http.StatusOK).
+			JSON(bindingsFromCrud)
+
+		w, response := doRequest(t, ctx, "/?permission=project.edit")
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Equal(t, "project.edit", response.Permission)
+		require.Equal(t, []string{"ghigo", "piero"}, response.Subjects)
+		require.Equal(t, []string{}, response.Groups)
+		require.Len(t, response.Bindings, 1)
+		require.Equal(t, "binding1", response.Bindings[0].BindingID)
+	})
+
+	t.Run("without roles source only direct permissions are reviewed", func(t *testing.T) {
+		ctx := createContext(t, context.Background(), config.EnvironmentVariables{
+			BindingsCrudServiceURL: "http://crud-service/bindings/",
+		}, nil, nil, nil)
+
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			MatchParam("_q", resourceQuery).
+			Reply(http.StatusOK).
+			JSON(bindingsFromCrud)
+
+		w, response := doRequest(t, ctx, "/?permission=project.view")
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Len(t, response.Bindings, 1)
+		require.Equal(t, "binding2", response.Bindings[0].BindingID)
+		require.Equal(t, []string{"litfiba"}, response.Groups)
+	})
+
+	t.Run("fails if roles retrieval fails", func(t *testing.T) {
+		ctx := createContext(t, context.Background(), config.EnvironmentVariables{
+			BindingsCrudServiceURL: "http://crud-service/bindings/",
+		}, nil, &fake.InputUserClient{UserRolesError: fmt.Errorf("some error")}, nil)
+
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			MatchParam("_q", resourceQuery).
+			Reply(http.StatusOK).
+			JSON(bindingsFromCrud)
+
+		w, _ := doRequest(t, ctx, "/")
+
+		require.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+	})
+
+	t.Run("fails if bindings crud fails", func(t *testing.T) {
+		ctx := createContext(t, context.Background(), config.EnvironmentVariables{
+			BindingsCrudServiceURL: "http://crud-service/bindings/",
+		}, nil, nil, nil)
+
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			Reply(http.StatusInternalServerError).
+			JSON(map[string]interface{}{"statusCode": 500, "message": "some error"})
+
+		w, _ := doRequest(t, ctx, "/")
+
+		require.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+	})
+}
@@ -15,37 +15,70 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/rond-authz/rond/internal/config"
 	"github.com/rond-authz/rond/internal/helpers"
 	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
 	"github.com/rond-authz/rond/types"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	glogrus "github.com/mia-platform/glogger/v4/loggers/logrus"
 	"github.com/mia-platform/go-crud-service-client"
-	"github.com/sirupsen/logrus"
+	"github.com/samber/lo"
 )
 
-// TODO: handle pagination!
+// BINDINGS_MAX_PAGE_SIZE is both the page size used to list bindings from the CRUD
+// and the maximum number of bindings deleted or patched by a single CRUD request.
 const BINDINGS_MAX_PAGE_SIZE = 200
 
+const (
+	revokeOperationDelete = "delete"
+	revokeOperationPatch  = "patch"
+)
+
 type RevokeRequestBody struct {
 	Subjects    []string `json:"subjects,omitempty"`
 	Groups      []string `json:"groups,omitempty"`
 	ResourceIDs []string `json:"resourceIds"`
 }
+
+// RevokeChunkResult reports the outcome of a single CRUD request issued
+// while revoking bindings.
+type RevokeChunkResult struct {
+	Operation string `json:"operation"`
+	Bindings  int    `json:"bindings"`
+	Processed int    `json:"processed"`
+	Error     string `json:"error,omitempty"`
+}
+
 type RevokeResponseBody struct {
-	DeletedBindings  int `json:"deletedBindings"`
-	ModifiedBindings int `json:"modifiedBindings"`
+	DeletedBindings  int                 `json:"deletedBindings"`
+	ModifiedBindings int                 `json:"modifiedBindings"`
+	FailedBindings   int                 `json:"failedBindings,omitempty"`
+	Chunks           []RevokeChunkResult `json:"chunks,omitempty"`
+}
+
+func (r RevokeResponseBody) hasFailures() bool {
+	return r.FailedBindings > 0
+}
+
+func (r RevokeResponseBody) hasProgress() bool {
+	for _, chunk := range r.Chunks {
+		if chunk.Error == "" {
+			return true
+		}
+	}
+	return false
 }
 
 func revokeHandler(w http.ResponseWriter, r *http.Request) {
-	logger := glogrus.FromContext(r.Context())
+	logger := logging.FromContext(r.Context())
 	env, err := config.GetEnv(r.Context())
 	if err != nil {
 		utils.FailResponseWithCode(w, http.StatusInternalServerError, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
@@ -72,84 +105,124 @@ func revokeHandler(w http.ResponseWriter, r *http.Request) {
 		Headers: helpers.GetHeadersToProxy(r, env.GetAdditionalHeadersToProxy()),
 	})
 	if err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("failed crud setup")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed crud setup")
 		utils.FailResponseWithCode(w, http.StatusInternalServerError, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
 		return
 	}
 
 	query := buildQuery(resourceType, reqBody.ResourceIDs, reqBody.Subjects, reqBody.Groups)
-	bindings, err := client.List(r.Context(), crud.Options{
-		Filter: crud.Filter{
-			MongoQuery: query,
-			Limit:      BINDINGS_MAX_PAGE_SIZE,
-		},
-	})
+	bindings, err := listAll(r.Context(), client, query)
 	if err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("failed crud request")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed crud request")
 		utils.FailResponseWithCode(w, http.StatusInternalServerError, "failed crud request for finding bindings", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
 		return
 	}
+	logger.WithField("foundBindings", len(bindings)).Debug("bindings to revoke retrieved")
 
 	bindingsToPatch, bindingsToDelete := prepareBindings(bindings, reqBody)
 
-	var deleteCrudResponse int
-	var patchCrudResponse int
-
-	if len(bindingsToDelete) > 0 {
-		query := buildQueryForBindingsToDelete(bindingsToDelete)
-		if err != nil {
-			logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("failed delete query crud setup")
-			utils.FailResponseWithCode(w, http.StatusInternalServerError, "failed delete query crud setup", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
-			return
-		}
-
-		logger.WithFields(logrus.Fields{
+	response := RevokeResponseBody{}
+	for _, chunk := range lo.Chunk(bindingsToDelete, BINDINGS_MAX_PAGE_SIZE) {
+		query := buildQueryForBindingsToDelete(chunk)
+		logger.WithFields(map[string]any{
 			"bindingsToDeleteQuery": query,
-			"bindingsToDelete":      len(bindingsToDelete),
+			"bindingsToDelete":      len(chunk),
 		}).Debug("generated query for bindings to delete")
 
-		deleteCrudResponse, err = client.DeleteMany(r.Context(), crud.Options{Filter: crud.Filter{MongoQuery: query}})
+		chunkResult := RevokeChunkResult{Operation: revokeOperationDelete, Bindings: len(chunk)}
+		deleted, err := client.DeleteMany(r.Context(), crud.Options{Filter: crud.Filter{MongoQuery: query}})
 		if err != nil {
-			logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("failed crud request")
-			utils.FailResponseWithCode(w, http.StatusInternalServerError, "failed crud request for deleting unused bindings", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
-			return
+			logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed crud request for deleting unused bindings")
+			chunkResult.Error = err.Error()
+			response.FailedBindings += len(chunk)
+		} else {
+			chunkResult.Processed = deleted
+			response.DeletedBindings += deleted
+			logger.WithFields(map[string]any{
+				"deletedBindings":      deleted,
+				"totalDeletedBindings": response.DeletedBindings,
+			}).Debug("binding deletion chunk finished")
 		}
-		logger.WithField("deletedBindings", deleteCrudResponse).Debug("binding deletion finished")
+		response.Chunks = append(response.Chunks, chunkResult)
 	}
 
-	if len(bindingsToPatch) > 0 {
-		body := buildRequestBodyForBindingsToPatch(bindingsToPatch)
+	for _, chunk := range lo.Chunk(bindingsToPatch, BINDINGS_MAX_PAGE_SIZE) {
+		body := buildRequestBodyForBindingsToPatch(chunk)
 
-		patchCrudResponse, err = client.PatchBulk(r.Context(), body, crud.Options{})
+		chunkResult := RevokeChunkResult{Operation: revokeOperationPatch, Bindings: len(chunk)}
+		patched, err := client.PatchBulk(r.Context(), body, crud.Options{})
 		if err != nil {
-			logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("failed crud request")
+			logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed crud request to modify existing bindings")
+			chunkResult.Error = err.Error()
+			response.FailedBindings += len(chunk)
+		} else {
+			chunkResult.Processed = patched
+			response.ModifiedBindings += patched
+			logger.WithFields(map[string]any{
+				"updatedBindings":      patched,
+				"totalUpdatedBindings": response.ModifiedBindings,
+			}).Debug("binding update chunk finished")
+		}
+		response.Chunks = append(response.Chunks, chunkResult)
+	}
+
+	statusCode := http.StatusOK
+	if response.hasFailures() {
+		if !response.hasProgress() {
 			utils.FailResponseWithCode(
 				w,
 				http.StatusInternalServerError,
-				fmt.Sprintf("failed crud request to modify existing bindings. removed bindings: %d", deleteCrudResponse),
+				fmt.Sprintf("failed crud requests to revoke bindings. failed bindings: %d", response.FailedBindings),
 				utils.GENERIC_BUSINESS_ERROR_MESSAGE,
 			)
 			return
 		}
-		logger.WithField("updatedBindings", patchCrudResponse).Debug("binding updated finished")
+		logger.WithFields(map[string]any{
+			"deletedBindings":  response.DeletedBindings,
+			"modifiedBindings": response.ModifiedBindings,
+			"failedBindings":   response.FailedBindings,
+		}).Warn("bindings revoke partially failed")
+		statusCode = http.StatusMultiStatus
 	}
 
-	response := RevokeResponseBody{
-		DeletedBindings:  deleteCrudResponse,
-		ModifiedBindings: patchCrudResponse,
-	}
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("failed response body")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed response body")
 		utils.FailResponseWithCode(
 			w,
 			http.StatusInternalServerError,
-			fmt.Sprintf("failed response body creation. removed bindings: %d, modified bindings: %d", deleteCrudResponse, patchCrudResponse),
+			fmt.Sprintf("failed response body creation. removed bindings: %d, modified bindings: %d", response.DeletedBindings, response.ModifiedBindings),
 			utils.GENERIC_BUSINESS_ERROR_MESSAGE,
 		)
+		return
 	}
+	w.Header().Set(utils.ContentTypeHeaderKey, utils.JSONContentTypeHeader)
+	w.WriteHeader(statusCode)
 	if _, err := w.Write(responseBytes); err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Warn("failed response write")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Warn("failed response write")
+	}
+}
+
+// listAll pages through all the CRUD resources matching the query. Resources are
+// sorted by _id so that pages are stable across subsequent requests.
+func listAll[Resource any](ctx context.Context, client crud.Client[Resource], query map[string]interface{}) ([]Resource, error) {
+	resources := []Resource{}
+	for skip := 0; ; skip += BINDINGS_MAX_PAGE_SIZE {
+		page, err := client.List(ctx, crud.Options{
+			Filter: crud.Filter{
+				MongoQuery: query,
+				Limit:      BINDINGS_MAX_PAGE_SIZE,
+				Skip:       skip,
+				Sort:       "_id",
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, page...)
+		if len(page) < BINDINGS_MAX_PAGE_SIZE {
+			return resources, nil
+		}
 	}
 }
 
@@ -164,8 +237,22 @@ type GrantResponseBody struct {
 	BindingID string `json:"bindingId"`
 }
 
+// IdempotencyKeyHeader makes the grant idempotent: the id of the created binding is
+// derived from the key, so that retries return the binding created by the first request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// deduplicateQueryParam enables the detection of an existing binding equivalent to
+// the one to grant, whose id is returned instead of creating a new binding.
+const deduplicateQueryParam = "deduplicate"
+
+var idempotencyKeyNamespace = uuid.MustParse("0d5c8d6e-4a4b-4a38-9b3c-6f5f4f8a2d11")
+
+func bindingIDFromIdempotencyKey(key string) string {
+	return uuid.NewSHA1(idempotencyKeyNamespace, []byte(key)).String()
+}
+
 func grantHandler(w http.ResponseWriter, r *http.Request) {
-	logger := glogrus.FromContext(r.Context())
+	logger := logging.FromContext(r.Context())
 	env, err := config.GetEnv(r.Context())
 	if err != nil {
 		utils.FailResponseWithCode(w, http.StatusInternalServerError, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
@@ -194,7 +281,7 @@ func grantHandler(w http.ResponseWriter, r *http.Request) {
 		Headers: helpers.GetHeadersToProxy(r, env.GetAdditionalHeadersToProxy()),
 	})
 	if err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("failed crud setup")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed crud setup")
 		utils.FailResponseWithCode(w, http.StatusInternalServerError, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
 		return
 	}
@@ -214,34 +301,142 @@ func grantHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	bindingIDCreated, err := client.Create(r.Context(), bindingToCreate, crud.Options{})
+	idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+	if idempotencyKey != "" {
+		bindingToCreate.BindingID = bindingIDFromIdempotencyKey(idempotencyKey)
+	}
+
+	existingBinding, err := findExistingBinding(r, client, bindingToCreate, idempotencyKey != "")
 	if err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("failed crud request")
-		utils.FailResponseWithCode(w, http.StatusInternalServerError, "failed crud request for creating bindings", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed crud request")
+		utils.FailResponseWithCode(w, http.StatusInternalServerError, "failed crud request for finding existing bindings", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
 		return
 	}
-	logger.WithFields(logrus.Fields{
-		"createdBindingObjectId": utils.SanitizeString(bindingIDCreated),
-		"createdBindingId":       utils.SanitizeString(bindingToCreate.BindingID),
-		"resourceId":             utils.SanitizeString(reqBody.ResourceID),
-		"resourceType":           utils.SanitizeString(resourceType),
-	}).Debug("created bindings")
+	if existingBinding != nil {
+		if !equivalentBindings(*existingBinding, bindingToCreate) {
+			utils.FailResponseWithCode(w, http.StatusConflict, "idempotency key already used for a different binding", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+			return
+		}
+		logger.WithField("bindingId", utils.SanitizeString(existingBinding.BindingID)).Debug("binding already exists, skipping creation")
+		bindingToCreate.BindingID = existingBinding.BindingID
+	} else {
+		bindingIDCreated, err := client.Create(r.Context(), bindingToCreate, crud.Options{})
+		if err != nil {
+			logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed crud request")
+			// a concurrent request with the same idempotency key may have created the binding in the meantime
+			if idempotencyKey != "" {
+				if existingBinding, findErr := findExistingBinding(r, client, bindingToCreate, true); findErr == nil && existingBinding != nil && equivalentBindings(*existingBinding, bindingToCreate) {
+					writeGrantResponse(w, r, existingBinding.BindingID)
+					return
+				}
+			}
+			utils.FailResponseWithCode(w, http.StatusInternalServerError, "failed crud request for creating bindings", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+			return
+		}
+		logger.WithFields(map[string]any{
+			"createdBindingObjectId": utils.SanitizeString(bindingIDCreated),
+			"createdBindingId":       utils.SanitizeString(bindingToCreate.BindingID),
+			"resourceId":             utils.SanitizeString(reqBody.ResourceID),
+			"resourceType":           utils.SanitizeString(resourceType),
+		}).Debug("created bindings")
+	}
+
+	writeGrantResponse(w, r, bindingToCreate.BindingID)
+}
 
-	response := GrantResponseBody{BindingID: bindingToCreate.BindingID}
+func writeGrantResponse(w http.ResponseWriter, r *http.Request, bindingID string) {
+	logger := logging.FromContext(r.Context())
+	response := GrantResponseBody{BindingID: bindingID}
 
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Error("failed response body")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed response body")
 		utils.FailResponseWithCode(
 			w,
 			http.StatusInternalServerError,
 			"failed response body creation",
 			utils.GENERIC_BUSINESS_ERROR_MESSAGE,
 		)
+		return
 	}
 	if _, err := w.Write(responseBytes); err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Warn("failed response write")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Warn("failed response write")
+	}
+}
+
+// findExistingBinding looks for a binding already satisfying the grant: when byID is set
+// the binding with the same id is returned, otherwise if deduplication is requested the
+// first binding equivalent to bindingToCreate is returned.
+func findExistingBinding(r *http.Request, client crud.Client[types.Binding], bindingToCreate types.Binding, byID bool) (*types.Binding, error) {
+	if byID {
+		bindings, err := client.List(r.Context(), crud.Options{
+			Filter: crud.Filter{
+				Fields: map[string]string{"bindingId": bindingToCreate.BindingID},
+				Limit:  1,
+			},
+		})
+		if err != nil || len(bindings) == 0 {
+			return nil, err
+		}
+		return &bindings[0], nil
+	}
+
+	if deduplicate, _ := strconv.ParseBool(r.URL.Query().Get(deduplicateQueryParam)); !deduplicate {
+		return nil, nil
 	}
+
+	candidates, err := listAll(r.Context(), client, buildQueryForEquivalentBindings(bindingToCreate))
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		if equivalentBindings(candidate, bindingToCreate) {
+			return &candidate, nil
+		}
+	}
+	return nil, nil
+}
+
+func buildQueryForEquivalentBindings(binding types.Binding) map[string]interface{} {
+	query := map[string]interface{}{}
+	if binding.Resource != nil {
+		query["resource.resourceType"] = binding.Resource.ResourceType
+		query["resource.resourceId"] = binding.Resource.ResourceID
+	} else {
+		query["resource"] = nil
+	}
+
+	for field, values := range map[string][]string{
+		"subjects":    binding.Subjects,
+		"groups":      binding.Groups,
+		"roles":       binding.Roles,
+		"permissions": binding.Permissions,
+	} {
+		if len(values) > 0 {
+			query[field] = map[string]interface{}{"$all": values}
+		}
+	}
+	return query
+}
+
+// equivalentBindings reports whether two bindings grant the same roles and permissions
+// to the same subjects and groups on the same resource, regardless of their ids.
+func equivalentBindings(a, b types.Binding) bool {
+	if (a.Resource == nil) != (b.Resource == nil) {
+		return false
+	}
+	if a.Resource != nil && *a.Resource != *b.Resource {
+		return false
+	}
+	return sameElements(a.Subjects, b.Subjects) &&
+		sameElements(a.Groups, b.Groups) &&
+		sameElements(a.Roles, b.Roles) &&
+		sameElements(a.Permissions, b.Permissions)
+}
+
+func sameElements(a, b []string) bool {
+	left, right := lo.Uniq(a), lo.Uniq(b)
+	return len(left) == len(right) && len(lo.Intersect(left, right)) == len(left)
 }
 
 func buildQuery(resourceType string, resourceIDs []string, subjects []string, groups []string) map[string]interface{} {
@@ -23,7 +23,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/uuid"
@@ -549,6 +552,122 @@ func TestRevokeHandler(t *testing.T) {
 	})
 }
 
+func TestRevokeHandlerPagination(t *testing.T) {
+	t.Run("revokes all the bindings paging through the CRUD", func(t *testing.T) {
+		bindings := make([]types.Binding, 0, 450)
+		for i := 0; i < 450; i++ {
+			binding := types.Binding{
+				BindingID: fmt.Sprintf("binding-%03d", i),
+				Groups:    []string{"popular_group"},
+			}
+			if i%3 == 0 {
+				binding.Subjects = []string{"some_user"}
+			}
+			bindings = append(bindings, binding)
+		}
+		crudStandIn := newBindingsCrudStandIn(t, bindings)
+
+		ctx := createContext(t,
+			context.Background(),
+			config.EnvironmentVariables{BindingsCrudServiceURL: crudStandIn.URL()},
+			nil,
+			nil,
+			nil,
+		)
+		reqBody := setupRevokeRequestBody(t, RevokeRequestBody{
+			Groups: []string{"popular_group"},
+		})
+		req := requestWithParams(t, ctx, http.MethodPost, "/", bytes.NewBuffer(reqBody), nil)
+		w := httptest.NewRecorder()
+
+		revokeHandler(w, req)
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		revokeResponse := RevokeResponseBody{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&revokeResponse))
+		require.Equal(t, 300, revokeResponse.DeletedBindings)
+		require.Equal(t, 150, revokeResponse.ModifiedBindings)
+		require.Zero(t, revokeResponse.FailedBindings)
+		require.Equal(t, []RevokeChunkResult{
+			{Operation: revokeOperationDelete, Bindings: 200, Processed: 200},
+			{Operation: revokeOperationDelete, Bindings: 100, Processed: 100},
+			{Operation: revokeOperationPatch, Bindings: 150, Processed: 150},
+		}, revokeResponse.Chunks)
+
+		require.Equal(t, 3, crudStandIn.listRequests)
+		remaining := crudStandIn.Bindings()
+		require.Len(t, remaining, 150)
+		for _, binding := range remaining {
+			require.Equal(t, []string{"some_user"}, binding.Subjects)
+			require.Empty(t, binding.Groups)
+		}
+	})
+
+	t.Run("reports partial failures", func(t *testing.T) {
+		bindings := make([]types.Binding, 0, 250)
+		for i := 0; i < 250; i++ {
+			bindings = append(bindings, types.Binding{
+				BindingID: fmt.Sprintf("binding-%03d", i),
+				Subjects:  []string{"some_user"},
+			})
+		}
+		crudStandIn := newBindingsCrudStandIn(t, bindings)
+		crudStandIn.failDeleteRequest = 2
+
+		ctx := createContext(t,
+			context.Background(),
+			config.EnvironmentVariables{BindingsCrudServiceURL: crudStandIn.URL()},
+			nil,
+			nil,
+			nil,
+		)
+		reqBody := setupRevokeRequestBody(t, RevokeRequestBody{
+			Subjects: []string{"some_user"},
+		})
+		req := requestWithParams(t, ctx, http.MethodPost, "/", bytes.NewBuffer(reqBody), nil)
+		w := httptest.NewRecorder()
+
+		revokeHandler(w, req)
+
+		require.Equal(t, http.StatusMultiStatus, w.Result().StatusCode)
+
+		revokeResponse := RevokeResponseBody{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&revokeResponse))
+		require.Equal(t, 200, revokeResponse.DeletedBindings)
+		require.Equal(t, 0, revokeResponse.ModifiedBindings)
+		require.Equal(t, 50, revokeResponse.FailedBindings)
+		require.Len(t, revokeResponse.Chunks, 2)
+		require.Empty(t, revokeResponse.Chunks[0].Error)
+		require.NotEmpty(t, revokeResponse.Chunks[1].Error)
+		require.Len(t, crudStandIn.Bindings(), 50)
+	})
+
+	t.Run("500 if all the chunks fail", func(t *testing.T) {
+		crudStandIn := newBindingsCrudStandIn(t, []types.Binding{
+			{BindingID: "binding", Subjects: []string{"some_user"}},
+		})
+		crudStandIn.failDeleteRequest = 1
+
+		ctx := createContext(t,
+			context.Background(),
+			config.EnvironmentVariables{BindingsCrudServiceURL: crudStandIn.URL()},
+			nil,
+			nil,
+			nil,
+		)
+		reqBody := setupRevokeRequestBody(t, RevokeRequestBody{
+			Subjects: []string{"some_user"},
+		})
+		req := requestWithParams(t, ctx, http.MethodPost, "/", bytes.NewBuffer(reqBody), nil)
+		w := httptest.NewRecorder()
+
+		revokeHandler(w, req)
+
+		require.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+	})
+}
+
 func TestGrantHandler(t *testing.T) {
 	ctx := createContext(t,
 		context.Background(),
@@ -746,6 +865,189 @@ func TestGrantHandler(t *testing.T) {
 	})
 }
 
+func TestGrantHandlerIdempotency(t *testing.T) {
+	ctx := createContext(t,
+		context.Background(),
+		config.EnvironmentVariables{BindingsCrudServiceURL: "http://crud-service/bindings/"},
+		nil,
+		nil,
+		nil,
+	)
+	reqBody := GrantRequestBody{
+		ResourceID: "projectID",
+		Subjects:   []string{"piero", "ghigo"},
+		Roles:      []string{"editor"},
+	}
+	expectedBindingID := bindingIDFromIdempotencyKey("provisioning-job-42")
+	existingBinding := types.Binding{
+		BindingID: expectedBindingID,
+		Subjects:  []string{"ghigo", "piero"},
+		Roles:     []string{"editor"},
+		Resource: &types.Resource{
+			ResourceType: "project",
+			ResourceID:   "projectID",
+		},
+	}
+
+	newGrantRequest := func(t *testing.T, path, idempotencyKey string) *http.Request {
+		t.Helper()
+		req := requestWithParams(t, ctx, http.MethodPost, path, bytes.NewBuffer(setupGrantRequestBody(t, reqBody)), map[string]string{
+			"resourceType": "project",
+		})
+		if idempotencyKey != "" {
+			req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+		}
+		return req
+	}
+
+	decodeBindingID := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		t.Helper()
+		var response GrantResponseBody
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return response.BindingID
+	}
+
+	t.Run("idempotency key creates binding with id derived from the key", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			MatchParam("bindingId", expectedBindingID).
+			Reply(http.StatusOK).
+			JSON([]types.Binding{})
+		newGockScope(t, "http://crud-service", http.MethodPost, "/bindings/").
+			AddMatcher(func(req *http.Request, ereq *gock.Request) (bool, error) {
+				var body types.Binding
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+				return assert.Equal(t, expectedBindingID, body.BindingID), nil
+			}).
+			Reply(http.StatusOK).
+			JSON(map[string]interface{}{"_id": "newObjectId"})
+
+		w := httptest.NewRecorder()
+		grantHandler(w, newGrantRequest(t, "/", "provisioning-job-42"))
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Equal(t, expectedBindingID, decodeBindingID(t, w))
+	})
+
+	t.Run("idempotency key returns the already created binding", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			MatchParam("bindingId", expectedBindingID).
+			Reply(http.StatusOK).
+			JSON([]types.Binding{existingBinding})
+
+		w := httptest.NewRecorder()
+		grantHandler(w, newGrantRequest(t, "/", "provisioning-job-42"))
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Equal(t, expectedBindingID, decodeBindingID(t, w))
+	})
+
+	t.Run("idempotency key reused for a different binding returns 409", func(t *testing.T) {
+		differentBinding := existingBinding
+		differentBinding.Roles = []string{"viewer"}
+
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			MatchParam("bindingId", expectedBindingID).
+			Reply(http.StatusOK).
+			JSON([]types.Binding{differentBinding})
+
+		w := httptest.NewRecorder()
+		grantHandler(w, newGrantRequest(t, "/", "provisioning-job-42"))
+
+		require.Equal(t, http.StatusConflict, w.Result().StatusCode)
+	})
+
+	t.Run("deduplicate returns the id of an equivalent binding", func(t *testing.T) {
+		candidate := existingBinding
+		candidate.BindingID = "existing-binding"
+
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			MatchParam("_q", `^\{"resource.resourceId":"projectID","resource.resourceType":"project","roles":\{"\$all":\["editor"\]\},"subjects":\{"\$all":\["piero","ghigo"\]\}\}$`).
+			Reply(http.StatusOK).
+			JSON([]types.Binding{
+				{
+					BindingID: "superset-binding",
+					Subjects:  []string{"piero", "ghigo", "pelù"},
+					Roles:     []string{"editor"},
+					Resource:  existingBinding.Resource,
+				},
+				candidate,
+			})
+
+		w := httptest.NewRecorder()
+		grantHandler(w, newGrantRequest(t, "/?deduplicate=true", ""))
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Equal(t, "existing-binding", decodeBindingID(t, w))
+	})
+
+	t.Run("deduplicate creates the binding if no equivalent binding exists", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			Reply(http.StatusOK).
+			JSON([]types.Binding{
+				{
+					BindingID: "superset-binding",
+					Subjects:  []string{"piero", "ghigo"},
+					Roles:     []string{"editor", "admin"},
+					Resource:  existingBinding.Resource,
+				},
+			})
+		newGockScope(t, "http://crud-service", http.MethodPost, "/bindings/").
+			Reply(http.StatusOK).
+			JSON(map[string]interface{}{"_id": "newObjectId"})
+
+		w := httptest.NewRecorder()
+		grantHandler(w, newGrantRequest(t, "/?deduplicate=true", ""))
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		bindingID := decodeBindingID(t, w)
+		require.NotEqual(t, "superset-binding", bindingID)
+		_, err := uuid.Parse(bindingID)
+		require.NoError(t, err)
+	})
+}
+
+func TestEquivalentBindings(t *testing.T) {
+	binding := types.Binding{
+		BindingID: "a",
+		Subjects:  []string{"piero", "ghigo"},
+		Groups:    []string{"litfiba"},
+		Resource:  &types.Resource{ResourceType: "project", ResourceID: "mike"},
+	}
+
+	t.Run("ignores binding ids and elements order", func(t *testing.T) {
+		other := binding
+		other.BindingID = "b"
+		other.Subjects = []string{"ghigo", "piero"}
+		require.True(t, equivalentBindings(binding, other))
+	})
+
+	t.Run("empty and missing lists are equivalent", func(t *testing.T) {
+		other := binding
+		other.Roles = []string{}
+		require.True(t, equivalentBindings(binding, other))
+	})
+
+	t.Run("different resources", func(t *testing.T) {
+		other := binding
+		other.Resource = &types.Resource{ResourceType: "project", ResourceID: "other"}
+		require.False(t, equivalentBindings(binding, other))
+
+		other.Resource = nil
+		require.False(t, equivalentBindings(binding, other))
+	})
+
+	t.Run("different subjects", func(t *testing.T) {
+		other := binding
+		other.Subjects = []string{"piero"}
+		require.False(t, equivalentBindings(binding, other))
+	})
+}
+
 func TestBindingsToUpdate(t *testing.T) {
 	t.Run("expect to generate correct bindings to update", func(t *testing.T) {
 		bindingsFromCrud := []types.Binding{
@@ -865,6 +1167,100 @@ func setupBodyBytes(t *testing.T, body interface{}) []byte {
 	return bodyBytes
 }
 
+// bindingsCrudStandIn is a minimal in-memory replacement of the CRUD Service bindings
+// collection: list requests honour limit and skip (but not the query), deletions are
+// performed by bindingId and bulk patches set subjects and groups.
+type bindingsCrudStandIn struct {
+	server *httptest.Server
+
+	mtx               sync.Mutex
+	bindings          []types.Binding
+	listRequests      int
+	deleteRequests    int
+	failDeleteRequest int
+}
+
+func newBindingsCrudStandIn(t *testing.T, bindings []types.Binding) *bindingsCrudStandIn {
+	t.Helper()
+
+	standIn := &bindingsCrudStandIn{bindings: bindings}
+	standIn.server = httptest.NewServer(http.HandlerFunc(standIn.serveHTTP))
+	t.Cleanup(standIn.server.Close)
+	return standIn
+}
+
+func (s *bindingsCrudStandIn) URL() string {
+	return s.server.URL + "/"
+}
+
+func (s *bindingsCrudStandIn) Bindings() []types.Binding {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.bindings
+}
+
+func (s *bindingsCrudStandIn) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/":
+		s.listRequests++
+		skip, _ := strconv.Atoi(r.URL.Query().Get("_sk"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("_l"))
+		page := []types.Binding{}
+		if skip < len(s.bindings) {
+			page = s.bindings[skip:min(skip+limit, len(s.bindings))]
+		}
+		w.Header().Set("content-type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	case r.Method == http.MethodDelete && r.URL.Path == "/":
+		s.deleteRequests++
+		if s.deleteRequests == s.failDeleteRequest {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var query struct {
+			BindingID struct {
+				In []string `json:"$in"`
+			} `json:"bindingId"`
+		}
+		json.Unmarshal([]byte(r.URL.Query().Get("_q")), &query)
+		remaining := []types.Binding{}
+		for _, binding := range s.bindings {
+			if !slices.Contains(query.BindingID.In, binding.BindingID) {
+				remaining = append(remaining, binding)
+			}
+		}
+		deleted := len(s.bindings) - len(remaining)
+		s.bindings = remaining
+		fmt.Fprint(w, deleted)
+	case r.Method == http.MethodPatch && r.URL.Path == "/bulk":
+		var body []struct {
+			Filter struct {
+				BindingID string `json:"bindingId"`
+			} `json:"filter"`
+			Update struct {
+				Set types.BindingUpdate `json:"$set"`
+			} `json:"update"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		patched := 0
+		for _, item := range body {
+			for i := range s.bindings {
+				if s.bindings[i].BindingID == item.Filter.BindingID {
+					s.bindings[i].Subjects = item.Update.Set.Subjects
+					s.bindings[i].Groups = item.Update.Set.Groups
+					patched++
+				}
+			}
+		}
+		fmt.Fprint(w, patched)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
 func requestWithParams(
 	t *testing.T,
 	ctx context.Context,
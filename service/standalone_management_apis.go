@@ -0,0 +1,362 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/internal/helpers"
+	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
+	"github.com/rond-authz/rond/types"
+
+	"github.com/gorilla/mux"
+	"github.com/mia-platform/go-crud-service-client"
+)
+
+type UpdateBindingRequestBody struct {
+	Roles       *[]string `json:"roles,omitempty"`
+	Permissions *[]string `json:"permissions,omitempty"`
+}
+
+type CreateRoleRequestBody struct {
+	RoleID      string   `json:"roleId"`
+	RoleName    string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type CreateRoleResponseBody struct {
+	RoleID string `json:"roleId"`
+}
+
+type UpdateRoleRequestBody struct {
+	RoleName    *string   `json:"name,omitempty"`
+	Permissions *[]string `json:"permissions,omitempty"`
+}
+
+func newCrudClient[Resource any](w http.ResponseWriter, r *http.Request, baseURL func(config.EnvironmentVariables) string) (crud.Client[Resource], bool) {
+	logger := logging.FromContext(r.Context())
+	env, err := config.GetEnv(r.Context())
+	if err != nil {
+		utils.FailResponseWithCode(w, http.StatusInternalServerError, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return crud.Client[Resource]{}, false
+	}
+
+	client, err := crud.NewClient[Resource](crud.ClientOptions{
+		BaseURL: baseURL(env),
+		Headers: helpers.GetHeadersToProxy(r, env.GetAdditionalHeadersToProxy()),
+	})
+	if err != nil {
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed crud setup")
+		utils.FailResponseWithCode(w, http.StatusInternalServerError, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return crud.Client[Resource]{}, false
+	}
+	return client, true
+}
+
+func bindingsCrudClient(w http.ResponseWriter, r *http.Request) (crud.Client[types.Binding], bool) {
+	return newCrudClient[types.Binding](w, r, func(env config.EnvironmentVariables) string {
+		return env.BindingsCrudServiceURL
+	})
+}
+
+func rolesCrudClient(w http.ResponseWriter, r *http.Request) (crud.Client[types.Role], bool) {
+	return newCrudClient[types.Role](w, r, func(env config.EnvironmentVariables) string {
+		return env.RolesCrudServiceURL
+	})
+}
+
+// failCrudResponse writes the error returned by the CRUD, preserving its status code
+// when it is a client error (e.g. a conflict on roleId creation).
+func failCrudResponse(w http.ResponseWriter, r *http.Request, err error, message string) {
+	logging.FromContext(r.Context()).WithField("error", map[string]any{"message": err.Error()}).Error(message)
+
+	var httpError *crud.HTTPError
+	if errors.As(err, &httpError) && httpError.StatusCode >= http.StatusBadRequest && httpError.StatusCode < http.StatusInternalServerError {
+		utils.FailResponseWithCode(w, httpError.StatusCode, httpError.Error(), message)
+		return
+	}
+	utils.FailResponseWithCode(w, http.StatusInternalServerError, message, utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+}
+
+func writeJSONResponse(w http.ResponseWriter, r *http.Request, statusCode int, body any) {
+	logger := logging.FromContext(r.Context())
+	responseBytes, err := json.Marshal(body)
+	if err != nil {
+		logger.WithField("error", map[string]any{"message": err.Error()}).Error("failed response body")
+		utils.FailResponseWithCode(w, http.StatusInternalServerError, "failed response body creation", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+	w.Header().Set(utils.ContentTypeHeaderKey, utils.JSONContentTypeHeader)
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(responseBytes); err != nil {
+		logger.WithField("error", map[string]any{"message": err.Error()}).Warn("failed response write")
+	}
+}
+
+func listSubjectBindingsHandler(w http.ResponseWriter, r *http.Request) {
+	subjectID := mux.Vars(r)["subjectId"]
+	if subjectID == "" {
+		utils.FailResponseWithCode(w, http.StatusBadRequest, "missing subject id", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+	groups := split(r.URL.Query().Get("groups"), ",")
+
+	client, ok := bindingsCrudClient(w, r)
+	if !ok {
+		return
+	}
+
+	bindings, err := listAll(r.Context(), client, buildQuery("", nil, []string{subjectID}, groups))
+	if err != nil {
+		failCrudResponse(w, r, err, "failed crud request for finding bindings")
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, bindings)
+}
+
+func listResourceBindingsHandler(w http.ResponseWriter, r *http.Request) {
+	resourceType := mux.Vars(r)["resourceType"]
+	resourceID := mux.Vars(r)["resourceId"]
+	if resourceType == "" || resourceID == "" {
+		utils.FailResponseWithCode(w, http.StatusBadRequest, "missing resource type or resource id", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+
+	client, ok := bindingsCrudClient(w, r)
+	if !ok {
+		return
+	}
+
+	bindings, err := listAll(r.Context(), client, buildQuery(resourceType, []string{resourceID}, nil, nil))
+	if err != nil {
+		failCrudResponse(w, r, err, "failed crud request for finding bindings")
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, bindings)
+}
+
+func updateBindingHandler(w http.ResponseWriter, r *http.Request) {
+	bindingID := mux.Vars(r)["bindingId"]
+	if bindingID == "" {
+		utils.FailResponseWithCode(w, http.StatusBadRequest, "missing binding id", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+
+	reqBody := UpdateBindingRequestBody{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		utils.FailResponseWithCode(w, http.StatusBadRequest, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+
+	set := map[string]any{}
+	if reqBody.Roles != nil {
+		set["roles"] = *reqBody.Roles
+	}
+	if reqBody.Permissions != nil {
+		set["permissions"] = *reqBody.Permissions
+	}
+	if len(set) == 0 {
+		utils.FailResponseWithCode(w, http.StatusBadRequest, "missing body fields, one of roles or permissions is required", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+
+	client, ok := bindingsCrudClient(w, r)
+	if !ok {
+		return
+	}
+
+	filter := crud.Filter{Fields: map[string]string{"bindingId": bindingID}}
+	if !patchByFilter(w, r, client, filter, set, "binding not found") {
+		return
+	}
+
+	bindings, err := client.List(r.Context(), crud.Options{Filter: crud.Filter{Fields: filter.Fields, Limit: 1}})
+	if err != nil || len(bindings) == 0 {
+		if err == nil {
+			err = errors.New("binding not found after update")
+		}
+		failCrudResponse(w, r, err, "failed crud request for finding updated binding")
+		return
+	}
+	logging.FromContext(r.Context()).WithField("bindingId", utils.SanitizeString(bindingID)).Debug("binding updated")
+	writeJSONResponse(w, r, http.StatusOK, bindings[0])
+}
+
+// patchByFilter applies the set update to the resource matching the filter,
+// writing a 404 response if no resource has been modified.
+func patchByFilter[Resource any](w http.ResponseWriter, r *http.Request, client crud.Client[Resource], filter crud.Filter, set map[string]any, notFoundMessage string) bool {
+	modified, err := client.PatchBulk(r.Context(), crud.PatchBulkBody{
+		{
+			Filter: crud.PatchBulkFilter{Fields: filter.Fields},
+			Update: crud.PatchBody{Set: set},
+		},
+	}, crud.Options{})
+	if err != nil {
+		failCrudResponse(w, r, err, "failed crud request for updating resource")
+		return false
+	}
+	if modified == 0 {
+		utils.FailResponseWithCode(w, http.StatusNotFound, notFoundMessage, utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return false
+	}
+	return true
+}
+
+func listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	client, ok := rolesCrudClient(w, r)
+	if !ok {
+		return
+	}
+
+	var query map[string]interface{}
+	if roleIDs := split(r.URL.Query().Get("roleIds"), ","); len(roleIDs) > 0 {
+		query = map[string]interface{}{"roleId": map[string]interface{}{"$in": roleIDs}}
+	}
+
+	roles, err := listAll(r.Context(), client, query)
+	if err != nil {
+		failCrudResponse(w, r, err, "failed crud request for finding roles")
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, roles)
+}
+
+func getRoleHandler(w http.ResponseWriter, r *http.Request) {
+	roleID := mux.Vars(r)["roleId"]
+
+	client, ok := rolesCrudClient(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := client.List(r.Context(), crud.Options{
+		Filter: crud.Filter{Fields: map[string]string{"roleId": roleID}, Limit: 1},
+	})
+	if err != nil {
+		failCrudResponse(w, r, err, "failed crud request for finding role")
+		return
+	}
+	if len(roles) == 0 {
+		utils.FailResponseWithCode(w, http.StatusNotFound, "role not found", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, roles[0])
+}
+
+func createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := CreateRoleRequestBody{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		utils.FailResponseWithCode(w, http.StatusBadRequest, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+	if reqBody.RoleID == "" || reqBody.RoleName == "" {
+		utils.FailResponseWithCode(w, http.StatusBadRequest, "missing body fields, roleId and name are required", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+	if reqBody.Permissions == nil {
+		reqBody.Permissions = []string{}
+	}
+
+	client, ok := rolesCrudClient(w, r)
+	if !ok {
+		return
+	}
+
+	roleToCreate := types.Role{
+		RoleID:      reqBody.RoleID,
+		RoleName:    reqBody.RoleName,
+		Permissions: reqBody.Permissions,
+	}
+	if _, err := client.Create(r.Context(), roleToCreate, crud.Options{}); err != nil {
+		failCrudResponse(w, r, err, "failed crud request for creating role")
+		return
+	}
+	logging.FromContext(r.Context()).WithField("roleId", utils.SanitizeString(reqBody.RoleID)).Debug("created role")
+
+	writeJSONResponse(w, r, http.StatusCreated, CreateRoleResponseBody{RoleID: reqBody.RoleID})
+}
+
+func updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	roleID := mux.Vars(r)["roleId"]
+
+	reqBody := UpdateRoleRequestBody{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		utils.FailResponseWithCode(w, http.StatusBadRequest, err.Error(), utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+
+	set := map[string]any{}
+	if reqBody.RoleName != nil {
+		if *reqBody.RoleName == "" {
+			utils.FailResponseWithCode(w, http.StatusBadRequest, "role name must not be empty", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+			return
+		}
+		set["name"] = *reqBody.RoleName
+	}
+	if reqBody.Permissions != nil {
+		set["permissions"] = *reqBody.Permissions
+	}
+	if len(set) == 0 {
+		utils.FailResponseWithCode(w, http.StatusBadRequest, "missing body fields, one of name or permissions is required", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+
+	client, ok := rolesCrudClient(w, r)
+	if !ok {
+		return
+	}
+
+	filter := crud.Filter{Fields: map[string]string{"roleId": roleID}}
+	if !patchByFilter(w, r, client, filter, set, "role not found") {
+		return
+	}
+
+	roles, err := client.List(r.Context(), crud.Options{Filter: crud.Filter{Fields: filter.Fields, Limit: 1}})
+	if err != nil || len(roles) == 0 {
+		if err == nil {
+			err = errors.New("role not found after update")
+		}
+		failCrudResponse(w, r, err, "failed crud request for finding updated role")
+		return
+	}
+	writeJSONResponse(w, r, http.StatusOK, roles[0])
+}
+
+func deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+	roleID := mux.Vars(r)["roleId"]
+
+	client, ok := rolesCrudClient(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := client.DeleteMany(r.Context(), crud.Options{
+		Filter: crud.Filter{Fields: map[string]string{"roleId": roleID}},
+	})
+	if err != nil {
+		failCrudResponse(w, r, err, "failed crud request for deleting role")
+		return
+	}
+	if deleted == 0 {
+		utils.FailResponseWithCode(w, http.StatusNotFound, "role not found", utils.GENERIC_BUSINESS_ERROR_MESSAGE)
+		return
+	}
+	logging.FromContext(r.Context()).WithField("roleId", utils.SanitizeString(roleID)).Debug("deleted role")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,367 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mia-platform/go-crud-service-client"
+	"github.com/rond-authz/rond/internal/config"
+	"github.com/rond-authz/rond/types"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestListBindingsHandlers(t *testing.T) {
+	ctx := createContext(t,
+		context.Background(),
+		config.EnvironmentVariables{BindingsCrudServiceURL: "http://crud-service/bindings/"},
+		nil,
+		nil,
+		nil,
+	)
+	bindingsFromCrud := []types.Binding{
+		{BindingID: "binding1", Subjects: []string{"piero"}, Roles: []string{"admin"}},
+		{BindingID: "binding2", Groups: []string{"litfiba"}, Permissions: []string{"read"}},
+	}
+
+	t.Run("list subject effective bindings", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			MatchParam("_q", `^\{"\$or":\[\{"subjects":\{"\$in":\["piero"\]\}\},\{"groups":\{"\$in":\["litfiba","band"\]\}\}\]\}$`).
+			Reply(http.StatusOK).
+			JSON(bindingsFromCrud)
+
+		req := requestWithParams(t, ctx, http.MethodGet, "/?groups=litfiba,band", bytes.NewBuffer(nil), map[string]string{
+			"subjectId": "piero",
+		})
+		w := httptest.NewRecorder()
+
+		listSubjectBindingsHandler(w, req)
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		var bindings []types.Binding
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&bindings))
+		require.Equal(t, bindingsFromCrud, bindings)
+	})
+
+	t.Run("list resource bindings", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			MatchParam("_q", `^\{"resource.resourceId":\{"\$in":\["mike"\]\},"resource.resourceType":"project"\}$`).
+			Reply(http.StatusOK).
+			JSON(bindingsFromCrud)
+
+		req := requestWithParams(t, ctx, http.MethodGet, "/", bytes.NewBuffer(nil), map[string]string{
+			"resourceType": "project",
+			"resourceId":   "mike",
+		})
+		w := httptest.NewRecorder()
+
+		listResourceBindingsHandler(w, req)
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		var bindings []types.Binding
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&bindings))
+		require.Equal(t, bindingsFromCrud, bindings)
+	})
+
+	t.Run("500 on CRUD error", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			Reply(http.StatusInternalServerError).
+			JSON(map[string]any{"message": "some error"})
+
+		req := requestWithParams(t, ctx, http.MethodGet, "/", bytes.NewBuffer(nil), map[string]string{
+			"subjectId": "piero",
+		})
+		w := httptest.NewRecorder()
+
+		listSubjectBindingsHandler(w, req)
+
+		require.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+	})
+}
+
+func TestUpdateBindingHandler(t *testing.T) {
+	ctx := createContext(t,
+		context.Background(),
+		config.EnvironmentVariables{BindingsCrudServiceURL: "http://crud-service/bindings/"},
+		nil,
+		nil,
+		nil,
+	)
+
+	t.Run("400 on missing body fields", func(t *testing.T) {
+		req := requestWithParams(t, ctx, http.MethodPatch, "/", bytes.NewBufferString(`{}`), map[string]string{
+			"bindingId": "binding1",
+		})
+		w := httptest.NewRecorder()
+
+		updateBindingHandler(w, req)
+
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("400 on invalid body", func(t *testing.T) {
+		req := requestWithParams(t, ctx, http.MethodPatch, "/", bytes.NewBufferString(`{"roles":"admin"}`), map[string]string{
+			"bindingId": "binding1",
+		})
+		w := httptest.NewRecorder()
+
+		updateBindingHandler(w, req)
+
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("404 if binding does not exist", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodPatch, "/bindings/bulk").
+			Reply(http.StatusOK).
+			BodyString("0")
+
+		req := requestWithParams(t, ctx, http.MethodPatch, "/", bytes.NewBufferString(`{"roles":["admin"]}`), map[string]string{
+			"bindingId": "binding1",
+		})
+		w := httptest.NewRecorder()
+
+		updateBindingHandler(w, req)
+
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	})
+
+	t.Run("updates roles and permissions", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodPatch, "/bindings/bulk").
+			AddMatcher(func(req *http.Request, greq *gock.Request) (bool, error) {
+				var body crud.PatchBulkBody
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+				require.Equal(t, crud.PatchBulkBody{
+					{
+						Filter: crud.PatchBulkFilter{
+							Fields: map[string]string{"bindingId": "binding1"},
+						},
+						Update: crud.PatchBody{
+							Set: map[string]any{
+								"roles":       []any{"admin"},
+								"permissions": []any{},
+							},
+						},
+					},
+				}, body)
+				return true, nil
+			}).
+			Reply(http.StatusOK).
+			BodyString("1")
+		newGockScope(t, "http://crud-service", http.MethodGet, "/bindings/").
+			MatchParam("bindingId", "binding1").
+			Reply(http.StatusOK).
+			JSON([]types.Binding{{BindingID: "binding1", Roles: []string{"admin"}}})
+
+		req := requestWithParams(t, ctx, http.MethodPatch, "/", bytes.NewBufferString(`{"roles":["admin"],"permissions":[]}`), map[string]string{
+			"bindingId": "binding1",
+		})
+		w := httptest.NewRecorder()
+
+		updateBindingHandler(w, req)
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		var binding types.Binding
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&binding))
+		require.Equal(t, types.Binding{BindingID: "binding1", Roles: []string{"admin"}}, binding)
+	})
+}
+
+func TestRolesHandlers(t *testing.T) {
+	ctx := createContext(t,
+		context.Background(),
+		config.EnvironmentVariables{RolesCrudServiceURL: "http://crud-service/roles/"},
+		nil,
+		nil,
+		nil,
+	)
+	role := types.Role{RoleID: "admin", RoleName: "Admin", Permissions: []string{"read", "write"}}
+
+	t.Run("list roles", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/roles/").
+			MatchParam("_q", `^\{"roleId":\{"\$in":\["admin"\]\}\}$`).
+			Reply(http.StatusOK).
+			JSON([]types.Role{role})
+
+		req := requestWithParams(t, ctx, http.MethodGet, "/?roleIds=admin", bytes.NewBuffer(nil), nil)
+		w := httptest.NewRecorder()
+
+		listRolesHandler(w, req)
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		var roles []types.Role
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&roles))
+		require.Equal(t, []types.Role{role}, roles)
+	})
+
+	t.Run("get role", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/roles/").
+			MatchParam("roleId", "admin").
+			Reply(http.StatusOK).
+			JSON([]types.Role{role})
+
+		req := requestWithParams(t, ctx, http.MethodGet, "/", bytes.NewBuffer(nil), map[string]string{"roleId": "admin"})
+		w := httptest.NewRecorder()
+
+		getRoleHandler(w, req)
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		var foundRole types.Role
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&foundRole))
+		require.Equal(t, role, foundRole)
+	})
+
+	t.Run("get role returns 404 if role does not exist", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodGet, "/roles/").
+			Reply(http.StatusOK).
+			JSON([]types.Role{})
+
+		req := requestWithParams(t, ctx, http.MethodGet, "/", bytes.NewBuffer(nil), map[string]string{"roleId": "admin"})
+		w := httptest.NewRecorder()
+
+		getRoleHandler(w, req)
+
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	})
+
+	t.Run("create role returns 400 on missing fields", func(t *testing.T) {
+		req := requestWithParams(t, ctx, http.MethodPost, "/", bytes.NewBufferString(`{"roleId":"admin"}`), nil)
+		w := httptest.NewRecorder()
+
+		createRoleHandler(w, req)
+
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+		var requestError types.RequestError
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&requestError))
+		require.Equal(t, "missing body fields, roleId and name are required", requestError.Error)
+	})
+
+	t.Run("create role", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodPost, "/roles/").
+			AddMatcher(func(req *http.Request, greq *gock.Request) (bool, error) {
+				var body types.Role
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+				require.Equal(t, role, body)
+				return true, nil
+			}).
+			Reply(http.StatusOK).
+			JSON(map[string]string{"_id": "objectid"})
+
+		reqBody := setupBodyBytes(t, CreateRoleRequestBody{RoleID: "admin", RoleName: "Admin", Permissions: []string{"read", "write"}})
+		req := requestWithParams(t, ctx, http.MethodPost, "/", bytes.NewBuffer(reqBody), nil)
+		w := httptest.NewRecorder()
+
+		createRoleHandler(w, req)
+
+		require.Equal(t, http.StatusCreated, w.Result().StatusCode)
+		var response CreateRoleResponseBody
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		require.Equal(t, CreateRoleResponseBody{RoleID: "admin"}, response)
+	})
+
+	t.Run("create role forwards CRUD conflict", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodPost, "/roles/").
+			Reply(http.StatusConflict).
+			JSON(map[string]any{"statusCode": 409, "error": "Conflict", "message": "duplicate key"})
+
+		reqBody := setupBodyBytes(t, CreateRoleRequestBody{RoleID: "admin", RoleName: "Admin"})
+		req := requestWithParams(t, ctx, http.MethodPost, "/", bytes.NewBuffer(reqBody), nil)
+		w := httptest.NewRecorder()
+
+		createRoleHandler(w, req)
+
+		require.Equal(t, http.StatusConflict, w.Result().StatusCode)
+		var requestError types.RequestError
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&requestError))
+		require.Equal(t, "duplicate key", requestError.Error)
+	})
+
+	t.Run("update role", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodPatch, "/roles/bulk").
+			AddMatcher(func(req *http.Request, greq *gock.Request) (bool, error) {
+				var body crud.PatchBulkBody
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+				require.Equal(t, map[string]any{"permissions": []any{"read"}}, body[0].Update.Set)
+				return true, nil
+			}).
+			Reply(http.StatusOK).
+			BodyString("1")
+		newGockScope(t, "http://crud-service", http.MethodGet, "/roles/").
+			MatchParam("roleId", "admin").
+			Reply(http.StatusOK).
+			JSON([]types.Role{{RoleID: "admin", RoleName: "Admin", Permissions: []string{"read"}}})
+
+		req := requestWithParams(t, ctx, http.MethodPatch, "/", bytes.NewBufferString(`{"permissions":["read"]}`), map[string]string{"roleId": "admin"})
+		w := httptest.NewRecorder()
+
+		updateRoleHandler(w, req)
+
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	})
+
+	t.Run("update role returns 400 on empty name", func(t *testing.T) {
+		req := requestWithParams(t, ctx, http.MethodPatch, "/", bytes.NewBufferString(`{"name":""}`), map[string]string{"roleId": "admin"})
+		w := httptest.NewRecorder()
+
+		updateRoleHandler(w, req)
+
+		require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+
+	t.Run("delete role", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodDelete, "/roles/").
+			MatchParam("roleId", "admin").
+			Reply(http.StatusOK).
+			BodyString("1")
+
+		req := requestWithParams(t, ctx, http.MethodDelete, "/", bytes.NewBuffer(nil), map[string]string{"roleId": "admin"})
+		w := httptest.NewRecorder()
+
+		deleteRoleHandler(w, req)
+
+		require.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+	})
+
+	t.Run("delete role returns 404 if role does not exist", func(t *testing.T) {
+		gock.DisableNetworking()
+		newGockScope(t, "http://crud-service", http.MethodDelete, "/roles/").
+			Reply(http.StatusOK).
+			BodyString("0")
+
+		req := requestWithParams(t, ctx, http.MethodDelete, "/", bytes.NewBuffer(nil), map[string]string{"roleId": "admin"})
+		w := httptest.NewRecorder()
+
+		deleteRoleHandler(w, req)
+
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	})
+}
@@ -19,10 +19,9 @@ import (
 	"net/http"
 
 	"github.com/rond-authz/rond/internal/utils"
+	"github.com/rond-authz/rond/logging"
 
 	"github.com/gorilla/mux"
-	glogrus "github.com/mia-platform/glogger/v4/loggers/logrus"
-	"github.com/sirupsen/logrus"
 )
 
 var statusRoutes = []string{"/-/rbac-healthz", "/-/rbac-ready", "/-/rbac-check-up"}
@@ -34,7 +33,7 @@ type StatusResponse struct {
 	Version string `json:"version"`
 }
 
-func sendStatusRoutes(w http.ResponseWriter, logger *logrus.Entry, ok bool, serviceName, serviceVersion string) {
+func sendStatusRoutes(w http.ResponseWriter, logger logging.Logger, ok bool, serviceName, serviceVersion string) {
 	statusMessage := "OK"
 	statusCode := http.StatusOK
 	if !ok {
@@ -56,7 +55,7 @@ func sendStatusRoutes(w http.ResponseWriter, logger *logrus.Entry, ok bool, serv
 
 	w.WriteHeader(statusCode)
 	if _, err := w.Write(body); err != nil {
-		logger.WithField("error", logrus.Fields{"message": err.Error()}).Warn("failed response write")
+		logger.WithField("error", map[string]any{"message": err.Error()}).Warn("failed response write")
 	}
 }
 
@@ -64,7 +63,7 @@ func handleOKHandler(serviceName, serviceVersion string) func(http.ResponseWrite
 	return func(w http.ResponseWriter, req *http.Request) {
 		sendStatusRoutes(
 			w,
-			glogrus.FromContext(req.Context()),
+			logging.FromContext(req.Context()),
 			true,
 			serviceName,
 			serviceVersion,
@@ -81,7 +80,7 @@ func handleSDKReadyHandler(sdkBoot *SDKBootState, serviceName, serviceVersion st
 
 		sendStatusRoutes(
 			w,
-			glogrus.FromContext(req.Context()),
+			logging.FromContext(req.Context()),
 			sdkReady,
 			serviceName,
 			serviceVersion,
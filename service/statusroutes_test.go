@@ -24,6 +24,7 @@ import (
 
 	"github.com/rond-authz/rond/core"
 	"github.com/rond-authz/rond/internal/config"
+	rondlogrus "github.com/rond-authz/rond/logging/logrus"
 	"github.com/rond-authz/rond/openapi"
 	"github.com/rond-authz/rond/sdk"
 
@@ -128,7 +129,7 @@ func TestStatusRoutesIntegration(t *testing.T) {
 			TargetServiceHost:    "my-service:4444",
 			PathPrefixStandalone: "/my-prefix",
 		}
-		router, err := SetupRouter(log, env, opa, oas, sdkState, nil, nil)
+		router, err := SetupRouter(rondlogrus.NewLogger(log), env, opa, oas, sdkState, nil, nil, nil)
 		require.NoError(t, err, "unexpected error")
 
 		t.Run("/-/rbac-ready", func(t *testing.T) {
@@ -163,7 +164,7 @@ func TestStatusRoutesIntegration(t *testing.T) {
 			PathPrefixStandalone: "/my-prefix",
 			ServiceVersion:       "latest",
 		}
-		router, err := SetupRouter(log, env, opa, oas, sdkState, nil, nil)
+		router, err := SetupRouter(rondlogrus.NewLogger(log), env, opa, oas, sdkState, nil, nil, nil)
 		require.NoError(t, err, "unexpected error")
 		t.Run("/-/rbac-ready", func(t *testing.T) {
 			w := httptest.NewRecorder()
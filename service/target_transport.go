@@ -0,0 +1,120 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rond-authz/rond/internal/tracing"
+	"github.com/rond-authz/rond/metrics"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type targetTransportKey struct{}
+
+// WithTargetTransport sets in the context the transport used to proxy the requests
+// to the target service.
+func WithTargetTransport(ctx context.Context, transport http.RoundTripper) context.Context {
+	return context.WithValue(ctx, targetTransportKey{}, transport)
+}
+
+// getTargetTransport returns the transport set in the context, or the default one.
+func getTargetTransport(ctx context.Context) http.RoundTripper {
+	transport, ok := ctx.Value(targetTransportKey{}).(http.RoundTripper)
+	if !ok || transport == nil {
+		return http.DefaultTransport
+	}
+	return transport
+}
+
+func targetTransportMiddleware(transport http.RoundTripper) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithTargetTransport(r.Context(), transport)))
+		})
+	}
+}
+
+// metricsTransport records the duration of the round trips to the upstream services,
+// by upstream host and response status code.
+type metricsTransport struct {
+	next    http.RoundTripper
+	metrics *metrics.Metrics
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	statusCode := "error"
+	if err == nil {
+		statusCode = strconv.Itoa(resp.StatusCode)
+	}
+	t.metrics.ProxyRequestDurationMilliseconds.With(metrics.Labels{
+		"upstream":    req.URL.Host,
+		"status_code": statusCode,
+	}).Observe(float64(time.Since(start).Milliseconds()))
+	return resp, err
+}
+
+// tracingTransport traces the round trips to the upstream services, propagating the
+// W3C trace context in the request headers.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracing.Start(req.Context(), "upstream round trip",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Host),
+			semconv.URLPath(req.URL.Path),
+		),
+	)
+	defer span.End()
+
+	// the request must not be modified by the round tripper
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+func metricsMiddleware(m *metrics.Metrics) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(metrics.WithContext(r.Context(), m)))
+		})
+	}
+}
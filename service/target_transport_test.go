@@ -0,0 +1,46 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rond-authz/rond/internal/testutils"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracingTransport(t *testing.T) {
+	testutils.SetupTracing(t)
+
+	var upstreamTraceParent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceParent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	resp, err := tracingTransport{next: http.DefaultTransport}.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.NotEmpty(t, upstreamTraceParent, "trace context not propagated")
+	require.Empty(t, req.Header.Get("traceparent"), "the caller request must not be modified")
+}
@@ -0,0 +1,46 @@
+// Copyright 2023 Mia srl
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rond-authz/rond/internal/config"
+
+	"github.com/gorilla/mux"
+)
+
+type upstreamTargetsKey struct{}
+
+// WithUpstreamTargets sets in the context the upstream targets the requests are
+// proxied to, matching their path prefix.
+func WithUpstreamTargets(ctx context.Context, upstreamTargets []config.UpstreamTarget) context.Context {
+	return context.WithValue(ctx, upstreamTargetsKey{}, upstreamTargets)
+}
+
+// getUpstreamTargets returns the upstream targets set in the context, if any.
+func getUpstreamTargets(ctx context.Context) []config.UpstreamTarget {
+	upstreamTargets, _ := ctx.Value(upstreamTargetsKey{}).([]config.UpstreamTarget)
+	return upstreamTargets
+}
+
+func upstreamTargetsMiddleware(upstreamTargets []config.UpstreamTarget) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithUpstreamTargets(r.Context(), upstreamTargets)))
+		})
+	}
+}